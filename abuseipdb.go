@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// abuseInfo is the subset of an AbuseIPDB check response ipgrep reports.
+type abuseInfo struct {
+	Score   int `json:"abuseConfidenceScore"` // 0–100 confidence the IP is abusive.
+	Reports int `json:"totalReports"`         // reports in the last 90 days.
+}
+
+// lookupAbuseIPDB fetches ip’s reputation from AbuseIPDB, consulting the
+// cache first. A nil result means the query failed.
+func lookupAbuseIPDB(ip, key string, timeout time.Duration) *abuseInfo {
+	b, err := cached("abuseipdb", ip, func() ([]byte, error) {
+		u := "https://api.abuseipdb.com/api/v2/check?maxAgeInDays=90&ipAddress=" + url.QueryEscape(ip)
+		return apiGet(u, http.Header{"Key": {key}, "Accept": {"application/json"}}, timeout)
+	})
+	if err != nil || len(b) == 0 {
+		return nil
+	}
+	var resp struct {
+		Data *abuseInfo `json:"data"`
+	}
+	if json.Unmarshal(b, &resp) != nil {
+		return nil
+	}
+	return resp.Data
+}
+
+// columns returns the text-mode fields for a, or placeholders if a is nil.
+func (a *abuseInfo) columns() []column {
+	score, reports := missing, missing
+	if a != nil {
+		score, reports = strconv.Itoa(a.Score), strconv.Itoa(a.Reports)
+	}
+	return []column{{"ABUSE SCORE", score}, {"REPORTS", reports}}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+	"time"
+)
+
+// alert describes an IP seen too often within -alert-window.
+type alert struct {
+	IP     string    `json:"ip"`
+	Count  int       `json:"count"`
+	Window string    `json:"window"`
+	File   string    `json:"file"` // file the triggering line came from.
+	Line   string    `json:"line"`
+	Time   time.Time `json:"time"`
+}
+
+// alerter raises an alert whenever an IP seen while following files exceeds
+// a threshold number of sightings within a sliding window.
+type alerter struct {
+	threshold int
+	seen      *talkers
+	action    func(alert)
+}
+
+// newAlerter returns an alerter that runs the action described by spec:
+// "stderr", "webhook:URL", or "exec:COMMAND".
+func newAlerter(threshold int, window time.Duration, spec string) (*alerter, error) {
+	a := &alerter{threshold: threshold, seen: newTalkers(window)}
+	kind, arg := spec, ""
+	if i := strings.Index(spec, ":"); i >= 0 {
+		kind, arg = spec[:i], spec[i+1:]
+	}
+	switch {
+	case kind == "stderr" && arg == "":
+		a.action = alertStderr
+	case kind == "webhook" && arg != "":
+		a.action = func(al alert) { alertWebhook(arg, al) }
+	case kind == "exec" && arg != "":
+		a.action = func(al alert) { alertExec(arg, al) }
+	default:
+		return nil, fmt.Errorf("invalid -alert-action %q: want stderr, webhook:URL, or exec:COMMAND", spec)
+	}
+	return a, nil
+}
+
+// observe records a sighting of ip on line l and raises an alert if that
+// takes it over the threshold. Once an IP has triggered an alert, it
+// triggers another only after dropping back to the threshold.
+func (a *alerter) observe(ip netip.Addr, l followedLine, now time.Time) {
+	a.seen.add(ip, nil, now)
+	n := a.seen.count(ip, now)
+	if n != a.threshold+1 {
+		return
+	}
+	go a.action(alert{
+		IP:     ip.String(),
+		Count:  n,
+		Window: a.seen.window.String(),
+		File:   l.File,
+		Line:   strings.TrimRight(string(l.Text), "\r\n"),
+		Time:   now,
+	})
+}
+
+// mustAlerter returns the alerter requested by -alert-threshold, or nil if
+// none was, dying if -alert-action is invalid.
+func mustAlerter() *alerter {
+	if *alertThreshold == 0 {
+		return nil
+	}
+	a, err := newAlerter(*alertThreshold, *alertWindow, *alertAction)
+	if err != nil {
+		die(err)
+	}
+	return a
+}
+
+// alertStderr prints al to stderr.
+func alertStderr(al alert) {
+	printError(fmt.Sprintf("alert: %v seen %d times within %v (%v)", al.IP, al.Count, al.Window, al.File))
+}
+
+// alertWebhook posts al as JSON to url, reporting failures to stderr.
+func alertWebhook(url string, al alert) {
+	b, _ := json.Marshal(al)
+	client := &http.Client{Timeout: *lookupTimeout}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(b))
+	if err != nil {
+		printError(fmt.Sprintf("alert webhook: %v", err))
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		printError(fmt.Sprintf("alert webhook: POST %v: %v", url, resp.Status))
+	}
+}
+
+// alertExec runs command with the shell, describing al in its environment,
+// and reports failures to stderr.
+func alertExec(command string, al alert) {
+	cmd := shellCommand(command)
+	cmd.Env = append(os.Environ(),
+		"ALERT_IP="+al.IP,
+		fmt.Sprintf("ALERT_COUNT=%d", al.Count),
+		"ALERT_WINDOW="+al.Window,
+		"ALERT_FILE="+al.File,
+		"ALERT_LINE="+al.Line,
+	)
+	cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+	if err := cmd.Run(); err != nil {
+		printError(fmt.Sprintf("alert command: %v", err))
+	}
+}
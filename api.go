@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// errNotFound is returned by apiGet when the service has no data for
+	// the requested resource.
+	errNotFound = errors.New("not found")
+
+	// errRateLimited is returned by apiGet when the service refuses a
+	// request because the caller’s rate limit or quota is exhausted.
+	errRateLimited = errors.New("rate limit exceeded")
+)
+
+// apiKey returns the API key for a third-party service, taken from the
+// environment variable env if set, or else from the config file’s api-keys
+// (under name without its “.key” suffix), or else from the first line of the
+// file name in ipgrep’s configuration directory.
+func apiKey(env, name string) (string, error) {
+	if k := os.Getenv(env); k != "" {
+		return k, nil
+	}
+	if k := loadConfig().APIKeys[strings.TrimSuffix(name, ".key")]; k != "" {
+		return k, nil
+	}
+	b, err := ioutil.ReadFile(configPath(name))
+	if err != nil {
+		return "", fmt.Errorf("no API key: set %v or write it to %v", env, configPath(name))
+	}
+	return strings.TrimSpace(strings.SplitN(string(b), "\n", 2)[0]), nil
+}
+
+// apiGet fetches rawURL with the given request headers and returns the body
+// of a successful response. Its errors leave out rawURL’s query, which may
+// carry an API key, as Shodan’s does.
+func apiGet(rawURL string, header http.Header, timeout time.Duration) ([]byte, error) {
+	req, err := http.NewRequest("GET", rawURL, nil)
+	if err != nil {
+		return nil, withoutQuery(err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, withoutQuery(err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return ioutil.ReadAll(resp.Body)
+	case http.StatusNotFound:
+		return nil, errNotFound
+	case http.StatusTooManyRequests:
+		return nil, errRateLimited
+	}
+	return nil, fmt.Errorf("GET %v: %v", req.URL.Host+req.URL.Path, resp.Status)
+}
+
+// withoutQuery returns err with the query cut from the URL it names, if it
+// is a *url.Error.
+func withoutQuery(err error) error {
+	var ue *url.Error
+	if errors.As(err, &ue) {
+		ue.URL, _, _ = strings.Cut(ue.URL, "?")
+	}
+	return err
+}
+
+// throttle spaces out calls to wait so that they return at most once per
+// interval, however many goroutines share it.
+type throttle struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func (t *throttle) wait() {
+	t.mu.Lock()
+	now := time.Now()
+	if t.next.Before(now) {
+		t.next = now
+	}
+	d := t.next.Sub(now)
+	t.next = t.next.Add(t.interval)
+	t.mu.Unlock()
+	time.Sleep(d)
+}
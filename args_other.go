@@ -0,0 +1,8 @@
+//go:build !windows
+
+package main
+
+// expandArgs returns args as they are: on Unix, the shell expands wildcards.
+func expandArgs(args []string) []string {
+	return args
+}
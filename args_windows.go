@@ -0,0 +1,50 @@
+//go:build windows
+
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// expandArgs does for Windows what Unix shells do before ipgrep ever runs,
+// since cmd and PowerShell don’t: it replaces each argument containing
+// wildcards with the paths matching it, as in “ipgrep C:\logs\*.log”.
+// Arguments matching nothing are kept as they are, to be reported as
+// missing. Slashes of either kind work, and paths too long for the usual
+// Windows limit are given the \\?\ prefix that lifts it.
+func expandArgs(args []string) []string {
+	var out []string
+	for _, arg := range args {
+		if strings.ContainsAny(arg, "*?[") && !strings.HasPrefix(arg, `\\?\`) {
+			if matches, err := filepath.Glob(filepath.FromSlash(arg)); err == nil && len(matches) > 0 {
+				for _, m := range matches {
+					out = append(out, longPath(m))
+				}
+				continue
+			}
+		}
+		out = append(out, longPath(arg))
+	}
+	return out
+}
+
+// maxPath is the length beyond which Windows APIs need the \\?\ prefix,
+// less room for the file name CreateDirectory insists on.
+const maxPath = 260 - 12
+
+// longPath returns name in the \\?\ form Windows needs for paths longer than
+// maxPath, or as it is if it is short enough or already in that form.
+func longPath(name string) string {
+	if len(name) < maxPath || strings.HasPrefix(name, `\\?\`) {
+		return name
+	}
+	abs, err := filepath.Abs(filepath.FromSlash(name))
+	if err != nil {
+		return name
+	}
+	if strings.HasPrefix(abs, `\\`) {
+		return `\\?\UNC\` + abs[2:] // \\server\share\...
+	}
+	return `\\?\` + abs
+}
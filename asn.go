@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Team Cymru’s IP-to-ASN mapping service answers TXT queries under these
+// zones. See https://www.team-cymru.com/ip-asn-mapping.
+const (
+	cymruOrigin4 = "origin.asn.cymru.com"
+	cymruOrigin6 = "origin6.asn.cymru.com"
+	cymruASN     = "asn.cymru.com"
+)
+
+// asnInfo describes the network that originates a route to an IP.
+type asnInfo struct {
+	ASN     string `json:"asn"`               // origin AS number, e.g. "15169".
+	Name    string `json:"name,omitempty"`    // AS name, e.g. "GOOGLE, US".
+	Prefix  string `json:"prefix"`            // announced prefix covering the IP.
+	Country string `json:"country,omitempty"` // country the prefix is registered to.
+}
+
+// asNames keeps AS names in memory as well as in the cache, since most IPs in
+// a typical log share a handful of origin networks.
+var asNames sync.Map
+
+// lookupASN queries Team Cymru for the origin AS of ip. A nil result means
+// the IP is unrouted or the lookup failed.
+func lookupASN(ip netip.Addr, timeout time.Duration) *asnInfo {
+	zone := cymruOrigin4
+	if ip.Is6() {
+		zone = cymruOrigin6
+	}
+	f := cymruTXT("asn", reverseName(ip)+"."+zone, timeout)
+	if len(f) < 3 {
+		return nil
+	}
+	// An IP announced by several origins lists them all, space-separated.
+	info := &asnInfo{
+		ASN:     strings.Fields(f[0])[0],
+		Prefix:  f[1],
+		Country: f[2],
+	}
+	if name, ok := asNames.Load(info.ASN); ok {
+		info.Name = name.(string)
+		return info
+	}
+	if f := cymruTXT("asname", "AS"+info.ASN+"."+cymruASN, timeout); len(f) >= 5 {
+		info.Name = f[4]
+		asNames.Store(info.ASN, info.Name)
+	}
+	return info
+}
+
+// cymruTXT fetches the first TXT record for name, caching it under source,
+// and splits it on the ’|’ delimiters Team Cymru uses, trimming whitespace
+// from each field.
+func cymruTXT(source, name string, timeout time.Duration) []string {
+	b, err := cached(source, name, func() ([]byte, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		txt, err := net.DefaultResolver.LookupTXT(ctx, name)
+		if err != nil {
+			return nil, dnsError(err)
+		}
+		if len(txt) == 0 {
+			return nil, errNotFound
+		}
+		return []byte(txt[0]), nil
+	})
+	if err != nil || len(b) == 0 {
+		return nil
+	}
+	f := strings.Split(string(b), "|")
+	for i := range f {
+		f[i] = strings.TrimSpace(f[i])
+	}
+	if f[0] == "" {
+		return nil
+	}
+	return f
+}
+
+// reverseName returns the DNS labels for ip in reverse order, without a zone:
+// "4.3.2.1" for 1.2.3.4, and reversed nibbles for IPv6.
+func reverseName(ip netip.Addr) string {
+	if ip.Is4() {
+		v4 := ip.As4()
+		return fmt.Sprintf("%d.%d.%d.%d", v4[3], v4[2], v4[1], v4[0])
+	}
+	var b strings.Builder
+	v6 := ip.As16()
+	for i := len(v6) - 1; i >= 0; i-- {
+		fmt.Fprintf(&b, "%x.%x.", v6[i]&0xf, v6[i]>>4)
+	}
+	return strings.TrimSuffix(b.String(), ".")
+}
+
+// columns returns the text-mode fields for a, or placeholders if a is nil.
+func (a *asnInfo) columns() []column {
+	if a == nil {
+		a = new(asnInfo)
+	}
+	asn := missing
+	if a.ASN != "" {
+		asn = "AS" + a.ASN
+	}
+	return []column{
+		{"ASN", asn},
+		{"PREFIX", orMissing(a.Prefix)},
+		{"AS ORG", orMissing(a.Name)},
+		{"COUNTRY", orMissing(a.Country)},
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/princebot/ipgrep/ipgrep"
+)
+
+const baselineUsage = `
+usage: %[1]v baseline [-append] save NAME file ...
+       %[1]v baseline [-output FORMAT] diff NAME file ...
+
+Records the IPs seen in a set of files as a named baseline, then reports only
+the IPs in later files that aren’t in it — the core of a “what’s new today?”
+hunt.
+
+	save    store the unique IPs in the files as baseline NAME, replacing
+	        any baseline of that name
+	diff    print the unique IPs in the files that are not in baseline NAME
+
+	-append           with save, add to baseline NAME instead of replacing it
+	-output FORMAT    with diff, print new IPs as text (the default) or json
+
+Baselines are stored in %[2]v, one IP per line.
+`
+
+// baselineFlags holds the options of “ipgrep baseline”.
+var (
+	baselineFlags  = flag.NewFlagSet("baseline", flag.ExitOnError)
+	baselineAppend = baselineFlags.Bool("append", false, "add to the baseline instead of replacing it")
+)
+
+func init() {
+	baselineFlags.StringVar(output, "output", "text", "output format: text or json")
+	baselineFlags.Usage = func() { fmt.Fprintf(os.Stderr, baselineUsage, prog, baselinePath("")) }
+}
+
+// baselineCommand implements “ipgrep baseline”.
+func baselineCommand(args []string) {
+	fs := baselineFlags
+	parseArgs(fs, args)
+	if fs.NArg() < 3 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if *output != "text" && *output != "json" {
+		die(fmt.Sprintf("unknown output format %q", *output))
+	}
+	name := fs.Arg(1)
+	if name == "" || strings.ContainsAny(name, `/\`) || name[0] == '.' {
+		die(fmt.Sprintf("invalid baseline name %q", name))
+	}
+	var ips []netip.Addr
+	for _, fn := range fs.Args()[2:] {
+		ips = append(ips, scanFile(fn)...)
+	}
+	switch fs.Arg(0) {
+	case "save":
+		if *baselineAppend {
+			old, err := loadBaseline(name)
+			if err != nil && !os.IsNotExist(err) {
+				die(err)
+			}
+			ips = append(old, ips...)
+		}
+		if err := saveBaseline(name, ips); err != nil {
+			die(err)
+		}
+	case "diff":
+		old, err := loadBaseline(name)
+		if os.IsNotExist(err) {
+			die(fmt.Sprintf("no baseline named %q; create one with “%v baseline save”", name, prog))
+		}
+		if err != nil {
+			die(err)
+		}
+		printBaselineDiff(name, diffIPs(old, dedupe(ips)).OnlyB)
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+}
+
+// baselinePath returns where the baseline called name is stored.
+func baselinePath(name string) string {
+	return filepath.Join(configPath("baselines"), name)
+}
+
+// loadBaseline returns the IPs in the baseline called name.
+func loadBaseline(name string) ([]netip.Addr, error) {
+	b, err := ioutil.ReadFile(baselinePath(name))
+	if err != nil {
+		return nil, err
+	}
+	return ipgrep.Extract(b), nil
+}
+
+// saveBaseline stores the unique IPs among ips as the baseline called name.
+func saveBaseline(name string, ips []netip.Addr) error {
+	var b bytes.Buffer
+	for _, ip := range dedupe(ips) {
+		fmt.Fprintln(&b, ip)
+	}
+	path := baselinePath(name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b.Bytes(), 0644)
+}
+
+// dedupe returns each distinct IP in ips, in order of first appearance.
+func dedupe(ips []netip.Addr) []netip.Addr {
+	return unique([]*scanResult{{IPs: ips}})
+}
+
+// printBaselineDiff prints the IPs that are new since baseline name.
+func printBaselineDiff(name string, ips []string) {
+	if *output == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(ips); err != nil {
+			die(err)
+		}
+		return
+	}
+	fmt.Printf("# not in baseline %v:\n", name)
+	for _, ip := range ips {
+		fmt.Println(ip)
+	}
+	fmt.Println()
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// cacheTTLs sets how long each source’s lookups are reused before being
+// repeated. -cache-ttl overrides individual entries.
+var cacheTTLs = map[string]time.Duration{
+	"ptr":            24 * time.Hour,
+	"fcrdns":         24 * time.Hour,
+	"asn":            24 * time.Hour,
+	"asname":         7 * 24 * time.Hour,
+	"rdap":           7 * 24 * time.Hour,
+	"rdap-bootstrap": 7 * 24 * time.Hour,
+	"dnsbl":          time.Hour,
+	"feeds":          6 * time.Hour,
+	"shodan":         24 * time.Hour,
+	"abuseipdb":      24 * time.Hour,
+	"virustotal":     24 * time.Hour,
+	"greynoise":      24 * time.Hour,
+}
+
+var (
+	cacheOnce sync.Once
+	cacheDB   *bolt.DB // nil if the cache is disabled or couldn’t be opened.
+)
+
+// openCache opens the cache database, creating it if necessary. If another
+// ipgrep holds it open for more than a second, or it can’t be created, the
+// run proceeds uncached.
+func openCache() *bolt.DB {
+	cacheOnce.Do(func() {
+		if *noCache && !*offline {
+			return
+		}
+		path := filepath.Join(cacheDir(), "cache.db")
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return
+		}
+		db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: time.Second})
+		if err != nil {
+			return
+		}
+		cacheDB = db
+	})
+	return cacheDB
+}
+
+// closeCache flushes and closes the cache database if it was opened.
+func closeCache() {
+	if cacheDB != nil {
+		cacheDB.Close()
+	}
+}
+
+// errOffline is returned by cached when -offline is set and nothing is
+// cached for the requested key.
+var errOffline = errors.New("not cached, and running offline")
+
+// cached returns the value stored under source and key if it is younger than
+// the source’s TTL, or else calls fetch and stores what it returns. A fetch
+// that fails with errNotFound is cached as an empty value so that it, too,
+// is not repeated; other errors are returned and not cached. With -offline,
+// cached values are returned however old they are, and fetch is never called.
+func cached(source, key string, fetch func() ([]byte, error)) ([]byte, error) {
+	db := openCache()
+	if db != nil {
+		var (
+			b     []byte
+			fresh bool
+		)
+		db.View(func(tx *bolt.Tx) error {
+			bk := tx.Bucket([]byte(source))
+			if bk == nil {
+				return nil
+			}
+			v := bk.Get([]byte(key))
+			if len(v) < 8 {
+				return nil
+			}
+			stored := time.Unix(0, int64(binary.BigEndian.Uint64(v)))
+			if *offline || time.Since(stored) < cacheTTLs[source] {
+				b, fresh = append([]byte(nil), v[8:]...), true
+			}
+			return nil
+		})
+		if fresh {
+			logger.Debug("lookup cached", "source", source, "key", key)
+			return b, nil
+		}
+	}
+	if *offline {
+		logger.Debug("lookup skipped", "source", source, "key", key, "reason", "offline")
+		return nil, errOffline
+	}
+	start := time.Now()
+	b, err := fetch()
+	logger.Debug("lookup", "source", source, "key", key, "took", time.Since(start), "err", err)
+	if err == errNotFound {
+		b, err = nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if db != nil {
+		v := make([]byte, 8, 8+len(b))
+		binary.BigEndian.PutUint64(v, uint64(time.Now().UnixNano()))
+		v = append(v, b...)
+		db.Batch(func(tx *bolt.Tx) error {
+			bk, err := tx.CreateBucketIfNotExists([]byte(source))
+			if err != nil {
+				return err
+			}
+			return bk.Put([]byte(key), v)
+		})
+	}
+	return b, nil
+}
+
+// setCacheTTLs applies a -cache-ttl value: comma-separated source=duration
+// pairs such as "ptr=1h,rdap=720h".
+func setCacheTTLs(s string) error {
+	for _, kv := range strings.Split(s, ",") {
+		if kv = strings.TrimSpace(kv); kv == "" {
+			continue
+		}
+		i := strings.IndexByte(kv, '=')
+		if i < 0 {
+			return fmt.Errorf("-cache-ttl: %q is not source=duration", kv)
+		}
+		source := kv[:i]
+		if _, ok := cacheTTLs[source]; !ok {
+			return fmt.Errorf("-cache-ttl: unknown source %q", source)
+		}
+		d, err := time.ParseDuration(kv[i+1:])
+		if err != nil {
+			return fmt.Errorf("-cache-ttl: %v", err)
+		}
+		cacheTTLs[source] = d
+	}
+	return nil
+}
+
+// cacheDir returns the root of ipgrep’s on-disk cache.
+func cacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, prog)
+}
@@ -0,0 +1,76 @@
+//go:build cgo
+
+// Command capi is ipgrep’s extraction as a C library, for calling from other
+// languages through their foreign function interfaces. Built with
+//
+//	go build -buildmode=c-shared -o libipgrep.so ./capi
+//
+// it exports, as declared in the libipgrep.h generated alongside:
+//
+//	char *ipgrep_extract(char *text, size_t len);
+//	char *ipgrep_extract_json(char *text, size_t len);
+//	void ipgrep_free(char *s);
+//
+// ipgrep_extract returns the IPs in the len bytes at text, as the ipgrep
+// command would print them, one per line; ipgrep_extract_json returns a JSON
+// array with an object for each, giving its ip, token, line, column, and
+// offset. The text needn’t be NUL-terminated and is neither kept nor
+// changed. Each returned string is NUL-terminated and must be released with
+// ipgrep_free.
+package main
+
+/*
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"unsafe"
+
+	"github.com/princebot/ipgrep/ipgrep"
+)
+
+func main() {}
+
+//export ipgrep_extract
+func ipgrep_extract(text *C.char, n C.size_t) *C.char {
+	var b strings.Builder
+	for m := range ipgrep.All(input(text, n)) {
+		b.WriteString(m.IP.String())
+		b.WriteByte('\n')
+	}
+	return C.CString(b.String())
+}
+
+//export ipgrep_extract_json
+func ipgrep_extract_json(text *C.char, n C.size_t) *C.char {
+	type match struct {
+		IP     string `json:"ip"`
+		Token  string `json:"token"`
+		Line   int    `json:"line"`
+		Column int    `json:"column"`
+		Offset int64  `json:"offset"`
+	}
+	found := []match{}
+	for m := range ipgrep.All(input(text, n)) {
+		found = append(found, match{m.IP.String(), m.Artifact.Text, m.Line, m.Column, m.Offset})
+	}
+	b, _ := json.Marshal(found) // can’t fail for these types.
+	return C.CString(string(b))
+}
+
+//export ipgrep_free
+func ipgrep_free(s *C.char) {
+	C.free(unsafe.Pointer(s))
+}
+
+// input reads the n bytes at text, which C owns, without copying them.
+func input(text *C.char, n C.size_t) *bytes.Reader {
+	if text == nil || n == 0 {
+		return bytes.NewReader(nil)
+	}
+	return bytes.NewReader(unsafe.Slice((*byte)(unsafe.Pointer(text)), int(n)))
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/princebot/ipgrep/ipgrep"
+)
+
+// minChunk is the least of a file worth scanning apart from the rest of it;
+// below that, starting another scan costs more than it saves.
+const minChunk = 16 << 20
+
+// chunkJobs is how many pieces scan may split a file into, to scan them at
+// once. scanFiles sets it from the workers that have no file of their own,
+// so that one big file can have all of them.
+var chunkJobs = 1
+
+// splitInput returns where to split fp, or mapped, its content, if it isn’t
+// nil, for scanning in pieces: the offsets at which each piece begins, then
+// the size of the file. Each piece but the last ends with a newline, so that
+// none of them begins partway through a line. splitInput returns nil if the
+// file isn’t worth splitting, or can’t be — if it isn’t a regular file, or
+// ok is false because the scan needs to see its lines in order.
+func splitInput(fp *os.File, mapped []byte, ok bool) []int64 {
+	if !ok || chunkJobs < 2 {
+		return nil
+	}
+	var (
+		r    io.ReaderAt = fp
+		size             = int64(len(mapped))
+	)
+	if mapped != nil {
+		r = bytes.NewReader(mapped)
+	} else {
+		fi, err := fp.Stat()
+		if err != nil || !fi.Mode().IsRegular() {
+			return nil
+		}
+		size = fi.Size()
+	}
+	n := int64(chunkJobs)
+	if most := size / minChunk; n > most {
+		n = most
+	}
+	var (
+		bounds = []int64{0}
+		buf    = make([]byte, 64<<10)
+	)
+	for i := int64(1); i < n; i++ {
+		off := size * i / n
+		if off < bounds[len(bounds)-1] {
+			continue // a long line ran past it.
+		}
+		end, ok := lineEnd(r, off, buf)
+		if !ok || end == size {
+			break
+		}
+		bounds = append(bounds, end)
+	}
+	if len(bounds) < 2 {
+		return nil
+	}
+	return append(bounds, size)
+}
+
+// lineEnd returns the offset just past the first newline in r at or after
+// off, reading it a buffer at a time, and false if there is none.
+func lineEnd(r io.ReaderAt, off int64, buf []byte) (int64, bool) {
+	for {
+		n, err := r.ReadAt(buf, off)
+		if i := bytes.IndexByte(buf[:n], '\n'); i >= 0 {
+			return off + int64(i) + 1, true
+		}
+		if err != nil {
+			return 0, false
+		}
+		off += int64(n)
+	}
+}
+
+// chunk is the result of scanning one piece of a file.
+type chunk struct {
+	res   *scanResult
+	lines int   // how many there were.
+	read  int64 // how many bytes.
+	err   error
+}
+
+// scanChunks scans the pieces of fp, or of mapped, its content, if it isn’t
+// nil, between bounds at once, and joins what is found into res in order of
+// the pieces, numbering lines and offsets from the start of the file. It
+// returns how much was read and the error, if any, that ended the first
+// piece to end with one, leaving in res only what was found before it, as a
+// scan in one piece would.
+func scanChunks(ctx context.Context, fp *os.File, mapped []byte, bounds []int64, res *scanResult, opts []ipgrep.Option) (int64, error) {
+	var (
+		chunks = make([]chunk, len(bounds)-1)
+		wg     sync.WaitGroup
+	)
+	logger.Debug("scanning in pieces", "file", res.File, "pieces", len(chunks))
+	for i := range chunks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var (
+				c          = &chunks[i]
+				start, end = bounds[i], bounds[i+1]
+			)
+			c.res = &scanResult{File: res.File}
+			col := newCollector(c.res, nil, mapped != nil, nil)
+			if mapped != nil {
+				b := mapped[start:end]
+				c.err = ipgrep.ScanBytes(ctx, b, col.add, opts...)
+				meter.add(len(b) - int(col.metered))
+				c.lines, c.read = bytes.Count(b, []byte{'\n'}), int64(len(b))
+			} else {
+				mr := &meteredReader{r: io.NewSectionReader(fp, start, end-start)}
+				lc := &lineCounter{r: mr}
+				c.err = ipgrep.Scan(ctx, lc, col.add, opts...)
+				c.lines, c.read = lc.n, mr.n
+			}
+		}()
+	}
+	wg.Wait()
+
+	var read int64
+	line := 0 // lines in the pieces before this one.
+	for i, c := range chunks {
+		for j := range c.res.Matches {
+			m := &c.res.Matches[j]
+			m.Line += line
+			m.Offset += bounds[i]
+		}
+		res.IPs = append(res.IPs, c.res.IPs...)
+		res.Times = append(res.Times, c.res.Times...)
+		res.Matches = append(res.Matches, c.res.Matches...)
+		line += c.lines
+		read += c.read
+		if c.err != nil {
+			return read, c.err
+		}
+	}
+	return read, nil
+}
+
+// lineCounter counts the newlines read from it.
+type lineCounter struct {
+	r io.Reader
+	n int
+}
+
+func (l *lineCounter) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.n += bytes.Count(p[:n], []byte{'\n'})
+	return n, err
+}
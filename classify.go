@@ -0,0 +1,64 @@
+package main
+
+import "net/netip"
+
+// Address classes reported by classify.
+const (
+	classPublic        = "public"
+	classPrivate       = "private"
+	classLoopback      = "loopback"
+	classLinkLocal     = "link-local"
+	classMulticast     = "multicast"
+	classCGNAT         = "cgnat"
+	class6to4          = "6to4"
+	classTeredo        = "teredo"
+	classULA           = "ula"
+	classDocumentation = "documentation"
+	classUnspecified   = "unspecified"
+	classReserved      = "reserved"
+)
+
+// classBlocks lists the special-purpose ranges netip.Addr has no predicate for,
+// checked in order. See RFCs 6598, 3056, 4380, 4193, 5737, 3849, 9637, and
+// the IANA special-purpose address registries.
+var classBlocks = []struct {
+	class string
+	block netip.Prefix
+}{
+	{classCGNAT, netip.MustParsePrefix("100.64.0.0/10")},
+	{classDocumentation, netip.MustParsePrefix("192.0.2.0/24")},
+	{classDocumentation, netip.MustParsePrefix("198.51.100.0/24")},
+	{classDocumentation, netip.MustParsePrefix("203.0.113.0/24")},
+	{classDocumentation, netip.MustParsePrefix("2001:db8::/32")},
+	{classDocumentation, netip.MustParsePrefix("3fff::/20")},
+	{classReserved, netip.MustParsePrefix("0.0.0.0/8")},
+	{classReserved, netip.MustParsePrefix("192.0.0.0/24")},
+	{classReserved, netip.MustParsePrefix("198.18.0.0/15")},
+	{classReserved, netip.MustParsePrefix("240.0.0.0/4")},
+	{class6to4, netip.MustParsePrefix("2002::/16")},
+	{classTeredo, netip.MustParsePrefix("2001::/32")},
+	{classULA, netip.MustParsePrefix("fc00::/7")},
+}
+
+// classify returns the class of ip: one of the class constants above.
+func classify(ip netip.Addr) string {
+	switch {
+	case ip.IsUnspecified():
+		return classUnspecified
+	case ip.IsLoopback():
+		return classLoopback
+	case ip.IsLinkLocalUnicast():
+		return classLinkLocal
+	case ip.IsMulticast():
+		return classMulticast
+	}
+	for _, b := range classBlocks {
+		if b.block.Contains(ip) {
+			return b.class
+		}
+	}
+	if ip.IsPrivate() {
+		return classPrivate
+	}
+	return classPublic
+}
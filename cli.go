@@ -0,0 +1,104 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// command is a subcommand: its options, and the function implementing it,
+// which is given the arguments following the command’s name.
+type command struct {
+	summary string
+	args    string // the arguments it takes, as in a usage message.
+	flags   *flag.FlagSet
+	run     func(args []string)
+	words   []string // choices for the first argument, if it has any.
+}
+
+// commands maps each subcommand’s name to its definition. Arguments that
+// don’t start with a command name are taken as arguments to scan.
+var commands map[string]*command
+
+// helpFlags holds the options of “ipgrep help”, of which there are none.
+var helpFlags = flag.NewFlagSet("help", flag.ExitOnError)
+
+func init() {
+	commands = map[string]*command{
+		"scan":       {"scan files for IPs (the default)", "file ...", flag.CommandLine, scanCommand, nil},
+		"feeds":      {"manage stored threat feeds", "sync|list|prune", feedsFlags, feedsCommand, []string{"sync", "list", "prune"}},
+		"diff":       {"compare the IPs in two files", "A B", diffFlags, diffCommand, nil},
+		"stats":      {"summarize the IPs in files", "file ...", statsFlags, statsCommand, nil},
+		"baseline":   {"save IP baselines and report new IPs", "save|diff NAME file ...", baselineFlags, baselineCommand, []string{"save", "diff"}},
+		"neighbors":  {"scan the system’s ARP and neighbor tables", "", flag.CommandLine, neighborsCommand, nil},
+		"net":        {"scan the system’s connections", "", flag.CommandLine, netCommand, nil},
+		"refang":     {"restore defanged indicators", "file ...", refangFlags, refangCommand, nil},
+		"system":     {"scan the system’s network configuration", "", flag.CommandLine, systemCommand, nil},
+		"completion": {"print a shell completion script", "bash|zsh|fish|powershell", completionFlags, completionCommand, completionShells},
+		"man":        {"print the manual page", "", manFlags, manCommand, nil},
+		"help":       {"explain a command", "[command]", helpFlags, helpCommand, nil},
+	}
+	commands["help"].words = commandNames()
+}
+
+func main() {
+	args := os.Args[1:]
+	if len(args) > 0 {
+		if cmd, ok := commands[args[0]]; ok {
+			cmd.run(args[1:])
+			return
+		}
+	}
+	scanCommand(args)
+}
+
+// helpCommand implements “ipgrep help [command]”.
+func helpCommand(args []string) {
+	if len(args) == 0 || args[0] == "scan" {
+		scanUsage()
+		os.Exit(0)
+	}
+	cmd, ok := commands[args[0]]
+	if !ok || args[0] == "help" {
+		die(fmt.Sprintf("unknown command %q; commands are %v", args[0], strings.Join(commandNames(), ", ")))
+	}
+	cmd.run([]string{"-h"})
+}
+
+// commandNames returns the names of the subcommands in order.
+func commandNames() []string {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// parseArgs parses the flags in args with fs, allowing them to be mixed
+// with other arguments, as in “ipgrep file -rdns”. Everything following a
+// “--” argument is taken literally. Afterward, fs.Args returns the non-flag
+// arguments in order, with wildcards expanded on Windows. Options not given
+// in args take their defaults from the environment and the config file.
+func parseArgs(fs *flag.FlagSet, args []string) {
+	applyDefaults(fs)
+	var rest []string
+	for {
+		fs.Parse(args) // exits on error, like every FlagSet here.
+		left := fs.Args()
+		if len(left) == 0 {
+			break
+		}
+		// Parse stops at the first non-flag argument, or drops a “--”
+		// and stops after it.
+		if n := len(args) - len(left); n > 0 && args[n-1] == "--" {
+			rest = append(rest, left...)
+			break
+		}
+		rest = append(rest, left[0])
+		args = left[1:]
+	}
+	fs.Parse(append([]string{"--"}, expandArgs(rest)...))
+}
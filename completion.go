@@ -0,0 +1,331 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+const completionUsage = `
+usage: %[1]v completion bash|zsh|fish|powershell
+
+Prints a script that completes %[1]v’s commands, options, and option values
+in the given shell. For example:
+
+	bash          source <(%[1]v completion bash)
+	zsh           %[1]v completion zsh > "${fpath[1]}/_%[1]v"
+	fish          %[1]v completion fish > ~/.config/fish/completions/%[1]v.fish
+	powershell    %[1]v completion powershell | Out-String | Invoke-Expression
+`
+
+// completionShells are the shells “ipgrep completion” supports.
+var completionShells = []string{"bash", "zsh", "fish", "powershell"}
+
+// completionFlags holds the options of “ipgrep completion”, of which there
+// are none.
+var completionFlags = flag.NewFlagSet("completion", flag.ExitOnError)
+
+func init() {
+	completionFlags.Usage = func() { fmt.Fprintf(os.Stderr, completionUsage, prog) }
+}
+
+// completionCommand implements “ipgrep completion”.
+func completionCommand(args []string) {
+	fs := completionFlags
+	parseArgs(fs, args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	generators := map[string]func(io.Writer, []*cliCommand){
+		"bash":       bashCompletion,
+		"zsh":        zshCompletion,
+		"fish":       fishCompletion,
+		"powershell": powershellCompletion,
+	}
+	gen, ok := generators[fs.Arg(0)]
+	if !ok {
+		fs.Usage()
+		os.Exit(2)
+	}
+	gen(os.Stdout, describeCLI())
+}
+
+// cliCommand and cliFlag describe the command line, for generating shell
+// completions and the man page.
+type cliCommand struct {
+	Name, Summary, Args string
+	Flags               []cliFlag
+	Words               []string // choices for the first argument, if any.
+	ScanFlags           bool     // whether its options are scan’s, as net’s are.
+}
+
+type cliFlag struct {
+	Name, Usage, Default string
+	Arg                  string // a name for the value, e.g. "duration".
+	Bool                 bool
+	File                 bool     // whether the value names a file.
+	Values               []string // choices for the value, if known.
+}
+
+// describeCLI returns a description of every command, scan first and the
+// rest in alphabetical order.
+func describeCLI() []*cliCommand {
+	values := map[string][]string{
+		"output":       {"text", "json", "lines", "csv"},
+		"report":       {"matrix", "by-ip"},
+		"group-by":     {"file", "ip", "version", "classification", "none"},
+		"color":        {"auto", "always", "never"},
+		"redact":       {"placeholder", "mask", "hash"},
+		"anonymize":    {"cryptopan"},
+		"unmapped":     {"keep", "error"},
+		"timeline":     {"minute", "hour"},
+		"probe":        {"icmp"},
+		"alert-action": {"stderr"},
+	}
+	files := map[string]bool{"feeds-config": true, "watchlist": true, "map-file": true}
+	for name := range reports {
+		values["report"] = append(values["report"], name)
+	}
+	sort.Strings(values["report"])
+
+	names := []string{"scan"}
+	for _, name := range commandNames() {
+		if name != "scan" {
+			names = append(names, name)
+		}
+	}
+	var out []*cliCommand
+	for _, name := range names {
+		cmd := commands[name]
+		c := &cliCommand{Name: name, Summary: cmd.summary, Args: cmd.args, Words: cmd.words,
+			ScanFlags: name != "scan" && cmd.flags == flag.CommandLine}
+		cmd.flags.VisitAll(func(f *flag.Flag) {
+			b, ok := f.Value.(interface{ IsBoolFlag() bool })
+			arg, usage := flag.UnquoteUsage(f)
+			c.Flags = append(c.Flags, cliFlag{
+				Name:    f.Name,
+				Usage:   usage,
+				Arg:     arg,
+				Default: f.DefValue,
+				Bool:    ok && b.IsBoolFlag(),
+				File:    files[f.Name],
+				Values:  values[f.Name],
+			})
+		})
+		out = append(out, c)
+	}
+	return out
+}
+
+// flagNames returns the names of c’s options, each with a leading dash.
+func (c *cliCommand) flagNames() []string {
+	names := make([]string, len(c.Flags))
+	for i, f := range c.Flags {
+		names[i] = "-" + f.Name
+	}
+	return names
+}
+
+// bashCompletion writes a bash completion script for cmds.
+func bashCompletion(w io.Writer, cmds []*cliCommand) {
+	var names []string
+	for _, c := range cmds {
+		names = append(names, c.Name)
+	}
+	fmt.Fprintf(w, "# bash completion for %v; generated by “%v completion bash”.\n", prog, prog)
+	fmt.Fprintf(w, "_%v() {\n", prog)
+	fmt.Fprintf(w, "    local cur=${COMP_WORDS[COMP_CWORD]} prev=${COMP_WORDS[COMP_CWORD-1]}\n")
+	fmt.Fprintf(w, "    local commands=%q cmd=scan flags words\n", strings.Join(names, " "))
+	fmt.Fprintf(w, "    if [[ $COMP_CWORD -gt 1 && \" $commands \" == *\" ${COMP_WORDS[1]} \"* ]]; then\n")
+	fmt.Fprintf(w, "        cmd=${COMP_WORDS[1]}\n")
+	fmt.Fprintf(w, "    fi\n")
+	fmt.Fprintf(w, "    case $prev in\n")
+	seen := make(map[string]bool)
+	for _, c := range cmds {
+		for _, f := range c.Flags {
+			if len(f.Values) == 0 || seen[f.Name] {
+				continue
+			}
+			seen[f.Name] = true
+			fmt.Fprintf(w, "    -%v) COMPREPLY=($(compgen -W %q -- \"$cur\")); return ;;\n", f.Name, strings.Join(f.Values, " "))
+		}
+	}
+	fmt.Fprintf(w, "    esac\n")
+	fmt.Fprintf(w, "    case $cmd in\n")
+	for _, c := range cmds {
+		fmt.Fprintf(w, "    %v) flags=%q words=%q ;;\n", c.Name, strings.Join(c.flagNames(), " "), strings.Join(c.Words, " "))
+	}
+	fmt.Fprintf(w, "    esac\n")
+	fmt.Fprintf(w, "    if [[ $cur == -* ]]; then\n")
+	fmt.Fprintf(w, "        COMPREPLY=($(compgen -W \"$flags\" -- \"$cur\"))\n")
+	fmt.Fprintf(w, "        return\n")
+	fmt.Fprintf(w, "    fi\n")
+	fmt.Fprintf(w, "    if [[ $COMP_CWORD -eq 1 ]]; then\n")
+	fmt.Fprintf(w, "        words=$commands\n")
+	fmt.Fprintf(w, "    elif [[ $COMP_CWORD -eq 2 && $cmd != scan && -n $words ]]; then\n")
+	fmt.Fprintf(w, "        COMPREPLY=($(compgen -W \"$words\" -- \"$cur\"))\n")
+	fmt.Fprintf(w, "        return\n")
+	fmt.Fprintf(w, "    else\n")
+	fmt.Fprintf(w, "        words=\n")
+	fmt.Fprintf(w, "    fi\n")
+	fmt.Fprintf(w, "    COMPREPLY=($(compgen -W \"$words\" -- \"$cur\") $(compgen -f -- \"$cur\"))\n")
+	fmt.Fprintf(w, "}\n")
+	fmt.Fprintf(w, "complete -o filenames -F _%v %v\n", prog, prog)
+}
+
+// zshCompletion writes a zsh completion script for cmds.
+func zshCompletion(w io.Writer, cmds []*cliCommand) {
+	fmt.Fprintf(w, "#compdef %v\n", prog)
+	fmt.Fprintf(w, "# zsh completion for %v; generated by “%v completion zsh”.\n\n", prog, prog)
+	fmt.Fprintf(w, "_%v() {\n", prog)
+	fmt.Fprintf(w, "    local -a commands=(\n")
+	for _, c := range cmds {
+		fmt.Fprintf(w, "        %v\n", zshQuote(c.Name+":"+c.Summary))
+	}
+	fmt.Fprintf(w, "    )\n")
+	fmt.Fprintf(w, "    local cmd=scan\n")
+	fmt.Fprintf(w, "    if (( CURRENT > 2 )) && (( ${commands[(I)${words[2]}:*]} )); then\n")
+	fmt.Fprintf(w, "        cmd=${words[2]}\n")
+	fmt.Fprintf(w, "        shift words\n")
+	fmt.Fprintf(w, "        (( CURRENT-- ))\n")
+	fmt.Fprintf(w, "    elif (( CURRENT == 2 )) && [[ ${words[2]} != -* ]]; then\n")
+	fmt.Fprintf(w, "        _describe -t commands 'command' commands\n")
+	fmt.Fprintf(w, "        _files\n")
+	fmt.Fprintf(w, "        return\n")
+	fmt.Fprintf(w, "    fi\n")
+	fmt.Fprintf(w, "    case $cmd in\n")
+	for _, c := range cmds {
+		fmt.Fprintf(w, "    %v)\n", c.Name)
+		fmt.Fprintf(w, "        _arguments -S")
+		for _, f := range c.Flags {
+			spec := "-" + f.Name + "[" + zshEscape(f.Usage) + "]"
+			switch {
+			case f.Bool:
+			case len(f.Values) > 0:
+				spec += ":" + f.Name + ":(" + strings.Join(f.Values, " ") + ")"
+			case f.File:
+				spec += ":" + f.Name + ":_files"
+			default:
+				spec += ":" + f.Name + ": "
+			}
+			fmt.Fprintf(w, " \\\n            %v", zshQuote(spec))
+		}
+		if len(c.Words) > 0 {
+			fmt.Fprintf(w, " \\\n            %v", zshQuote("1:argument:("+strings.Join(c.Words, " ")+")"))
+		}
+		fmt.Fprintf(w, " \\\n            '*:file:_files'\n")
+		fmt.Fprintf(w, "        ;;\n")
+	}
+	fmt.Fprintf(w, "    esac\n")
+	fmt.Fprintf(w, "}\n\n")
+	fmt.Fprintf(w, "_%v \"$@\"\n", prog)
+}
+
+// zshEscape escapes the characters _arguments treats specially in an
+// option description.
+func zshEscape(s string) string {
+	return strings.NewReplacer("[", `\[`, "]", `\]`, ":", `\:`).Replace(s)
+}
+
+// zshQuote quotes s for the shell.
+func zshQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// fishCompletion writes a fish completion script for cmds.
+func fishCompletion(w io.Writer, cmds []*cliCommand) {
+	var others []string
+	for _, c := range cmds {
+		if c.Name != "scan" {
+			others = append(others, c.Name)
+		}
+	}
+	fmt.Fprintf(w, "# fish completion for %v; generated by “%v completion fish”.\n", prog, prog)
+	for _, c := range cmds {
+		fmt.Fprintf(w, "complete -c %v -n __fish_use_subcommand -a %v -d %v\n", prog, c.Name, zshQuote(c.Summary))
+	}
+	for _, c := range cmds {
+		cond := "__fish_seen_subcommand_from " + c.Name
+		if c.Name == "scan" {
+			cond = "not __fish_seen_subcommand_from " + strings.Join(others, " ")
+		}
+		cond = zshQuote(cond)
+		if len(c.Words) > 0 {
+			fmt.Fprintf(w, "complete -c %v -n %v -a %v\n", prog, cond, zshQuote(strings.Join(c.Words, " ")))
+		}
+		for _, f := range c.Flags {
+			arg := ""
+			switch {
+			case f.Bool:
+			case len(f.Values) > 0:
+				arg = " -x -a " + zshQuote(strings.Join(f.Values, " "))
+			case f.File:
+				arg = " -r"
+			default:
+				arg = " -x"
+			}
+			fmt.Fprintf(w, "complete -c %v -n %v -o %v%v -d %v\n", prog, cond, f.Name, arg, zshQuote(f.Usage))
+		}
+	}
+}
+
+// powershellCompletion writes a PowerShell completion script for cmds.
+func powershellCompletion(w io.Writer, cmds []*cliCommand) {
+	list := func(items []string) string {
+		q := make([]string, len(items))
+		for i, s := range items {
+			q[i] = "'" + strings.Replace(s, "'", "''", -1) + "'"
+		}
+		return "@(" + strings.Join(q, ", ") + ")"
+	}
+	fmt.Fprintf(w, "# PowerShell completion for %v; generated by “%v completion powershell”.\n", prog, prog)
+	fmt.Fprintf(w, "Register-ArgumentCompleter -Native -CommandName %v -ScriptBlock {\n", prog)
+	fmt.Fprintf(w, "    param($wordToComplete, $commandAst, $cursorPosition)\n")
+	fmt.Fprintf(w, "    $flags = @{\n")
+	for _, c := range cmds {
+		fmt.Fprintf(w, "        '%v' = %v\n", c.Name, list(c.flagNames()))
+	}
+	fmt.Fprintf(w, "    }\n")
+	fmt.Fprintf(w, "    $words = @{\n")
+	for _, c := range cmds {
+		if len(c.Words) > 0 {
+			fmt.Fprintf(w, "        '%v' = %v\n", c.Name, list(c.Words))
+		}
+	}
+	fmt.Fprintf(w, "    }\n")
+	fmt.Fprintf(w, "    $values = @{\n")
+	seen := make(map[string]bool)
+	for _, c := range cmds {
+		for _, f := range c.Flags {
+			if len(f.Values) > 0 && !seen[f.Name] {
+				seen[f.Name] = true
+				fmt.Fprintf(w, "        '-%v' = %v\n", f.Name, list(f.Values))
+			}
+		}
+	}
+	fmt.Fprintf(w, "    }\n")
+	fmt.Fprintf(w, "    $elements = @($commandAst.CommandElements | ForEach-Object { $_.ToString() })\n")
+	fmt.Fprintf(w, "    if ($wordToComplete -ne '') { $elements = $elements[0..($elements.Count - 2)] }\n")
+	fmt.Fprintf(w, "    $cmd = 'scan'\n")
+	fmt.Fprintf(w, "    if ($elements.Count -gt 1 -and $flags.ContainsKey($elements[1])) { $cmd = $elements[1] }\n")
+	fmt.Fprintf(w, "    $prev = $elements[-1]\n")
+	fmt.Fprintf(w, "    if ($values.ContainsKey($prev)) {\n")
+	fmt.Fprintf(w, "        $candidates = $values[$prev]\n")
+	fmt.Fprintf(w, "    } elseif ($wordToComplete.StartsWith('-')) {\n")
+	fmt.Fprintf(w, "        $candidates = $flags[$cmd]\n")
+	fmt.Fprintf(w, "    } elseif ($elements.Count -eq 1) {\n")
+	fmt.Fprintf(w, "        $candidates = $flags.Keys | Sort-Object\n")
+	fmt.Fprintf(w, "    } elseif ($elements.Count -eq 2 -and $words.ContainsKey($cmd)) {\n")
+	fmt.Fprintf(w, "        $candidates = $words[$cmd]\n")
+	fmt.Fprintf(w, "    } else {\n")
+	fmt.Fprintf(w, "        return\n")
+	fmt.Fprintf(w, "    }\n")
+	fmt.Fprintf(w, "    $candidates | Where-Object { $_ -like \"$wordToComplete*\" } | ForEach-Object {\n")
+	fmt.Fprintf(w, "        [System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_)\n")
+	fmt.Fprintf(w, "    }\n")
+	fmt.Fprintf(w, "}\n")
+}
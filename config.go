@@ -0,0 +1,108 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// envPrefix begins the environment variables that set option defaults, e.g.
+// IPGREP_OUTPUT=json or IPGREP_LOOKUP_TIMEOUT=10s.
+const envPrefix = "IPGREP_"
+
+// userConfig is the parsed config file: option defaults keyed by option
+// name, plus API keys keyed by service.
+type userConfig struct {
+	Options map[string]interface{}
+	APIKeys map[string]string
+}
+
+var (
+	loadConfigOnce sync.Once
+	config         userConfig
+)
+
+// configFile returns the path of the config file: $IPGREP_CONFIG if set, or
+// config.yaml in ipgrep’s configuration directory.
+func configFile() string {
+	if path := os.Getenv(envPrefix + "CONFIG"); path != "" {
+		return path
+	}
+	return configPath("config.yaml")
+}
+
+// loadConfig returns the config file’s settings, reading them the first
+// time it is called and dying if the file exists but is invalid.
+func loadConfig() userConfig {
+	loadConfigOnce.Do(func() {
+		path := configFile()
+		b, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			return
+		}
+		if err != nil {
+			die(err)
+		}
+		var raw map[string]interface{}
+		if err := yaml.Unmarshal(b, &raw); err != nil {
+			die(fmt.Sprintf("%v: %v", path, err))
+		}
+		config.Options = make(map[string]interface{})
+		for k, v := range raw {
+			if k != "api-keys" {
+				config.Options[k] = v
+				continue
+			}
+			keys, ok := v.(map[string]interface{})
+			if !ok {
+				die(fmt.Sprintf("%v: api-keys must map services to keys", path))
+			}
+			config.APIKeys = make(map[string]string)
+			for svc, key := range keys {
+				config.APIKeys[svc] = fmt.Sprint(key)
+			}
+		}
+	})
+	return config
+}
+
+// applyDefaults sets the options of fs from the environment or, failing
+// that, the config file; options given on the command line, parsed
+// afterward, take precedence. Settings for options fs doesn’t have are
+// ignored, since they may belong to other commands.
+func applyDefaults(fs *flag.FlagSet) {
+	cfg := loadConfig()
+	fs.VisitAll(func(f *flag.Flag) {
+		env := envPrefix + strings.ToUpper(strings.Replace(f.Name, "-", "_", -1))
+		source, value := env, os.Getenv(env)
+		if value == "" {
+			v, ok := cfg.Options[f.Name]
+			if !ok {
+				return
+			}
+			source, value = configFile()+": "+f.Name, configValue(v)
+		}
+		if err := fs.Set(f.Name, value); err != nil {
+			die(fmt.Sprintf("%v: %v", source, err))
+		}
+	})
+}
+
+// configValue formats a config file setting as an option value, joining
+// lists with commas, as in -dnsbl.
+func configValue(v interface{}) string {
+	list, ok := v.([]interface{})
+	if !ok {
+		return fmt.Sprint(v)
+	}
+	s := make([]string, len(list))
+	for i, item := range list {
+		s[i] = fmt.Sprint(item)
+	}
+	return strings.Join(s, ",")
+}
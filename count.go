@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/netip"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/princebot/ipgrep/ipgrep"
+)
+
+// bothFlags is a boolean option that sets two others, as -cu sets -count and
+// -unique.
+type bothFlags [2]*bool
+
+func (b bothFlags) String() string {
+	if b[0] == nil {
+		return "false"
+	}
+	return strconv.FormatBool(*b[0] && *b[1])
+}
+
+func (b bothFlags) Set(s string) error {
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	*b[0], *b[1] = v, v
+	return nil
+}
+
+func (b bothFlags) IsBoolFlag() bool { return true }
+
+// listInputs implements -list-files, printing each named file that would be
+// scanned, with its size, without reading it. Any that can’t be — missing,
+// unreadable, or not regular files — are reported with the errors.
+func listInputs(names []string) {
+	type input struct {
+		File string `json:"file"`
+		Size int64  `json:"size"`
+	}
+	var (
+		inputs = make([]input, 0, len(names))
+		failed []*scanResult
+	)
+	for _, name := range names {
+		fi, err := os.Stat(name)
+		switch {
+		case err != nil:
+		case fi.IsDir():
+			err = ipgrep.ErrIsDirectory
+		default:
+			// Opening a file doesn’t read it, but does check permissions.
+			// FIFOs are left alone, as opening one blocks.
+			if fi.Mode().IsRegular() {
+				var fp *os.File
+				if fp, err = os.Open(name); err == nil {
+					fp.Close()
+				}
+			}
+		}
+		if err != nil {
+			if pe, ok := err.(*os.PathError); ok {
+				err = fmt.Errorf("%v: %w", pe.Op, pe.Err)
+			}
+			failed = append(failed, &scanResult{File: name, Err: err})
+			continue
+		}
+		inputs = append(inputs, input{name, fi.Size()})
+	}
+	if *output == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(inputs); err != nil {
+			die(err)
+		}
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		for _, in := range inputs {
+			fmt.Fprintf(w, "%v\t%v\n", byteSize(in.Size), in.File)
+		}
+		w.Flush()
+	}
+	for _, r := range failed {
+		printError(r)
+	}
+}
+
+// printFileNames implements -files-with-matches and -files-without-match: the
+// name of each file that has results, if matched is true, or that has none
+// otherwise.
+func printFileNames(results []*scanResult, matched bool) {
+	names := make([]string, 0, len(results))
+	for _, r := range results {
+		if (len(r.IPs) > 0) == matched {
+			names = append(names, r.File)
+		}
+	}
+	if *output == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(names); err != nil {
+			die(err)
+		}
+		return
+	}
+	for _, name := range names {
+		fmt.Println(name)
+	}
+}
+
+// distinct implements -unique, keeping only the first appearance of each IP
+// in each file, along with where it was found and the time found with it.
+func distinct(results []*scanResult) []*scanResult {
+	out := make([]*scanResult, len(results))
+	for i, r := range results {
+		if r.Spilled != nil {
+			out[i] = r // only distinct IPs were kept.
+			continue
+		}
+		d := &scanResult{File: r.File, Group: r.Group, Source: r.Source, Err: r.Err, Printed: r.Printed}
+		seen := make(map[netip.Addr]bool, len(r.IPs))
+		for j, ip := range r.IPs {
+			if seen[ip] {
+				continue
+			}
+			seen[ip] = true
+			d.IPs = append(d.IPs, ip)
+			if r.Times != nil {
+				d.Times = append(d.Times, r.Times[j])
+			}
+			if r.Matches != nil {
+				d.Matches = append(d.Matches, r.Matches[j])
+			}
+		}
+		out[i] = d
+	}
+	return out
+}
+
+// printCounts implements -count: the number of results in each file, or
+// just the number if there is only one file, as with grep -c.
+func printCounts(results []*scanResult) {
+	if maxMemory > 0 {
+		countSpilled(results)
+	}
+	if *output == "json" {
+		type fileCount struct {
+			File  string `json:"file"`
+			Count int    `json:"count"`
+		}
+		out := make([]fileCount, 0, len(results))
+		for _, r := range results {
+			out = append(out, fileCount{r.File, numIPs(r)})
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(out); err != nil {
+			die(err)
+		}
+		return
+	}
+	if flag.NArg() == 1 && len(results) == 1 {
+		fmt.Println(numIPs(results[0]))
+		return
+	}
+	for _, r := range results {
+		fmt.Printf("%v:%d\n", r.File, numIPs(r))
+	}
+}
+
+// numIPs returns how many IPs r holds, or with -max-memory how many distinct
+// ones it found.
+func numIPs(r *scanResult) int {
+	if r.Spilled == nil {
+		return len(r.IPs)
+	}
+	return r.Spilled.distinct
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/princebot/ipgrep/ipgrep"
+)
+
+func TestDistinct(t *testing.T) {
+	var (
+		a, b, c = netip.MustParseAddr("10.0.0.1"), netip.MustParseAddr("10.0.0.2"), netip.MustParseAddr("2001:db8::1")
+		t1, t2  = time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC), time.Date(2024, 3, 1, 11, 0, 0, 0, time.UTC)
+		lines   = map[int][]byte{1: []byte("10.0.0.1 10.0.0.2")}
+	)
+	tests := []struct {
+		name string
+		in   scanResult
+		want scanResult
+	}{
+		{
+			name: "empty",
+			in:   scanResult{File: "a.log"},
+			want: scanResult{File: "a.log"},
+		},
+		{
+			name: "repeats",
+			in:   scanResult{File: "a.log", IPs: []netip.Addr{a, b, a, c, b}},
+			want: scanResult{File: "a.log", IPs: []netip.Addr{a, b, c}},
+		},
+		{
+			name: "times and matches",
+			in: scanResult{
+				File:    "a.log",
+				IPs:     []netip.Addr{a, a, b},
+				Times:   []time.Time{t1, t2, {}},
+				Matches: []ipgrep.Match{{IP: a, Line: 1}, {IP: a, Line: 2}, {IP: b, Line: 3}},
+			},
+			want: scanResult{
+				File:    "a.log",
+				IPs:     []netip.Addr{a, b},
+				Times:   []time.Time{t1, {}},
+				Matches: []ipgrep.Match{{IP: a, Line: 1}, {IP: b, Line: 3}},
+			},
+		},
+		{
+			name: "what goes with the result",
+			in:   scanResult{File: "a.log", Group: "IPv4", Source: lines, Printed: 2, IPs: []netip.Addr{b, b}},
+			want: scanResult{File: "a.log", Group: "IPv4", Source: lines, Printed: 2, IPs: []netip.Addr{b}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := distinct([]*scanResult{&tt.in})
+			if len(got) != 1 || !reflect.DeepEqual(*got[0], tt.want) {
+				t.Errorf("distinct(%+v) = %+v, want %+v", tt.in, *got[0], tt.want)
+			}
+		})
+	}
+}
+
+func TestDistinctPerFile(t *testing.T) {
+	a := netip.MustParseAddr("192.0.2.1")
+	got := distinct([]*scanResult{
+		{File: "a.log", IPs: []netip.Addr{a, a}},
+		{File: "b.log", IPs: []netip.Addr{a}},
+	})
+	for i, r := range got {
+		if len(r.IPs) != 1 {
+			t.Errorf("result %d has IPs %v, want [%v]", i, r.IPs, a)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/netip"
+)
+
+// cryptoPAn pseudonymizes IPs with Crypto-PAn (Xu et al., “Prefix-Preserving
+// IP Address Anonymization”, 2002): two addresses sharing an n-bit prefix
+// map to two addresses sharing an n-bit prefix, and the same key always
+// gives the same mapping. IPv6 addresses are handled by the same
+// construction over 128 bits.
+type cryptoPAn struct {
+	block cipher.Block
+	pad   [aes.BlockSize]byte
+	cache map[netip.Addr]netip.Addr
+}
+
+// newCryptoPAn returns a Crypto-PAn anonymizer for key, which is either 64
+// hex digits — the 32-byte key of the reference implementation — or a
+// passphrase from which such a key is derived.
+func newCryptoPAn(key string) (*cryptoPAn, error) {
+	if key == "" {
+		return nil, errors.New("-anonymize cryptopan requires -key")
+	}
+	k, err := hex.DecodeString(key)
+	if err != nil || len(k) != 32 {
+		sum := sha256.Sum256([]byte(key))
+		k = sum[:]
+	}
+	block, err := aes.NewCipher(k[:16])
+	if err != nil {
+		return nil, err
+	}
+	c := &cryptoPAn{block: block, cache: make(map[netip.Addr]netip.Addr)}
+	block.Encrypt(c.pad[:], k[16:])
+	return c, nil
+}
+
+// anonymize returns the pseudonym for ip.
+func (c *cryptoPAn) anonymize(ip netip.Addr) netip.Addr {
+	if out, ok := c.cache[ip]; ok {
+		return out
+	}
+	var (
+		addr    = ip.AsSlice()
+		out     = make([]byte, len(addr))
+		in, enc [aes.BlockSize]byte
+	)
+	// Bit i of the result flips bit i of the address according to the
+	// first bit of the encrypted block holding the address’s first i bits
+	// followed by the pad.
+	for i := 0; i < len(addr)*8; i++ {
+		copy(in[:], c.pad[:])
+		n := i / 8
+		copy(in[:n], addr[:n])
+		if r := uint(i % 8); r > 0 {
+			mask := byte(0xff << (8 - r))
+			in[n] = addr[n]&mask | c.pad[n]&^mask
+		}
+		c.block.Encrypt(enc[:], in[:])
+		if enc[0]&0x80 != 0 {
+			out[n] |= 0x80 >> uint(i%8)
+		}
+	}
+	for i := range out {
+		out[i] ^= addr[i]
+	}
+	anon, _ := netip.AddrFromSlice(out)
+	c.cache[ip] = anon
+	return anon
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/netip"
+	"os"
+
+	"github.com/princebot/ipgrep/ipgrep"
+)
+
+const diffUsage = `
+usage: %[1]v diff [-output FORMAT] A B
+
+Compares the unique IPs in files A and B, printing those only in A, those only
+in B, and those in both, each in order of first appearance. Either file may
+be a log, an allowlist, or the saved output of an earlier %[1]v run.
+
+	-output FORMAT    print the comparison as text (the default) or json
+`
+
+// ipDiff is the result of comparing two sets of IPs.
+type ipDiff struct {
+	OnlyA []string `json:"only_a"`
+	OnlyB []string `json:"only_b"`
+	Both  []string `json:"both"`
+}
+
+// diffFlags holds the options of “ipgrep diff”.
+var diffFlags = flag.NewFlagSet("diff", flag.ExitOnError)
+
+func init() {
+	diffFlags.StringVar(output, "output", "text", "output format: text or json")
+	diffFlags.Usage = func() { fmt.Fprintf(os.Stderr, diffUsage, prog) }
+}
+
+// diffCommand implements “ipgrep diff”.
+func diffCommand(args []string) {
+	fs := diffFlags
+	parseArgs(fs, args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if *output != "text" && *output != "json" {
+		die(fmt.Sprintf("unknown output format %q", *output))
+	}
+	a, b := scanFile(fs.Arg(0)), scanFile(fs.Arg(1))
+	printDiff(fs.Arg(0), fs.Arg(1), diffIPs(a, b))
+}
+
+// scanFile returns the unique IPs in the named file, dying if it can’t be
+// read. An empty file is not an error here: it is just an empty set.
+func scanFile(name string) []netip.Addr {
+	fp, err := os.Open(name)
+	if err != nil {
+		die(err)
+	}
+	defer fp.Close()
+	r := scan(context.Background(), name, fp, nil)
+	if r.Err != nil && !errors.Is(r.Err, ipgrep.ErrEmptyInput) {
+		die(r)
+	}
+	return unique([]*scanResult{r})
+}
+
+// diffIPs compares a and b, which must each be free of duplicates.
+func diffIPs(a, b []netip.Addr) ipDiff {
+	var (
+		d   = ipDiff{OnlyA: []string{}, OnlyB: []string{}, Both: []string{}}
+		inA = make(map[netip.Addr]bool, len(a))
+		inB = make(map[netip.Addr]bool, len(b))
+	)
+	for _, ip := range a {
+		inA[ip] = true
+	}
+	for _, ip := range b {
+		inB[ip] = true
+	}
+	for _, ip := range a {
+		if inB[ip] {
+			d.Both = append(d.Both, ip.String())
+		} else {
+			d.OnlyA = append(d.OnlyA, ip.String())
+		}
+	}
+	for _, ip := range b {
+		if !inA[ip] {
+			d.OnlyB = append(d.OnlyB, ip.String())
+		}
+	}
+	return d
+}
+
+// printDiff prints d in the -output format.
+func printDiff(nameA, nameB string, d ipDiff) {
+	if *output == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(d); err != nil {
+			die(err)
+		}
+		return
+	}
+	for _, sec := range []struct {
+		title string
+		ips   []string
+	}{
+		{"only in " + nameA, d.OnlyA},
+		{"only in " + nameB, d.OnlyB},
+		{"in both", d.Both},
+	} {
+		fmt.Printf("# %v:\n", sec.title)
+		for _, ip := range sec.ips {
+			fmt.Println(ip)
+		}
+		fmt.Println()
+	}
+}
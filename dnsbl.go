@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+// dnsblResult records whether one DNS blocklist zone lists an IP.
+type dnsblResult struct {
+	Zone   string `json:"zone"`
+	Listed bool   `json:"listed"`
+	Code   string `json:"code,omitempty"`  // the 127.0.0.x answer, if listed.
+	Error  string `json:"error,omitempty"` // set if the zone could not be queried.
+}
+
+// lookupDNSBL queries each zone for ip, which must be an IPv4 address. By
+// convention, a zone lists 1.2.3.4 by answering A queries for
+// 4.3.2.1.<zone>, with the answer encoding the reason, and returns NXDOMAIN
+// otherwise.
+func lookupDNSBL(ip netip.Addr, zones []string, timeout time.Duration) []dnsblResult {
+	results := make([]dnsblResult, 0, len(zones))
+	for _, zone := range zones {
+		r := dnsblResult{Zone: zone}
+		name := reverseName(ip) + "." + zone
+		b, err := cached("dnsbl", name, func() ([]byte, error) {
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			addrs, err := net.DefaultResolver.LookupHost(ctx, name)
+			if err != nil {
+				return nil, dnsError(err)
+			}
+			if len(addrs) == 0 {
+				return nil, errNotFound
+			}
+			return []byte(addrs[0]), nil
+		})
+		switch {
+		case err != nil:
+			r.Error = err.Error()
+		case len(b) > 0:
+			r.Listed, r.Code = true, string(b)
+		}
+		results = append(results, r)
+	}
+	return results
+}
+
+// dnsblZones splits the comma-separated -dnsbl value into zone names.
+func dnsblZones(s string) []string {
+	var zones []string
+	for _, z := range strings.Split(s, ",") {
+		if z = strings.Trim(strings.TrimSpace(z), "."); z != "" {
+			zones = append(zones, z)
+		}
+	}
+	return zones
+}
+
+// publicIPv4 reports whether ip is a globally routable IPv4 address, the only
+// kind DNS blocklists track.
+func publicIPv4(ip netip.Addr) bool {
+	return ip.Is4() && classify(ip) == classPublic
+}
+
+// dnsblColumn summarizes results as a comma-separated list of the zones that
+// list the IP, each followed by its answer, e.g.
+// "zen.spamhaus.org(127.0.0.2)". A zone that couldn’t be queried shows "?".
+func dnsblColumn(results []dnsblResult) string {
+	var listed []string
+	for _, r := range results {
+		switch {
+		case r.Listed:
+			listed = append(listed, fmt.Sprintf("%v(%v)", r.Zone, r.Code))
+		case r.Error != "":
+			listed = append(listed, fmt.Sprintf("%v(?)", r.Zone))
+		}
+	}
+	return orMissing(strings.Join(listed, ","))
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+)
+
+// missing is printed in place of any field a lookup could not fill in.
+const missing = "-"
+
+// enrichment collects what the optional lookups learned about a single IP.
+// Only the fields for lookups enabled on the command line are populated.
+type enrichment struct {
+	PTR       string         `json:"ptr,omitempty"`    // first PTR hostname.
+	Confirmed *bool          `json:"fcrdns,omitempty"` // set if -fcrdns was given.
+	ASN       *asnInfo       `json:"asn,omitempty"`
+	RDAP      *rdapInfo      `json:"rdap,omitempty"`
+	Feeds     []string       `json:"feeds,omitempty"` // names of feeds listing the IP.
+	Watchlist bool           `json:"watchlist,omitempty"`
+	DNSBL     []dnsblResult  `json:"dnsbl,omitempty"`
+	Shodan    *shodanInfo    `json:"shodan,omitempty"`
+	AbuseIPDB *abuseInfo     `json:"abuseipdb,omitempty"`
+	VT        *vtInfo        `json:"virustotal,omitempty"`
+	GreyNoise *greyNoiseInfo `json:"greynoise,omitempty"`
+	Alive     *bool          `json:"alive,omitempty"`   // set if -probe was given.
+	Country   string         `json:"country,omitempty"` // per a GeoIP database.
+	// Plugins holds the fields from each -enrich-plugin, by its name.
+	Plugins map[string]map[string]string `json:"plugins,omitempty"`
+}
+
+// enricher holds what lookups share across a run: API keys, rate limits, and
+// loaded feeds.
+type enricher struct {
+	shodanKey, abuseKey, vtKey, greyNoiseKey string
+	feeds                                    *feedSet // nil unless checking feeds.
+	geo                                      *geoDB   // nil unless -by-country has one.
+	probe                                    func(netip.Addr, time.Duration) bool
+}
+
+// newEnricher prepares every lookup requested on the command line, dying if
+// one can’t be used (e.g. for want of an API key). It returns nil if no
+// lookups were requested.
+func newEnricher() *enricher {
+	if !enriching() {
+		return nil
+	}
+	if *offline && (*probe != "" || len(enrichPlugins) > 0) {
+		die("-probe and -enrich-plugin can’t be used with -offline, which never touches the network")
+	}
+	en := new(enricher)
+	if *shodan {
+		en.shodanKey = mustAPIKey("-shodan", "SHODAN_API_KEY", "shodan.key")
+	}
+	if *abuseIPDB {
+		en.abuseKey = mustAPIKey("-abuseipdb", "ABUSEIPDB_API_KEY", "abuseipdb.key")
+	}
+	if *virusTotal {
+		en.vtKey = mustAPIKey("-virustotal", "VT_API_KEY", "virustotal.key")
+		if *vtPerMinute < 1 {
+			die("-vt-rate must be at least 1")
+		}
+		vtRate = &throttle{interval: time.Minute / time.Duration(*vtPerMinute)}
+	}
+	if *greyNoise {
+		// The community API works without a key, just more slowly.
+		en.greyNoiseKey, _ = apiKey("GREYNOISE_API_KEY", "greynoise.key")
+	}
+	if *probe != "" {
+		var err error
+		if en.probe, err = parseProbe(*probe); err != nil {
+			die(err)
+		}
+	}
+	if checkingFeeds() {
+		var err error
+		if en.feeds, err = loadFeedSet(selectedFeeds(), *lookupTimeout); err != nil {
+			die(err)
+		}
+	}
+	if *byCountry {
+		en.geo = loadGeoDB()
+	}
+	for _, command := range enrichPlugins {
+		p, err := startEnrichPlugin(command, *lookupTimeout)
+		if err != nil {
+			die(err)
+		}
+		plugins = append(plugins, p)
+	}
+	return en
+}
+
+// enrichAll runs every enabled lookup against ips, at most -lookup-jobs at a
+// time, and returns the results keyed by IP. It returns nil if en is nil.
+func (en *enricher) enrichAll(ips []netip.Addr) map[netip.Addr]*enrichment {
+	if en == nil {
+		return nil
+	}
+	var (
+		ann = make(map[netip.Addr]*enrichment, len(ips))
+		mu  sync.Mutex
+	)
+	forEachIP(ips, *lookupJobs, func(ip netip.Addr) {
+		e := en.enrich(ip)
+		mu.Lock()
+		ann[ip] = e
+		mu.Unlock()
+	})
+	return ann
+}
+
+// enrich runs every enabled lookup against ip. It returns nil if en is nil.
+func (en *enricher) enrich(ip netip.Addr) *enrichment {
+	if en == nil {
+		return nil
+	}
+	e := new(enrichment)
+	if watched != nil {
+		e.Watchlist = watched.contains(ip)
+	}
+	if en.feeds != nil {
+		e.Feeds = en.feeds.listedBy(ip)
+	}
+	if *rdns || *fcrdns {
+		e.PTR = lookupPTR(ip, *lookupTimeout)
+	}
+	if *fcrdns {
+		ok := e.PTR != "" && confirmPTR(ip, e.PTR, *lookupTimeout)
+		e.Confirmed = &ok
+	}
+	if en.geo != nil {
+		e.Country = en.geo.country(ip)
+	}
+	if *asnLookup || *byCountry && en.geo == nil || *byASN {
+		e.ASN = lookupASN(ip, *lookupTimeout)
+	}
+	if *rdapLookup {
+		e.RDAP = lookupRDAP(ip, *lookupTimeout)
+	}
+	if zones := dnsblZones(*dnsbl); len(zones) > 0 && publicIPv4(ip) {
+		e.DNSBL = lookupDNSBL(ip, zones, *lookupTimeout)
+	}
+	public := classify(ip) == classPublic
+	if *shodan && public {
+		e.Shodan = lookupShodan(ip.String(), en.shodanKey, *lookupTimeout)
+	}
+	if *abuseIPDB && public {
+		e.AbuseIPDB = lookupAbuseIPDB(ip.String(), en.abuseKey, *lookupTimeout)
+	}
+	if *virusTotal && public {
+		e.VT = lookupVirusTotal(ip.String(), en.vtKey, *lookupTimeout)
+	}
+	if *greyNoise && public {
+		e.GreyNoise = lookupGreyNoise(ip.String(), en.greyNoiseKey, *lookupTimeout)
+	}
+	if en.probe != nil {
+		alive := en.probe(ip, *lookupTimeout)
+		e.Alive = &alive
+	}
+	for _, p := range plugins {
+		if e.Plugins == nil {
+			e.Plugins = make(map[string]map[string]string, len(plugins))
+		}
+		e.Plugins[p.Name] = p.lookup(ip, *lookupTimeout)
+	}
+	return e
+}
+
+// wanted reports whether an IP annotated with e passes the -only-listed,
+// -min-abuse-score, and -suppress-noise filters.
+func wanted(e *enrichment) bool {
+	if e == nil {
+		return true
+	}
+	if *onlyListed && len(e.Feeds) == 0 {
+		return false
+	}
+	if *minAbuseScore > 0 && (e.AbuseIPDB == nil || e.AbuseIPDB.Score < *minAbuseScore) {
+		return false
+	}
+	if *suppressNoise && e.GreyNoise != nil && e.GreyNoise.Noise {
+		return false
+	}
+	return true
+}
+
+// enriching reports whether any lookup was requested on the command line.
+func enriching() bool {
+	return *rdns || *fcrdns || *asnLookup || *byCountry || *byASN || *rdapLookup || checkingFeeds() ||
+		watched != nil || *dnsbl != "" || *shodan || *abuseIPDB ||
+		*virusTotal || *greyNoise || *probe != "" || len(enrichPlugins) > 0
+}
+
+// checkingFeeds reports whether results are to be checked against any feed.
+func checkingFeeds() bool {
+	return *checkBanlist || *checkFeeds
+}
+
+// selectedFeeds returns the feeds named by -check-banlist and -check-feeds,
+// but for GeoIP databases, which list no threats.
+func selectedFeeds() []feed {
+	var (
+		feeds []feed
+		err   error
+	)
+	switch {
+	case *checkFeeds && *checkBanlist:
+		feeds, err = allFeeds(*feedsConfig)
+	case *checkFeeds:
+		feeds, err = loadFeedConfig(*feedsConfig)
+	default:
+		feeds = []feed{banlist}
+	}
+	if err != nil {
+		die(err)
+	}
+	threats := feeds[:0]
+	for _, f := range feeds {
+		if f.Format != geoFormat {
+			threats = append(threats, f)
+		}
+	}
+	return threats
+}
+
+// column is a field of text output: a value and the header it appears under.
+type column struct {
+	header, value string
+}
+
+// columns returns the text-mode fields printed after the IP.
+func (e *enrichment) columns() []column {
+	var cols []column
+	if *rdns || *fcrdns {
+		cols = append(cols, column{"PTR", orMissing(e.PTR)})
+	}
+	if *fcrdns {
+		v := "mismatch"
+		switch {
+		case e.PTR == "":
+			v = missing
+		case *e.Confirmed:
+			v = "confirmed"
+		}
+		cols = append(cols, column{"FCRDNS", v})
+	}
+	if *asnLookup {
+		cols = append(cols, e.ASN.columns()...)
+	}
+	if *rdapLookup {
+		cols = append(cols, e.RDAP.columns()...)
+	}
+	if checkingFeeds() {
+		cols = append(cols, column{"FEEDS", orMissing(strings.Join(e.Feeds, ","))})
+	}
+	if watched != nil {
+		cols = append(cols, column{"WATCHLIST", mark(e.Watchlist, "HIT")})
+	}
+	if *dnsbl != "" {
+		cols = append(cols, column{"DNSBL", dnsblColumn(e.DNSBL)})
+	}
+	if *shodan {
+		cols = append(cols, e.Shodan.columns()...)
+	}
+	if *abuseIPDB {
+		cols = append(cols, e.AbuseIPDB.columns()...)
+	}
+	if *virusTotal {
+		cols = append(cols, e.VT.columns()...)
+	}
+	if *greyNoise {
+		cols = append(cols, column{"GREYNOISE", e.GreyNoise.label()})
+	}
+	if *probe != "" {
+		v := "dead"
+		if *e.Alive {
+			v = "alive"
+		}
+		cols = append(cols, column{"PROBE", v})
+	}
+	for _, p := range plugins {
+		cols = append(cols, p.columns(e.Plugins[p.Name])...)
+	}
+	return cols
+}
+
+// mustAPIKey returns the API key needed by option, or dies if there is none.
+func mustAPIKey(option, env, name string) string {
+	key, err := apiKey(env, name)
+	if err != nil {
+		die(fmt.Sprintf("%v: %v", option, err))
+	}
+	return key
+}
+
+// orMissing returns s, or missing if s is empty.
+func orMissing(s string) string {
+	if s == "" {
+		return missing
+	}
+	return s
+}
+
+// mark returns label if set is true, or missing otherwise.
+func mark(set bool, label string) string {
+	if set {
+		return label
+	}
+	return missing
+}
+
+// forEachIP calls fn once for each IP, using at most jobs goroutines, and
+// returns when every call has finished.
+func forEachIP(ips []netip.Addr, jobs int, fn func(netip.Addr)) {
+	var (
+		queue = make(chan netip.Addr)
+		wg    sync.WaitGroup
+	)
+	for i := 0; i < jobs && i < len(ips); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ip := range queue {
+				fn(ip)
+			}
+		}()
+	}
+	for _, ip := range ips {
+		queue <- ip
+	}
+	close(queue)
+	wg.Wait()
+}
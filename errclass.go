@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/princebot/ipgrep/ipgrep"
+)
+
+// timeoutError is the cause of a scan given up on for taking longer than
+// the limit set by -timeout or -file-timeout.
+type timeoutError struct {
+	option string
+	limit  time.Duration
+}
+
+func (e *timeoutError) Error() string {
+	return fmt.Sprintf("not finished within %v %v", e.option, e.limit)
+}
+
+// jsonError is the shape of an error printed with -output json: the file it
+// concerns, if any, a class for programs to act on, and a message for people.
+type jsonError struct {
+	File    string `json:"file,omitempty"`
+	Class   string `json:"class"`
+	Message string `json:"error"`
+}
+
+// errorClass sorts err into one of a few classes for -output json:
+// not-found, permission, is-directory, empty, timeout, interrupted, io for
+// any other error reading a file, and error for anything else.
+func errorClass(err error, file bool) string {
+	var te *timeoutError
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return "not-found"
+	case errors.Is(err, fs.ErrPermission):
+		return "permission"
+	case errors.Is(err, ipgrep.ErrIsDirectory), errors.Is(err, syscall.EISDIR):
+		return "is-directory"
+	case errors.Is(err, ipgrep.ErrEmptyInput):
+		return "empty"
+	case errors.As(err, &te), errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, errInterrupted):
+		return "interrupted"
+	case file:
+		return "io"
+	}
+	return "error"
+}
+
+// failureStatus returns the exit status for the files that failed to scan,
+// by the worst class of error among them: exitTimedOut if any timed out,
+// exitUnreadable if any couldn’t be opened or read, or was empty, as is
+// reported with the rest, and otherwise 0.
+func failureStatus(failed []*scanResult) int {
+	status := 0
+	for _, r := range failed {
+		switch errorClass(r.Err, true) {
+		case "timeout":
+			return exitTimedOut
+		case "not-found", "permission", "is-directory", "empty", "io":
+			status = exitUnreadable
+		}
+	}
+	return status
+}
+
+// printJSONError prints errMsg, as printError would, as a JSON object on a
+// line of its own.
+func printJSONError(errMsg interface{}) {
+	var je jsonError
+	switch e := errMsg.(type) {
+	case *scanResult:
+		je = jsonError{File: e.File, Class: errorClass(e.Err, true), Message: e.Err.Error()}
+	case error:
+		var pe *fs.PathError
+		if errors.As(e, &pe) {
+			je.File = pe.Path
+		}
+		je.Class, je.Message = errorClass(e, je.File != ""), e.Error()
+	default:
+		je = jsonError{Class: "error", Message: fmt.Sprint(errMsg)}
+	}
+	json.NewEncoder(os.Stderr).Encode(je)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"testing"
+	"time"
+
+	"github.com/princebot/ipgrep/ipgrep"
+)
+
+func TestFailureStatus(t *testing.T) {
+	var (
+		notFound = fmt.Errorf("open: %w", fs.ErrNotExist)
+		timedOut = &timeoutError{"-timeout", time.Second}
+	)
+	tests := []struct {
+		name string
+		errs []error
+		want int
+	}{
+		{"none", nil, 0},
+		{"not found", []error{notFound}, exitUnreadable},
+		{"permission", []error{fs.ErrPermission}, exitUnreadable},
+		{"directory", []error{ipgrep.ErrIsDirectory}, exitUnreadable},
+		{"empty", []error{ipgrep.ErrEmptyInput}, exitUnreadable},
+		{"i/o", []error{errors.New("read: input/output error")}, exitUnreadable},
+		{"timed out", []error{timedOut}, exitTimedOut},
+		{"deadline", []error{context.DeadlineExceeded}, exitTimedOut},
+		{"timed out among others", []error{notFound, timedOut, ipgrep.ErrEmptyInput}, exitTimedOut},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var failed []*scanResult
+			for _, err := range tt.errs {
+				failed = append(failed, &scanResult{File: "x.log", Err: err})
+			}
+			if got := failureStatus(failed); got != tt.want {
+				t.Errorf("failureStatus(%v) = %d, want %d", tt.errs, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/princebot/ipgrep/ipgrep"
+)
+
+// banlistURL is Binary Defense’s artillery threat-intelligence feed: a plain
+// list of IPs observed attacking their honeypots, refreshed several times a
+// day.
+const banlistURL = "https://www.binarydefense.com/banlist.txt"
+
+// banlist is the built-in feed checked by -check-banlist, and the only feed
+// checked by -check-feeds when no feeds config file exists.
+var banlist = feed{Name: "binarydefense", URL: banlistURL, Format: "plain"}
+
+// feed describes a threat-intelligence source as listed in the feeds config
+// file, a JSON array of these objects:
+//
+//	[
+//	  {"name": "binarydefense", "url": "https://www.binarydefense.com/banlist.txt"},
+//	  {"name": "c2", "url": "https://example.com/c2.csv", "format": "csv", "column": 1},
+//	  {"name": "taxii", "url": "https://example.com/bundle.json", "format": "stix"},
+//	  {"name": "dbip", "url": "https://example.com/dbip-country-lite.csv.gz", "format": "geoip"}
+//	]
+//
+// A feed of format geoip is a GeoIP database, for -by-country, rather than
+// a list of threats.
+type feed struct {
+	Name   string `json:"name"`             // label used to annotate matches.
+	URL    string `json:"url"`              // where to download the feed.
+	Format string `json:"format,omitempty"` // plain (the default), csv, stix, or geoip.
+	Column int    `json:"column,omitempty"` // for csv, the zero-based IP column.
+}
+
+// feedList is a feed together with the addresses it lists.
+type feedList struct {
+	feed
+	set *ipSet
+}
+
+// loadFeedConfig reads the feeds config file at path. A missing file yields
+// just the built-in banlist.
+func loadFeedConfig(path string) ([]feed, error) {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return []feed{banlist}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var feeds []feed
+	if err := json.Unmarshal(b, &feeds); err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+	for _, f := range feeds {
+		if f.Name == "" || f.URL == "" {
+			return nil, fmt.Errorf("%v: every feed needs a name and a url", path)
+		}
+		if strings.ContainsAny(f.Name, `/\`) {
+			return nil, fmt.Errorf("%v: feed name %q contains a path separator", path, f.Name)
+		}
+		if _, ok := feedParsers[f.Format]; !ok && f.Format != geoFormat {
+			return nil, fmt.Errorf("%v: feed %v: unknown format %q", path, f.Name, f.Format)
+		}
+	}
+	return feeds, nil
+}
+
+// allFeeds returns every feed in the config file at path, plus the built-in
+// banlist if the config doesn’t already include it.
+func allFeeds(path string) ([]feed, error) {
+	feeds, err := loadFeedConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range feeds {
+		if f.URL == banlist.URL {
+			return feeds, nil
+		}
+	}
+	return append(feeds, banlist), nil
+}
+
+// feedSet is the loaded contents of a group of feeds. It is safe for
+// concurrent use, including while being refreshed.
+type feedSet struct {
+	feeds []feed
+	mu    sync.RWMutex
+	lists []feedList
+}
+
+// loadFeedSet fetches and parses each feed. Any failure is fatal, since
+// silently checking against fewer feeds than configured would be misleading.
+func loadFeedSet(feeds []feed, timeout time.Duration) (*feedSet, error) {
+	s := &feedSet{feeds: feeds}
+	for _, f := range feeds {
+		b, err := fetchFeed(f.Name, f.URL, timeout)
+		if err != nil {
+			return nil, err
+		}
+		set, err := feedParsers[f.Format](f, b)
+		if err != nil {
+			return nil, fmt.Errorf("feed %v: %v", f.Name, err)
+		}
+		s.lists = append(s.lists, feedList{f, set})
+	}
+	return s, nil
+}
+
+// listedBy returns the names of the feeds that list ip.
+func (s *feedSet) listedBy(ip netip.Addr) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var names []string
+	for _, l := range s.lists {
+		if l.set.contains(ip) {
+			names = append(names, l.Name)
+		}
+	}
+	return names
+}
+
+// refresh downloads each feed afresh and swaps in the new contents. A feed
+// that fails to download or parse keeps its previous contents, and the first
+// such failure is returned. With -offline, nothing is downloaded.
+func (s *feedSet) refresh(timeout time.Duration) error {
+	if *offline {
+		return errors.New("feeds not refreshed: running offline")
+	}
+	var first error
+	for i, f := range s.feeds {
+		b, err := download(f.URL, timeout)
+		var set *ipSet
+		if err == nil {
+			set, err = feedParsers[f.Format](f, b)
+		}
+		if err != nil {
+			if first == nil {
+				first = fmt.Errorf("feed %v: %v", f.Name, err)
+			}
+			continue
+		}
+		storeFeed(f.Name, b)
+		s.mu.Lock()
+		s.lists[i].set = set
+		s.mu.Unlock()
+	}
+	return first
+}
+
+// refreshEvery calls refresh once per interval, forever, reporting failures
+// on stderr. Long-running modes run it in the background so they don’t keep
+// matching against a snapshot that grows stale.
+func (s *feedSet) refreshEvery(interval, timeout time.Duration) {
+	for range time.Tick(interval) {
+		if err := s.refresh(timeout); err != nil {
+			printError(err)
+		}
+	}
+}
+
+// feedParsers maps each feed format to its parser.
+var feedParsers = map[string]func(f feed, b []byte) (*ipSet, error){
+	"":      parsePlainFeed,
+	"plain": parsePlainFeed,
+	"csv":   parseCSVFeed,
+	"stix":  parseSTIXFeed,
+}
+
+func parsePlainFeed(_ feed, b []byte) (*ipSet, error) {
+	return parseIPList(bytes.NewReader(b))
+}
+
+// parseCSVFeed takes IPs or CIDRs from column f.Column of each record. Header
+// rows and other cells that aren’t addresses are skipped.
+func parseCSVFeed(f feed, b []byte) (*ipSet, error) {
+	s := newIPSet()
+	r := csv.NewReader(bytes.NewReader(b))
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			return s, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if f.Column < len(rec) {
+			s.add(strings.TrimSpace(rec[f.Column]))
+		}
+	}
+}
+
+// stixValue matches the comparison expressions STIX 2 indicator patterns use
+// for addresses, e.g. [ipv4-addr:value = '198.51.100.0/24'].
+var stixValue = regexp.MustCompile(`ipv[46]-addr:value\s*=\s*'([^']+)'`)
+
+// parseSTIXFeed reads a STIX 2 bundle, collecting addresses from indicator
+// patterns as well as from standalone ipv4-addr and ipv6-addr objects.
+func parseSTIXFeed(_ feed, b []byte) (*ipSet, error) {
+	var bundle struct {
+		Objects []struct {
+			Type    string `json:"type"`
+			Pattern string `json:"pattern"`
+			Value   string `json:"value"`
+		} `json:"objects"`
+	}
+	if err := json.Unmarshal(b, &bundle); err != nil {
+		return nil, err
+	}
+	s := newIPSet()
+	for _, o := range bundle.Objects {
+		switch o.Type {
+		case "indicator":
+			for _, m := range stixValue.FindAllStringSubmatch(o.Pattern, -1) {
+				s.add(m[1])
+			}
+		case "ipv4-addr", "ipv6-addr":
+			s.add(o.Value)
+		}
+	}
+	return s, nil
+}
+
+// ipSet is a set of individual IPs plus CIDR blocks.
+type ipSet struct {
+	ips  map[netip.Addr]bool
+	nets []netip.Prefix
+}
+
+func newIPSet() *ipSet {
+	return &ipSet{ips: make(map[netip.Addr]bool)}
+}
+
+// contains reports whether ip is in s, either directly or inside a block.
+func (s *ipSet) contains(ip netip.Addr) bool {
+	if s.ips[ip] {
+		return true
+	}
+	for _, n := range s.nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseIPList reads one IP or CIDR per line from r. Blank lines, comments
+// starting with '#', and lines that are neither are ignored, however long.
+func parseIPList(r io.Reader) (*ipSet, error) {
+	var (
+		s  = newIPSet()
+		br = bufio.NewReader(r)
+	)
+	for {
+		b, err := br.ReadSlice('\n')
+		line := string(b)
+		if err == bufio.ErrBufferFull {
+			// Only a comment can make an entry this long; skip the rest.
+			if !strings.Contains(line, "#") {
+				line = ""
+			}
+			for err == bufio.ErrBufferFull {
+				_, err = br.ReadSlice('\n')
+			}
+		}
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		s.add(strings.TrimSpace(line))
+		switch err {
+		case nil:
+		case io.EOF:
+			return s, nil
+		default:
+			return s, err
+		}
+	}
+}
+
+// add inserts word into s if it is a valid IP or CIDR block and reports
+// whether it was.
+func (s *ipSet) add(word string) bool {
+	if ip, ok := ipgrep.ParseIP([]byte(word)); ok {
+		s.ips[ip] = true
+		return true
+	}
+	if n, err := netip.ParsePrefix(word); err == nil {
+		s.nets = append(s.nets, n.Masked())
+		return true
+	}
+	return false
+}
+
+// fetchFeed returns the body of the feed at url, downloading it only if the
+// copy stored under name is older than the feeds TTL. If the download fails,
+// a stale copy is used rather than none at all. With -offline, the stored
+// copy is used however old it is.
+func fetchFeed(name, url string, timeout time.Duration) ([]byte, error) {
+	path := feedCachePath(name)
+	fi, err := os.Stat(path)
+	if err == nil && (*offline || time.Since(fi.ModTime()) < cacheTTLs["feeds"]) {
+		return ioutil.ReadFile(path)
+	}
+	if *offline {
+		return nil, fmt.Errorf("feed %v: not synced; run “%v feeds sync” while online", name, prog)
+	}
+	b, err := download(url, timeout)
+	if err != nil {
+		if stale, rerr := ioutil.ReadFile(path); rerr == nil {
+			return stale, nil
+		}
+		return nil, fmt.Errorf("feed %v: %v", name, err)
+	}
+	storeFeed(name, b)
+	return b, nil
+}
+
+// storeFeed saves the body of the feed called name to the local store.
+func storeFeed(name string, b []byte) error {
+	path := feedCachePath(name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, 0644)
+}
+
+// download fetches url and returns the response body.
+func download(url string, timeout time.Duration) ([]byte, error) {
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %v: %v", url, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// feedCachePath returns where the feed called name is stored on disk.
+func feedCachePath(name string) string {
+	return filepath.Join(cacheDir(), "feeds", name)
+}
+
+// configPath returns the path of the named file in ipgrep’s configuration
+// directory.
+func configPath(name string) string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return name
+	}
+	return filepath.Join(dir, prog, name)
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+)
+
+const feedsUsage = `
+usage: %[1]v feeds [-feeds-config FILE] [-timeout D] sync|list|prune
+
+Manages the local store of threat feeds used by -check-banlist and
+-check-feeds, and of the GeoIP database used by -by-country, so they can
+be used on machines with no network access.
+
+	sync     download every configured feed, however fresh the stored copy
+	list     show each configured feed and the age of its stored copy
+	prune    delete stored feeds that are no longer configured
+
+Feeds are read from %[2]v unless -feeds-config names
+another file, and are stored in %[3]v. Each download
+may take up to -timeout (default 1m). Pass -offline
+to a scan to use the stored feeds without trying to refresh them.
+
+A feed of format "geoip" is a GeoIP database, such as DB-IP’s free
+IP-to-country CSV, gzipped or not: rows of a range’s first and last
+address and its country’s code, or of a network and its country’s code.
+With one configured, -by-country uses it rather than Team Cymru’s DNS.
+`
+
+// feedsFlags holds the options of “ipgrep feeds”.
+var (
+	feedsFlags      = flag.NewFlagSet("feeds", flag.ExitOnError)
+	feedsCmdConfig  = feedsFlags.String("feeds-config", configPath("feeds.json"), "feeds config file")
+	feedsCmdTimeout = feedsFlags.Duration("timeout", time.Minute, "timeout for each download")
+)
+
+func init() {
+	feedsFlags.Usage = func() {
+		fmt.Fprintf(os.Stderr, feedsUsage, prog, configPath("feeds.json"), feedCachePath(""))
+	}
+}
+
+// feedsCommand implements “ipgrep feeds”.
+func feedsCommand(args []string) {
+	fs := feedsFlags
+	parseArgs(fs, args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		exit(2)
+	}
+	feeds, err := allFeeds(*feedsCmdConfig)
+	if err != nil {
+		die(err)
+	}
+	switch fs.Arg(0) {
+	case "sync":
+		syncFeeds(feeds, *feedsCmdTimeout)
+	case "list":
+		listFeeds(feeds)
+	case "prune":
+		pruneFeeds(feeds)
+	default:
+		fs.Usage()
+		exit(2)
+	}
+}
+
+// syncFeeds downloads each feed to the local store, checking that it parses
+// before replacing the stored copy.
+func syncFeeds(feeds []feed, timeout time.Duration) {
+	var failed bool
+	for _, f := range feeds {
+		b, err := download(f.URL, timeout)
+		if err == nil {
+			var n int
+			if n, err = feedEntries(f, b); err == nil {
+				err = storeFeed(f.Name, b)
+				fmt.Printf("%v: %d entries\n", f.Name, n)
+			}
+		}
+		if err != nil {
+			printError(fmt.Sprintf("feed %v: %v", f.Name, err))
+			failed = true
+		}
+	}
+	if failed {
+		exit(exitError)
+	}
+}
+
+// feedEntries parses b, the body of f, and returns how many entries it has:
+// addresses and networks, or for a GeoIP database, ranges of them.
+func feedEntries(f feed, b []byte) (int, error) {
+	if f.Format == geoFormat {
+		db, err := parseGeoDB(b)
+		if err != nil {
+			return 0, err
+		}
+		return len(db.ranges), nil
+	}
+	set, err := feedParsers[f.Format](f, b)
+	if err != nil {
+		return 0, err
+	}
+	return len(set.ips) + len(set.nets), nil
+}
+
+// listFeeds prints a table of the configured feeds and their stored copies.
+func listFeeds(feeds []feed) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tFORMAT\tAGE\tENTRIES\tURL")
+	for _, f := range feeds {
+		age, entries := "not synced", missing
+		if fi, err := os.Stat(feedCachePath(f.Name)); err == nil {
+			age = time.Since(fi.ModTime()).Round(time.Minute).String()
+			if b, err := ioutil.ReadFile(feedCachePath(f.Name)); err == nil {
+				if n, err := feedEntries(f, b); err == nil {
+					entries = fmt.Sprint(n)
+				}
+			}
+		}
+		format := f.Format
+		if format == "" {
+			format = "plain"
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\n", f.Name, format, age, entries, f.URL)
+	}
+	w.Flush()
+}
+
+// pruneFeeds removes stored feeds that aren’t in feeds.
+func pruneFeeds(feeds []feed) {
+	keep := make(map[string]bool)
+	for _, f := range feeds {
+		keep[f.Name] = true
+	}
+	dir := feedCachePath("")
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		die(err)
+	}
+	for _, e := range entries {
+		if keep[e.Name()] || e.IsDir() {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, e.Name())); err != nil {
+			printError(err)
+			continue
+		}
+		fmt.Println("removed", e.Name())
+	}
+}
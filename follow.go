@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"time"
+	"unicode/utf8"
+
+	"github.com/princebot/ipgrep/ipgrep"
+)
+
+const (
+	// followPoll is how often -follow checks a file for new data once it
+	// has read to the end.
+	followPoll = 500 * time.Millisecond
+
+	// maxFollowedLine is the most of a line -follow holds: longer lines are
+	// sent in pieces, each ending between words.
+	maxFollowedLine = 64 << 10
+)
+
+// followedLine is a complete line read from a followed file, or a piece of
+// one too long to hold.
+type followedLine struct {
+	File string
+	Text []byte
+}
+
+// followFiles implements -follow: it reads each file from the beginning, then
+// keeps reading lines as they are appended, printing the IPs on each line as
+// soon as it is complete — with -unique, only the first time it is seen in
+// each file. It runs until interrupted, refreshing any feeds in
+// the background so matches aren’t made against a stale snapshot. With
+// -window, it prints the busiest IPs periodically instead of each match; with
+// -alert-threshold, it raises an alert for any IP seen too often.
+func followFiles(names []string, en *enricher) {
+	stopProfilingOnSignal()
+	lines := make(chan followedLine)
+	for _, name := range names {
+		fp, err := os.Open(name)
+		if err != nil {
+			die(err)
+		}
+		go tail(fp, lines)
+	}
+	if en != nil && en.feeds != nil && *feedRefresh > 0 && !*offline {
+		go en.feeds.refreshEvery(*feedRefresh, *lookupTimeout)
+	}
+	var (
+		top  *talkers
+		tick <-chan time.Time
+		seen map[string]*seenSet // with -unique, the IPs printed from each file.
+
+		// What lookups found of each IP, which is forgotten as often as
+		// feeds are refreshed, so the IPs are looked up again.
+		known  map[netip.Addr]*enrichment
+		forget <-chan time.Time
+	)
+	if en != nil {
+		known = make(map[netip.Addr]*enrichment)
+		if *feedRefresh > 0 {
+			forget = time.Tick(*feedRefresh)
+		}
+	}
+	if *uniqueIPs {
+		seen = make(map[string]*seenSet)
+	}
+	if *window > 0 {
+		top = newTalkers(*window)
+	}
+	alerts := mustAlerter()
+	if top != nil || alerts != nil {
+		tick = time.Tick(windowReport)
+	}
+	for {
+		var (
+			l  followedLine
+			at time.Time
+		)
+		select {
+		case l = <-lines:
+		case now := <-tick:
+			if top != nil {
+				top.print(now, *topN)
+			}
+			if alerts != nil {
+				alerts.seen.sweep(now)
+			}
+			continue
+		case <-forget:
+			clear(known)
+			continue
+		}
+		if *withTimestamps {
+			at = withYear(findTime(l.Text), time.Now())
+		}
+		for _, ip := range ipgrep.Extract(l.Text) {
+			if seen != nil {
+				s := seen[l.File]
+				if s == nil {
+					s = newSeenSet(int64(uniqueMemory))
+					seen[l.File] = s
+				}
+				if !s.add(ip) {
+					continue
+				}
+			}
+			e, ok := known[ip]
+			if !ok && en != nil {
+				e = en.enrich(ip)
+				known[ip] = e
+			}
+			if !wanted(e) {
+				continue
+			}
+			if alerts != nil {
+				alerts.observe(ip, l, time.Now())
+			}
+			if top != nil {
+				top.add(ip, e, time.Now())
+				continue
+			}
+			if *output == "json" {
+				m := ipMatch(ip)
+				m.Source = l.File
+				n := newNote(ip, e, en != nil)
+				n.Time = at
+				b, err := ipgrep.MarshalMatch(m, n)
+				if err != nil {
+					die(err)
+				}
+				os.Stdout.Write(append(b, '\n'))
+				continue
+			}
+			if *withTimestamps {
+				fmt.Printf("%v\t%v\t%v\n", l.File, timeColumn(at), textLine(ip, e))
+				continue
+			}
+			fmt.Printf("%v\t%v\n", l.File, textLine(ip, e))
+		}
+	}
+}
+
+// tail sends each line of fp to lines, then waits for more to be appended.
+// If the file is truncated, tail starts again from the beginning; if it is
+// replaced, as by log rotation, tail switches to the new file.
+func tail(fp *os.File, lines chan<- followedLine) {
+	var (
+		name    = fp.Name()
+		r       = bufio.NewReaderSize(fp, maxFollowedLine)
+		partial []byte
+		skip    bool // whether the rest of a word too long to hold is skipped.
+	)
+	for {
+		b, err := r.ReadSlice('\n')
+		if skip {
+			if i := bytes.IndexFunc(b, ipgrep.IsSeparator); i >= 0 {
+				b, skip = b[i:], false
+			} else {
+				b = nil
+			}
+		}
+		partial = append(partial, b...)
+		if err == nil {
+			lines <- followedLine{name, partial}
+			partial = nil
+			continue
+		}
+		if len(partial) >= maxFollowedLine {
+			partial, skip = cutLine(partial, func(piece []byte) { lines <- followedLine{name, piece} })
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != io.EOF {
+			printError(fmt.Sprintf("%v: %v", name, err))
+			return
+		}
+		time.Sleep(followPoll)
+		cur, err := fp.Stat()
+		if err != nil {
+			continue
+		}
+		if next, err := os.Stat(name); err == nil && !os.SameFile(cur, next) {
+			nfp, err := os.Open(name)
+			if err != nil {
+				continue
+			}
+			// Drain whatever was written to the old file before it was
+			// rotated away on the next pass, then move on.
+			if _, err := r.Peek(1); err == io.EOF {
+				fp.Close()
+				fp = nfp
+				r.Reset(fp)
+				if len(partial) > 0 {
+					lines <- followedLine{name, partial}
+					partial, skip = nil, false
+				}
+			} else {
+				nfp.Close()
+			}
+			continue
+		}
+		if pos, err := fp.Seek(0, io.SeekCurrent); err == nil && cur.Size() < pos {
+			fp.Seek(0, io.SeekStart)
+			r.Reset(fp)
+			partial, skip = nil, false
+		}
+	}
+}
+
+// cutLine sends the words of b, the start of a line too long to hold, to
+// send as a piece of the line, returning the start of the word b ends with,
+// which may yet go on. If that word is already too long to be an IP, or b
+// is all one word, it is dropped instead, and cutLine reports that the rest
+// of it is to be skipped.
+func cutLine(b []byte, send func(piece []byte)) (rest []byte, skip bool) {
+	i := bytes.LastIndexFunc(b, ipgrep.IsSeparator)
+	if i < 0 {
+		return nil, true
+	}
+	send(b[:i])
+	_, size := utf8.DecodeRune(b[i:])
+	if rest = b[i+size:]; len(rest) > len("ffff:ffff:ffff:ffff:ffff:ffff:255.255.255.255") {
+		return nil, true
+	}
+	return append([]byte(nil), rest...), false
+}
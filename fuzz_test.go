@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/princebot/ipgrep/ipgrep"
+)
+
+// fuzzSeeds are inputs of the kinds ipgrep is pointed at, hostile ones
+// included.
+var fuzzSeeds = []string{
+	"1[.]2[.]3[.]4, 1(.)2(.)3(.)4, 1[dot]2[dot]3[dot]4",
+	"2001[:]db8[:][:]1 hxxps://10[.]0[.]0[.]1/x http[:]//[2001:db8::1]:80/",
+	"user[@]example[.]com, user[at]example[.]com, fxp://1\\.2\\.3\\.4",
+	"<a href=\"http://192.0.2.1/\">[::1]</a> (fe80::1%eth0)",
+	"Jan  2 15:04:05 host sshd[1]: Failed password from 203.0.113.9 port 22",
+	"2024-05-01T12:00:00Z 10.0.0.1 - - [01/May/2024:12:00:00 +0000] \"GET /\"",
+	"\x00\xff[.\xfe] [[.]] ([dot)] 1.2.3.4.",
+}
+
+// FuzzRefang checks that refang restores any IP defanged in the usual ways
+// and touches nothing it shouldn’t in text that has no defanging at all.
+func FuzzRefang(f *testing.F) {
+	for _, s := range fuzzSeeds {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		refang([]byte(s)) // mustn’t panic, whatever s is.
+		ips := ipgrep.Extract([]byte(s))
+		var defanged []string
+		for _, ip := range ips {
+			d := strings.NewReplacer(".", "[.]", ":", "[:]").Replace(ip.String())
+			defanged = append(defanged, d)
+		}
+		got := ipgrep.Extract(refang([]byte(strings.Join(defanged, " "))))
+		if len(got) != len(ips) {
+			t.Fatalf("refanged %q to %v, want %v", defanged, got, ips)
+		}
+		for i := range got {
+			if got[i] != ips[i] {
+				t.Fatalf("refanged %q to %v, want %v", defanged, got, ips)
+			}
+		}
+	})
+}
+
+// FuzzRewrite checks that rewriting text replaces every IP in it, and
+// nothing else.
+func FuzzRewrite(f *testing.F) {
+	for _, s := range fuzzSeeds {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		replaced := 0
+		out := rewrite([]byte(s), func(netip.Addr) string {
+			replaced++
+			return "IP"
+		})
+		if left := ipgrep.Extract(out); len(left) > 0 {
+			t.Fatalf("rewrote %q to %q, leaving %v", s, out, left)
+		}
+		if want := len(ipgrep.Extract([]byte(s))); replaced != want {
+			t.Fatalf("replaced %d IPs in %q, want %d", replaced, s, want)
+		}
+	})
+}
+
+// FuzzFindTime checks that timestamps are parsed, or not, without panicking.
+func FuzzFindTime(f *testing.F) {
+	for _, s := range fuzzSeeds {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		findTime([]byte(s))
+	})
+}
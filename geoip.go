@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"sort"
+	"strings"
+)
+
+// geoFormat is the feed format of a GeoIP database, which maps addresses to
+// countries rather than listing threats: rows of the first and last address
+// of a range and its country’s code, as DB-IP’s free IP-to-country database
+// has them, or of a network and its country’s code, perhaps gzipped.
+const geoFormat = "geoip"
+
+// geoDB is a GeoIP database: ranges of addresses, sorted and not
+// overlapping, and the country of each.
+type geoDB struct {
+	ranges []geoRange
+}
+
+type geoRange struct {
+	first, last netip.Addr
+	country     string
+}
+
+// geoFeed returns the first of feeds that is a GeoIP database, if any is.
+func geoFeed(feeds []feed) (feed, bool) {
+	for _, f := range feeds {
+		if f.Format == geoFormat {
+			return f, true
+		}
+	}
+	return feed{}, false
+}
+
+// parseGeoDB reads a GeoIP database from b. Header rows and others that
+// don’t begin with an address are skipped.
+func parseGeoDB(b []byte) (*geoDB, error) {
+	var r io.Reader = bytes.NewReader(b)
+	if bytes.HasPrefix(b, []byte{0x1f, 0x8b}) {
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		r = zr
+	}
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+	db := new(geoDB)
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if g, ok := geoRow(rec); ok {
+			db.ranges = append(db.ranges, g)
+		}
+	}
+	if len(db.ranges) == 0 {
+		return nil, errors.New("no ranges of addresses found")
+	}
+	sort.Slice(db.ranges, func(i, j int) bool {
+		return db.ranges[i].first.Less(db.ranges[j].first)
+	})
+	return db, nil
+}
+
+// geoRow returns the range a row of a GeoIP database gives, if it gives one.
+func geoRow(rec []string) (geoRange, bool) {
+	if len(rec) < 2 {
+		return geoRange{}, false
+	}
+	first := strings.TrimSpace(rec[0])
+	if n, err := netip.ParsePrefix(first); err == nil {
+		n = n.Masked()
+		return geoRange{n.Addr(), lastAddr(n), strings.TrimSpace(rec[1])}, true
+	}
+	if len(rec) < 3 {
+		return geoRange{}, false
+	}
+	lo, err := netip.ParseAddr(first)
+	if err != nil {
+		return geoRange{}, false
+	}
+	hi, err := netip.ParseAddr(strings.TrimSpace(rec[1]))
+	if err != nil || hi.Less(lo) || hi.Is4() != lo.Is4() {
+		return geoRange{}, false
+	}
+	return geoRange{lo.Unmap(), hi.Unmap(), strings.TrimSpace(rec[2])}, true
+}
+
+// lastAddr returns the last address in n.
+func lastAddr(n netip.Prefix) netip.Addr {
+	b := n.Addr().AsSlice()
+	for i := n.Bits(); i < len(b)*8; i++ {
+		b[i/8] |= 0x80 >> (i % 8)
+	}
+	last, _ := netip.AddrFromSlice(b)
+	return last
+}
+
+// country returns the code of the country db places ip in, or "" if it
+// places it nowhere.
+func (db *geoDB) country(ip netip.Addr) string {
+	ip = ip.Unmap()
+	i := sort.Search(len(db.ranges), func(i int) bool {
+		return ip.Less(db.ranges[i].first)
+	})
+	if i == 0 {
+		return ""
+	}
+	if g := db.ranges[i-1]; ip.Compare(g.last) <= 0 && ip.Is4() == g.first.Is4() {
+		return g.country
+	}
+	return ""
+}
+
+// loadGeoDB loads the GeoIP database the feeds config file lists, if it
+// lists one, as a feed is loaded, dying if it can’t be. It returns nil if
+// there is none, and -by-country asks Team Cymru instead.
+func loadGeoDB() *geoDB {
+	feeds, err := loadFeedConfig(*feedsConfig)
+	if err != nil {
+		die(err)
+	}
+	f, ok := geoFeed(feeds)
+	if !ok {
+		return nil
+	}
+	b, err := fetchFeed(f.Name, f.URL, *lookupTimeout)
+	if err != nil {
+		die(err)
+	}
+	db, err := parseGeoDB(b)
+	if err != nil {
+		die(fmt.Errorf("feed %v: %v", f.Name, err))
+	}
+	return db
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// greyNoiseInfo is the subset of a GreyNoise community API response ipgrep
+// reports.
+type greyNoiseInfo struct {
+	Noise          bool   `json:"noise"`          // seen mass-scanning the internet.
+	RIOT           bool   `json:"riot"`           // belongs to a common business service.
+	Classification string `json:"classification"` // benign, malicious, or unknown.
+	Name           string `json:"name,omitempty"` // owner, if known.
+}
+
+// lookupGreyNoise fetches GreyNoise’s verdict on ip, consulting the on-disk
+// cache first. key may be empty, in which case the unauthenticated community
+// rate limit applies. An IP GreyNoise has never observed yields a zero
+// greyNoiseInfo; a nil result means the query failed.
+func lookupGreyNoise(ip, key string, timeout time.Duration) *greyNoiseInfo {
+	b, err := cached("greynoise", ip, func() ([]byte, error) {
+		var h http.Header
+		if key != "" {
+			h = http.Header{"Key": {key}}
+		}
+		return apiGet("https://api.greynoise.io/v3/community/"+ip, h, timeout)
+	})
+	if err != nil {
+		return nil
+	}
+	var info greyNoiseInfo
+	if len(b) > 0 && json.Unmarshal(b, &info) != nil {
+		return nil
+	}
+	return &info
+}
+
+// label condenses g into a single word: benign-service for RIOT addresses,
+// benign-scanner or noise for mass-scanners depending on whether GreyNoise
+// trusts them, and unknown for everything else.
+func (g *greyNoiseInfo) label() string {
+	switch {
+	case g == nil:
+		return missing
+	case g.RIOT:
+		return "benign-service"
+	case g.Noise && g.Classification == "benign":
+		return "benign-scanner"
+	case g.Noise:
+		return "noise"
+	}
+	return "unknown"
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// groupSamples is how many distinct addresses are shown for each prefix.
+const groupSamples = 3
+
+// prefixGroup tallies the results falling within one subnet.
+type prefixGroup struct {
+	Prefix  string   `json:"prefix"`
+	Hits    int      `json:"hits"`   // occurrences, counting repeats.
+	Unique  int      `json:"unique"` // distinct addresses.
+	Samples []string `json:"samples"`
+	seen    map[netip.Addr]bool
+}
+
+// parseGroupPrefixes parses a -group-by-prefix value: an IPv4 prefix length,
+// optionally followed by a comma and an IPv6 prefix length, which otherwise
+// defaults to 64. Leading slashes are allowed, as in "/24,/48".
+func parseGroupPrefixes(s string) (v4, v6 int, err error) {
+	v6 = 64
+	parts := strings.SplitN(s, ",", 2)
+	if v4, err = strconv.Atoi(strings.TrimPrefix(parts[0], "/")); err != nil || v4 < 0 || v4 > 32 {
+		return 0, 0, fmt.Errorf("-group-by-prefix: invalid IPv4 prefix length %q", parts[0])
+	}
+	if len(parts) == 2 {
+		if v6, err = strconv.Atoi(strings.TrimPrefix(parts[1], "/")); err != nil || v6 < 0 || v6 > 128 {
+			return 0, 0, fmt.Errorf("-group-by-prefix: invalid IPv6 prefix length %q", parts[1])
+		}
+	}
+	return v4, v6, nil
+}
+
+// groupByPrefix buckets every IP in results by its v4- or v6-bit prefix and
+// returns the buckets, busiest first.
+func groupByPrefix(results []*scanResult, v4, v6 int) []*prefixGroup {
+	groups := make(map[netip.Prefix]*prefixGroup)
+	for _, r := range results {
+		for _, ip := range r.IPs {
+			bits := v4
+			if ip.Is6() {
+				bits = v6
+			}
+			key, _ := ip.Prefix(bits)
+			g := groups[key]
+			if g == nil {
+				g = &prefixGroup{Prefix: key.String(), seen: make(map[netip.Addr]bool)}
+				groups[key] = g
+			}
+			g.Hits++
+			if !g.seen[ip] {
+				g.seen[ip] = true
+				g.Unique++
+				if len(g.Samples) < groupSamples {
+					g.Samples = append(g.Samples, ip.String())
+				}
+			}
+		}
+	}
+	out := make([]*prefixGroup, 0, len(groups))
+	for _, g := range groups {
+		out = append(out, g)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Hits != out[j].Hits {
+			return out[i].Hits > out[j].Hits
+		}
+		return out[i].Prefix < out[j].Prefix
+	})
+	return out
+}
+
+// printGroups prints the buckets from groupByPrefix in the -output format.
+func printGroups(groups []*prefixGroup) {
+	if *output == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(groups); err != nil {
+			die(err)
+		}
+		return
+	}
+	fmt.Println("# results by prefix:")
+	printGroupTable(groups)
+	fmt.Println()
+}
+
+// printGroupTable prints groups as a table with a row per prefix.
+func printGroupTable(groups []*prefixGroup) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "PREFIX\tHITS\tUNIQUE\tSAMPLES")
+	for _, g := range groups {
+		samples := strings.Join(g.Samples, ", ")
+		if g.Unique > len(g.Samples) {
+			samples += ", …"
+		}
+		fmt.Fprintf(w, "%v\t%d\t%d\t%v\n", g.Prefix, g.Hits, g.Unique, samples)
+	}
+	w.Flush()
+}
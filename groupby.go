@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/princebot/ipgrep/ipgrep"
+)
+
+// groupings are the -group-by choices other than file, the default, and ip,
+// which printIPGroups handles. Each returns the group an IP belongs in.
+var groupings = map[string]func(netip.Addr) string{
+	"version": func(ip netip.Addr) string {
+		if ip.Is4() {
+			return "IPv4"
+		}
+		return "IPv6"
+	},
+	"classification": classify,
+	"none":           func(netip.Addr) string { return "" },
+}
+
+// regroup gathers the IPs in results, and whatever goes with them, into a
+// result per group as named by group, in order of first appearance. Each
+// result’s Group is set instead of its File. With -unique, each IP appears
+// only once in its group.
+func regroup(results []*scanResult, group func(netip.Addr) string) []*scanResult {
+	var (
+		groups []*scanResult
+		byName = make(map[string]*scanResult)
+	)
+	for _, r := range results {
+		for i, ip := range r.IPs {
+			name := group(ip)
+			g := byName[name]
+			if g == nil {
+				g = &scanResult{Group: name}
+				byName[name] = g
+				groups = append(groups, g)
+			}
+			g.IPs = append(g.IPs, ip)
+			if r.Times != nil {
+				g.Times = append(g.Times, r.Times[i])
+			}
+			if r.Matches != nil {
+				g.Matches = append(g.Matches, r.Matches[i])
+			}
+		}
+	}
+	if *uniqueIPs {
+		for i, g := range distinct(groups) {
+			g.Group = groups[i].Group
+			groups[i] = g
+		}
+	}
+	return groups
+}
+
+// ipGroup is one row of -group-by ip: a unique IP, how often it was found,
+// and in which files, which -output json gives with what else is known.
+type ipGroup struct {
+	jsonNote
+	Count int      `json:"count"`
+	Files []string `json:"files"`
+}
+
+// printIPGroups implements -group-by ip: a row per unique IP, in order of
+// first appearance, with how many times and in which files it was found,
+// and where it was first found, if known, as -output chooses.
+func printIPGroups(results []*scanResult, ann map[netip.Addr]*enrichment) {
+	var (
+		res  = ipgrep.Result{Group: "results by IP"}
+		rows []*ipGroup
+		byIP = make(map[netip.Addr]*ipGroup)
+	)
+	for _, r := range results {
+		for i, ip := range r.IPs {
+			g := byIP[ip]
+			if g == nil {
+				g = &ipGroup{jsonNote: jsonNote{classify(ip), ann[ip]}, Files: []string{}}
+				byIP[ip] = g
+				rows = append(rows, g)
+				m := ipMatch(ip)
+				if r.Matches != nil {
+					m = r.Matches[i]
+				}
+				res.Matches = append(res.Matches, m)
+			}
+			g.Count++
+			if n := len(g.Files); n == 0 || g.Files[n-1] != r.File {
+				g.Files = append(g.Files, r.File)
+			}
+		}
+	}
+	for i, g := range rows {
+		n := newNote(res.Matches[i].IP, ann[res.Matches[i].IP], ann != nil)
+		n.Columns = append([]ipgrep.Column{
+			{Header: "COUNT", Value: fmt.Sprint(g.Count)},
+			{Header: "FILES", Value: strings.Join(g.Files, ",")},
+		}, n.Columns...)
+		n.Fields = g
+		res.Notes = append(res.Notes, n)
+	}
+	writeResults(ipgrep.LookupFormatter(*output), []ipgrep.Result{res})
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+)
+
+// errInterrupted is the error of every file whose scan was cut short by
+// SIGINT or SIGTERM.
+var errInterrupted = errors.New("interrupted")
+
+// interrupted is set once a scan has been interrupted.
+var interrupted atomic.Bool
+
+// cancelOnSignal returns a context that is cancelled with errInterrupted on
+// SIGINT or SIGTERM, and a function that stops watching for them. After the
+// first signal, or once stop is called, the next one kills the process as
+// usual.
+func cancelOnSignal(parent context.Context) (ctx context.Context, stop func()) {
+	ctx, cancel := context.WithCancelCause(parent)
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-sigs:
+			interrupted.Store(true)
+			signal.Stop(sigs)
+			cancel(errInterrupted)
+		case <-done:
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(sigs)
+		close(done)
+		cancel(nil)
+	}
+}
+
+// exitIfInterrupted notes on stderr, if a scan was interrupted, that the
+// results printed are partial, and exits with the status conventional for
+// SIGINT.
+func exitIfInterrupted() {
+	if interrupted.Load() {
+		printError(fmt.Errorf("%w; the results above are partial", errInterrupted))
+		exit(exitInterrupted)
+	}
+}
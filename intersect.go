@@ -0,0 +1,22 @@
+package main
+
+import "net/netip"
+
+// intersect returns the unique IPs found in every one of n input files, in
+// order of first appearance. results holds the files that were scanned
+// successfully; if there are fewer than n, the intersection is empty.
+func intersect(results []*scanResult, n int) []netip.Addr {
+	files := make(map[netip.Addr]int)
+	for _, r := range results {
+		for _, ip := range unique([]*scanResult{r}) {
+			files[ip]++
+		}
+	}
+	var ips []netip.Addr
+	for _, ip := range unique(results) {
+		if files[ip] == n {
+			ips = append(ips, ip)
+		}
+	}
+	return ips
+}
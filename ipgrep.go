@@ -3,23 +3,51 @@
 package main
 
 import (
-	"bytes"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"io/ioutil"
-	"net"
+	"io"
+	"math"
+	"net/netip"
 	"os"
-	"unicode"
-
+	"runtime"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/fatih/color"
 	"github.com/mattn/go-colorable"
+	"github.com/princebot/ipgrep/ipgrep"
 )
 
 const prog = "ipgrep"
 
+// Exit statuses other than 0, for success. As with grep, 1 is for finding
+// nothing and 2 for errors.
+const (
+	exitNoMatch      = 1   // -quiet found no IPs, or -pick was canceled.
+	exitError        = 2   // an error occurred, or the command line was invalid.
+	exitWatchlistHit = 3   // a result matches -watchlist.
+	exitUnreadable   = 4   // an input file couldn’t be opened or read.
+	exitTimedOut     = 5   // an input file wasn’t scanned within -timeout or -file-timeout.
+	exitInterrupted  = 130 // scanning was cut short by SIGINT or SIGTERM.
+)
+
 const usage = `
-usage: %[1]v [file ...]
+usage: %[1]v [scan] [options] file ...
+       %[1]v feeds sync|list|prune
+       %[1]v diff A B
+       %[1]v stats file ...
+       %[1]v baseline save|diff NAME file ...
+       %[1]v refang file ...
+       %[1]v net [options]
+       %[1]v neighbors [options]
+       %[1]v system [options]
+       %[1]v completion bash|zsh|fish|powershell
+       %[1]v man
+       %[1]v help [command]
 
 %[1]v scans one or more input files for valid IPv4 or IPv6 addresses and prints
 the result. It accepts text files in any format (newline-delimited, JSON, YAML,
@@ -40,13 +68,423 @@ above. However, given this input — 
 
 — ipgrep extracts nothing: The final '.' renders the address invalid, and this
 utility doesn’t try quite that hard.
+
+Options may come before or after file names, for every command; any
+arguments after “--” are taken as file names even if they look like options.
+Each option’s default can be changed with an environment variable named for
+it, such as IPGREP_OUTPUT=json or IPGREP_LOOKUP_TIMEOUT=10s, or in the config
+file %[5]v, as in “output: json”.
+Scanning is the default command, so “%[1]v scan” is needed only to scan a file
+named like another command.
+
+Run “%[1]v help feeds” for help managing the threat feeds used by -check-feeds,
+“%[1]v help diff” for help comparing the IPs in two files, “%[1]v help stats”
+for help summarizing them, “%[1]v help baseline” for help spotting IPs not
+seen before, “%[1]v help refang” for help restoring defanged indicators, and
+“%[1]v help completion” for help setting up shell completion.
+
+options:
+
+	-classify             print each result’s address class: public, private,
+	                      loopback, link-local, multicast, cgnat, 6to4, teredo,
+	                      ula, documentation, unspecified, or reserved
+	-rdns                 look up the PTR record for each unique result and
+	                      print the hostname alongside the IP
+	-fcrdns               like -rdns, but also resolve each hostname forward
+	                      and mark whether it maps back to the original IP
+	-asn-lookup           annotate each unique result with its origin AS
+	                      number, announced prefix, and AS name
+	-rdap                 annotate each unique result with its registration
+	                      handle, organization, and abuse contact via RDAP
+	-check-banlist        mark results that appear on the Binary Defense
+	                      banlist, downloading it if the cached copy is stale
+	-check-feeds          mark results with the name of every feed in the
+	                      feeds config file that lists them
+	-feeds-config FILE    read feeds from FILE (default %[2]v)
+	-only-listed          with -check-banlist or -check-feeds, print only
+	                      results that appear on a feed
+	-watchlist FILE       tag results matching any IP or CIDR in FILE and exit
+	                      with status 3 if there are any
+	-dnsbl ZONES          check each unique public IPv4 result against the
+	                      comma-separated DNS blocklist zones, e.g.
+	                      -dnsbl zen.spamhaus.org,bl.spamcop.net
+	-shodan               annotate each unique public result with its open
+	                      ports, organization, and tags from Shodan, using
+	                      the API key in $SHODAN_API_KEY or shodan.key (*)
+	-abuseipdb            annotate each unique public result with its
+	                      AbuseIPDB confidence score and report count, using
+	                      the API key in $ABUSEIPDB_API_KEY or abuseipdb.key (*)
+	-min-abuse-score N    with -abuseipdb, print only results scoring at least
+	                      N (0–100)
+	-virustotal           annotate each unique public result with VirusTotal
+	                      detection stats and associated domains, using the
+	                      API key in $VT_API_KEY or virustotal.key (*)
+	-vt-rate N            send at most N VirusTotal requests a minute
+	                      (default 4, the public API’s quota)
+	-greynoise            label each unique public result benign-service,
+	                      benign-scanner, noise, or unknown per GreyNoise,
+	                      using the API key in $GREYNOISE_API_KEY or
+	                      greynoise.key (*) if there is one
+	-suppress-noise       with -greynoise, hide results GreyNoise has seen
+	                      mass-scanning the internet
+	-probe METHOD         mark each unique result alive or dead according to
+	                      whether it answers an ICMP echo (-probe icmp) or
+	                      accepts a TCP connection (-probe tcp:PORT) within
+	                      -lookup-timeout
+	-enrich-plugin CMD    annotate each unique result with the fields returned
+	                      by CMD, an external program speaking JSON over its
+	                      stdin and stdout (see the README); may be repeated
+	-sink CMD             also send every result, as a line of JSON, to the
+	                      stdin of CMD, run with the shell; may be repeated
+	-summarize            instead of listing results, print the smallest set
+	                      of CIDR blocks covering every unique result
+	-slack N              with -summarize, merge neighboring blocks whenever
+	                      that covers no more than N extra addresses
+	-group-by WHAT        organize results by file (the default); ip, listing
+	                      each unique IP with its count and files; version,
+	                      under IPv4 and IPv6; classification, under each
+	                      address class; or none, in one list
+	-group-by-prefix N[,M]
+	                      instead of listing results, count them by /N IPv4
+	                      and /M IPv6 subnet (M defaults to 64), busiest
+	                      first, with a few sample addresses from each
+	-report matrix        instead of listing results by file, print a table
+	                      with a row per unique IP and a column per file,
+	                      counting the IP’s occurrences in each
+	-report by-ip         instead of listing results by file, print each
+	                      unique IP followed by the files and line numbers
+	                      where it occurs
+	-by-country           instead of listing results, count unique IPs and hits
+	                      by the country each IP’s prefix is registered to,
+	                      per the GeoIP database in the feeds config file,
+	                      or else the ASN lookup (implying its queries)
+	-by-asn               instead of listing results, count unique IPs and hits
+	                      by origin AS, per the ASN lookup (implies its
+	                      network queries)
+	-intersect            print only the unique IPs found in every file
+	-timeline INTERVAL    instead of listing results, print a histogram of how
+	                      many were found per minute, hour, or other interval
+	                      (e.g. -timeline 15m), using the timestamp on each
+	                      result’s line: RFC 3339, ISO 8601, syslog, or
+	                      common log format
+	-redact MODE          instead of listing results, print the input text with
+	                      every IP replaced by “[redacted]” (-redact
+	                      placeholder), by the IP with its host part masked,
+	                      as in 10.0.x.x (-redact mask), or by a salted hash
+	                      that is the same for each occurrence of the IP
+	                      (-redact hash)
+	-salt S               with -redact hash, hash with S, so that IPs hash the
+	                      same way from run to run (default a random salt)
+	-anonymize cryptopan  instead of listing results, print the input text with
+	                      every IP replaced by a pseudonym that preserves
+	                      prefixes — IPs sharing a /N share a /N once
+	                      anonymized — using Crypto-PAn with -key
+	-key KEY              with -anonymize, the key: 64 hex digits, as used by
+	                      other Crypto-PAn tools, or any passphrase; the same
+	                      key always gives the same pseudonyms
+	-replace TEMPLATE     instead of listing results, print the input text with
+	                      every IP replaced by the output of TEMPLATE, a Go
+	                      text/template given the IP as {{.IP}} and its
+	                      address class as {{.Class}}, e.g.
+	                      -replace '[{{.IP}}](https://ip.example/{{.IP}})'
+	-map-file FILE        instead of listing results, print the input text with
+	                      IPs rewritten per FILE, CSV rows of an old IP and
+	                      its new one, or an old prefix and a new prefix of
+	                      the same length (e.g. 10.1.0.0/16,10.9.0.0/16)
+	-unmapped ACTION      with -map-file, leave IPs FILE doesn’t map as they
+	                      are (-unmapped keep, the default) or quit with an
+	                      error listing them, before rewriting anything
+	                      (-unmapped error)
+	-i, -in-place         with -redact, -anonymize, -replace, or -map-file,
+	                      rewrite each input file instead of
+	                      printing it
+	-backup SUFFIX        with -in-place, keep each original file under its
+	                      name plus SUFFIX, e.g. -backup .orig
+	-with-timestamps      print each result with the timestamp found on its line,
+	                      in the formats -timeline recognizes; with -output
+	                      json, each match gets a "time" field
+	-f, -follow           after scanning each file, keep watching it and print
+	                      IPs on lines appended to it, like tail -f
+	-window D             with -follow, instead of printing each match, keep
+	                      rolling counts over the last D (e.g. 5m) and print
+	                      the busiest IPs every 10 seconds
+	-top N                with -window, print the N busiest IPs (default 10)
+	-alert-threshold N    with -follow, raise an alert whenever an IP is seen
+	                      more than N times within -alert-window
+	-alert-window D       count sightings for -alert-threshold over the last
+	                      D (default 1m)
+	-alert-action ACTION  alert by printing to stderr (the default), by
+	                      POSTing JSON to a URL (webhook:URL), or by running a
+	                      shell command (exec:COMMAND) with the details in
+	                      $ALERT_IP, $ALERT_COUNT, $ALERT_WINDOW, $ALERT_FILE,
+	                      and $ALERT_LINE
+	-feed-refresh D       with -follow, re-download feeds every D (default 1h),
+	                      unless -offline
+	-tui                  instead of printing results, browse the unique IPs in
+	                      an interactive terminal interface, in which they can
+	                      be filtered, sorted, traced to their lines, looked up
+	                      (with the lookup options given), marked, and copied;
+	                      marked IPs are printed on quitting
+	-pick                 instead of printing results, choose among the unique
+	                      ones with an fzf-style fuzzy finder (Tab marks more
+	                      than one), then print those chosen and copy them to
+	                      the clipboard
+	-list-files           print the files that would be scanned, with their
+	                      sizes, without reading any of them, and exit;
+	                      those that can’t be scanned are listed with the
+	                      errors
+	-c, -count            instead of listing results, print how many there are
+	                      in each file (just the number, given one file), as
+	                      with grep -c
+	-u, -unique           list each distinct IP only once per file; with
+	                      -count, count distinct IPs (-cu for short)
+	-unique-memory SIZE   with -unique, remember no more than SIZE (e.g. 64M)
+	                      of the IPs seen in each file when printing them as
+	                      they are found, as -follow does, and beyond that
+	                      remember them approximately, so that a few new ones
+	                      may be taken for repeats
+	-max-memory SIZE      with -unique, hold no more than SIZE of the distinct
+	                      IPs in each file in memory, writing the rest to
+	                      temporary files to be merged once all are scanned:
+	                      exact, unlike -unique-memory, but printed only then
+	-l, -files-with-matches
+	                      instead of listing results, print just the name of
+	                      each file with any, one per line
+	-L, -files-without-match
+	                      likewise, but print the name of each file without
+	                      any results
+	-q, -quiet            print no results, only errors, and exit with status 0
+	                      if any IPs are found (after any filtering) or 1 if
+	                      none are, as in “if %[1]v -q file; then ...”
+	-j, -jobs N           scan at most N files at once, keeping no more than
+	                      that many open (default the number of CPUs usable);
+	                      with fewer files, big ones are split among them
+	-mmap                 scan regular files by mapping them into memory,
+	                      sparing a copy, rather than reading them
+	-skip-errors          rather than quitting if any file can’t be opened,
+	                      report it with any other errors and scan the rest
+	-max-total N          stop scanning once N IPs have been found across all
+	                      files, for sampling huge inputs
+	-timeout D            give up on any file not scanned within D of the start,
+	                      reporting it with the errors (by default, there is no
+	                      limit)
+	-file-timeout D       give up on any file not scanned within D of opening
+	                      it, likewise
+	-progress             report progress on stderr while scanning: each file as
+	                      it is finished, and every second the files and bytes
+	                      done and the matches found so far
+	-v, -verbose          log to stderr each file opened, with its size, and how
+	                      many bytes were read and IPs found in it
+	-debug                like -verbose, but also log how many tokens each file
+	                      held, each one that looked like an IP but wasn’t
+	                      one, and each lookup made, e.g. to find out why an
+	                      IP wasn’t found
+	-cpuprofile FILE      write a CPU profile of the run to FILE, for “go tool
+	                      pprof”, to find out why it is slow
+	-memprofile FILE      on exiting, write a profile of the memory in use, and
+	                      of everything allocated, to FILE
+	-pprof ADDR           while running, serve profiles over HTTP at ADDR
+	                      (e.g. localhost:6060) under /debug/pprof/, as for
+	                      watching -follow
+	-version              print the version, commit, and build date, and exit
+	-color WHEN           color text results and errors: auto (the default; only
+	                      on a terminal, unless $NO_COLOR is set), always, or
+	                      never
+	-format NAME[:SPEC]   read each input as the output of a tool, taking IPs
+	                      only from the fields that hold them, and giving
+	                      each, with -output json, its field and what else
+	                      its record says; NAME is one of
+	                        nmap     XML or -oG, with the ports open on
+	                                 each host
+	                        masscan  JSON or -oL, with the port and
+	                                 protocol of each result
+	                        eve      Suricata’s eve.json, as src_ip,
+	                                 dest_ip, and the like
+	                        zeek     Zeek’s logs, TSV or JSON, as
+	                                 id.orig_h, id.resp_h, and the like
+	                        accesslog
+	                                 web server access logs, the client
+	                                 taken from X-Forwarded-For if it is
+	                                 logged; SPEC is the log format, as
+	                                 Apache or nginx configures it (by
+	                                 default, nginx’s, which also reads
+	                                 Apache’s combined and common), e.g.
+	                                 'accesslog:%%h %%t "%%r" %%{X-Forwarded-For}i'
+	                        vpcflow  AWS VPC Flow Logs, as srcaddr and
+	                                 dstaddr, with the action and bytes;
+	                                 SPEC is a custom format, as AWS
+	                                 takes it, unless the logs begin
+	                                 with a header naming their fields
+	                        cloudtrail
+	                                 AWS CloudTrail events, as
+	                                 sourceIPAddress and wherever else
+	                                 one is, with the eventName and
+	                                 eventTime
+	                        iis      IIS’s W3C logs, as c-ip and s-ip,
+	                                 in the fields their #Fields
+	                                 directive names
+	                        firewall iptables-save, nft, and pf.conf
+	                                 rulesets, as each rule’s source
+	                                 and destination networks, with its
+	                                 chain and action
+	                        pfirewall
+	                                 Windows Firewall’s pfirewall.log,
+	                                 as src-ip and dst-ip, with the
+	                                 action, protocol, and ports
+	-output FORMAT        print results as text (the default), json, lines:
+	                      each line with a result, as FILE:LINE:TEXT, or
+	                      csv: rows of file, line, column, offset, kind,
+	                      text, and IP, and any time, class, and lookups
+	-A, -after-context N  with -output lines, also print the N lines after
+	                      each line with a result, as FILE-LINE-TEXT
+	-B, -before-context N likewise, but the N lines before it
+	-C, -context N        likewise, but N lines on both sides (-A and -B
+	                      take precedence)
+	-cache-ttl LIST       override how long cached lookups are reused, as
+	                      comma-separated source=duration pairs, e.g.
+	                      ptr=1h,rdap=720h; sources are ptr, fcrdns, asn,
+	                      asname, rdap, rdap-bootstrap, dnsbl, feeds, shodan,
+	                      abuseipdb, virustotal, and greynoise
+	-no-cache             neither read nor update the lookup cache in %[4]v
+	-offline              never touch the network: use stored feeds and cached
+	                      lookups however old they are, and skip the rest;
+	                      -probe, -enrich-plugin, and -sink can’t be used
+	-lookup-jobs N        run at most N network lookups at once (default 16)
+	-lookup-timeout D     give up on a single lookup after D (default 3s)
+
+(*) API key files are read from %[3]v.
 `
 
+var (
+	classifyIPs    = flag.Bool("classify", false, "print each IP's address class")
+	rdns           = flag.Bool("rdns", false, "print PTR hostnames alongside IPs")
+	fcrdns         = flag.Bool("fcrdns", false, "verify PTR hostnames resolve back to their IPs")
+	asnLookup      = flag.Bool("asn-lookup", false, "annotate IPs with origin ASN, prefix, and AS name")
+	rdapLookup     = flag.Bool("rdap", false, "annotate IPs with RDAP registration data")
+	checkBanlist   = flag.Bool("check-banlist", false, "mark IPs on the Binary Defense banlist")
+	checkFeeds     = flag.Bool("check-feeds", false, "mark IPs listed on configured threat feeds")
+	feedsConfig    = flag.String("feeds-config", configPath("feeds.json"), "feeds config file")
+	onlyListed     = flag.Bool("only-listed", false, "print only IPs listed on a feed")
+	watchlist      = flag.String("watchlist", "", "file of IPs and CIDRs to tag")
+	dnsbl          = flag.String("dnsbl", "", "comma-separated DNS blocklist zones")
+	shodan         = flag.Bool("shodan", false, "annotate IPs with Shodan host data")
+	abuseIPDB      = flag.Bool("abuseipdb", false, "annotate IPs with AbuseIPDB reputation")
+	minAbuseScore  = flag.Int("min-abuse-score", 0, "print only IPs with at least this AbuseIPDB score")
+	virusTotal     = flag.Bool("virustotal", false, "annotate IPs with VirusTotal reports")
+	vtPerMinute    = flag.Int("vt-rate", 4, "maximum VirusTotal requests per minute")
+	greyNoise      = flag.Bool("greynoise", false, "label IPs with their GreyNoise classification")
+	suppressNoise  = flag.Bool("suppress-noise", false, "hide IPs GreyNoise sees mass-scanning")
+	probe          = flag.String("probe", "", "probe reachability: icmp or tcp:PORT")
+	summarizeIPs   = flag.Bool("summarize", false, "print covering CIDR blocks instead of IPs")
+	slack          = flag.Int64("slack", 0, "extra addresses -summarize may cover per merge")
+	groupBy        = flag.String("group-by", "file", "organize results by file, ip, version, classification, or none")
+	groupPrefix    = flag.String("group-by-prefix", "", "count results by subnet prefix length")
+	report         = flag.String("report", "", "print a report instead of results: matrix or by-ip")
+	byCountry      = flag.Bool("by-country", false, "count results by country instead of listing them")
+	byASN          = flag.Bool("by-asn", false, "count results by origin AS instead of listing them")
+	intersectIPs   = flag.Bool("intersect", false, "print only IPs found in every file")
+	timeline       = flag.String("timeline", "", "print a histogram of matches per interval")
+	redact         = flag.String("redact", "", "print the input with IPs redacted: placeholder, mask, or hash")
+	salt           = flag.String("salt", "", "salt for -redact hash")
+	anonymize      = flag.String("anonymize", "", "print the input with IPs pseudonymized: cryptopan")
+	anonKey        = flag.String("key", "", "key for -anonymize")
+	replace        = flag.String("replace", "", "print the input with each IP replaced by this template")
+	mapFile        = flag.String("map-file", "", "print the input with IPs rewritten per this CSV mapping")
+	unmapped       = flag.String("unmapped", "keep", "with -map-file, keep or error on unmapped IPs")
+	inPlace        = flag.Bool("in-place", false, "with -redact, rewrite the input files instead of printing them")
+	backupSuffix   = flag.String("backup", "", "with -in-place, keep originals with this suffix")
+	withTimestamps = flag.Bool("with-timestamps", false, "print the timestamp on each result’s line")
+	follow         = flag.Bool("follow", false, "keep watching files for appended lines")
+	window         = flag.Duration("window", 0, "with -follow, periodically print the top IPs over this window")
+	topN           = flag.Int("top", 10, "number of IPs -window prints")
+	alertThreshold = flag.Int("alert-threshold", 0, "with -follow, alert when an IP is seen more than N times per -alert-window")
+	alertWindow    = flag.Duration("alert-window", time.Minute, "window for -alert-threshold")
+	alertAction    = flag.String("alert-action", "stderr", "alert action: stderr, webhook:URL, or exec:COMMAND")
+	feedRefresh    = flag.Duration("feed-refresh", time.Hour, "how often -follow re-downloads feeds")
+	afterContext   = flag.Int("after-context", 0, "with -output lines, print `N` lines of context after each match")
+	beforeContext  = flag.Int("before-context", 0, "with -output lines, print `N` lines of context before each match")
+	aroundContext  = flag.Int("context", 0, "with -output lines, print `N` lines of context around each match")
+	jobs           = flag.Int("jobs", 0, "maximum files scanned at once, or 0 for the number of CPUs usable")
+	useMmap        = flag.Bool("mmap", false, "scan regular files by mapping them into memory rather than reading them")
+	skipErrors     = flag.Bool("skip-errors", false, "report files that can’t be opened with the other errors and scan the rest")
+	maxTotal       = flag.Int("max-total", 0, "stop after `N` matches across all files")
+	timeout        = flag.Duration("timeout", 0, "give up on files not scanned within `D` of starting")
+	fileTimeout    = flag.Duration("file-timeout", 0, "give up on any file not scanned within `D` of opening it")
+	showProgress   = flag.Bool("progress", false, "report progress through the files on stderr")
+	verbose        = flag.Bool("verbose", false, "log the files read and how much was found in each to stderr")
+	debugLog       = flag.Bool("debug", false, "like -verbose, but also log rejected tokens and lookups")
+	cpuProfile     = flag.String("cpuprofile", "", "write a CPU profile to `FILE`")
+	memProfile     = flag.String("memprofile", "", "write a memory profile to `FILE` on exiting")
+	pprofAddr      = flag.String("pprof", "", "serve profiles over HTTP at `ADDR`, e.g. localhost:6060")
+	showVersion    = flag.Bool("version", false, "print version and build information")
+	tuiMode        = flag.Bool("tui", false, "browse the results interactively")
+	pick           = flag.Bool("pick", false, "choose among the unique results with a fuzzy finder and print those chosen")
+	listFiles      = flag.Bool("list-files", false, "print the files that would be scanned, without reading them, and exit")
+	count          = flag.Bool("count", false, "print only the number of matches in each file")
+	uniqueIPs      = flag.Bool("unique", false, "print each distinct IP only once per file")
+	filesWith      = flag.Bool("files-with-matches", false, "print only the names of files with results")
+	filesWithout   = flag.Bool("files-without-match", false, "print only the names of files without results")
+	quiet          = flag.Bool("quiet", false, "print nothing; exit 0 if any IPs are found and 1 otherwise")
+	colorMode      = flag.String("color", "auto", "color text output: auto, always, or never")
+	inputFormat    = flag.String("format", "", "read input in the format of `NAME`, e.g. nmap or accesslog:SPEC")
+	output         = flag.String("output", "text", "output format: text, json, lines, or csv")
+	cacheTTL       = flag.String("cache-ttl", "", "per-source cache TTL overrides")
+	noCache        = flag.Bool("no-cache", false, "bypass the lookup cache")
+	offline        = flag.Bool("offline", false, "use only stored feeds and cached lookups")
+	lookupJobs     = flag.Int("lookup-jobs", 16, "maximum concurrent network lookups")
+	lookupTimeout  = flag.Duration("lookup-timeout", 3*time.Second, "timeout for a single network lookup")
+)
+
+func init() {
+	flag.BoolVar(follow, "f", false, "shorthand for -follow")
+	flag.BoolVar(inPlace, "i", false, "shorthand for -in-place")
+	flag.BoolVar(quiet, "q", false, "shorthand for -quiet")
+	flag.BoolVar(count, "c", false, "shorthand for -count")
+	flag.BoolVar(uniqueIPs, "u", false, "shorthand for -unique")
+	flag.IntVar(jobs, "j", 0, "shorthand for -jobs")
+	flag.BoolVar(verbose, "v", false, "shorthand for -verbose")
+	flag.BoolVar(filesWith, "l", false, "shorthand for -files-with-matches")
+	flag.BoolVar(filesWithout, "L", false, "shorthand for -files-without-match")
+	flag.IntVar(afterContext, "A", 0, "shorthand for -after-context")
+	flag.IntVar(beforeContext, "B", 0, "shorthand for -before-context")
+	flag.IntVar(aroundContext, "C", 0, "shorthand for -context")
+	flag.Var(bothFlags{count, uniqueIPs}, "cu", "shorthand for -count -unique")
+	flag.Var(&enrichPlugins, "enrich-plugin", "annotate results using the external program `CMD`")
+	flag.Var(&maxMemory, "max-memory", "with -unique, the most memory to hold each file’s distinct IPs in before spilling them to disk")
+	flag.Var(&uniqueMemory, "unique-memory", "with -unique, the most memory to remember IPs with per file when streaming")
+	flag.Var(&sinks, "sink", "also send results, as JSON lines, to the stdin of `CMD`")
+}
+
 // scanResult stores the results of processing a single input file.
 type scanResult struct {
-	File string   // path to the input file.
-	IPs  []net.IP // list of IPs parsed from the file.
-	Err  error    // set if an I/O error occurs or the file is empty.
+	File  string       // path to the input file.
+	Group string       // with -group-by, the group’s name instead.
+	IPs   []netip.Addr // list of IPs parsed from the file.
+	// Times holds, with -timeline or -with-timestamps, the time found on
+	// each IP’s line, or the zero time if there was none.
+	Times []time.Time
+	// Matches holds, if provenance is needed, where each IP was found, and
+	// Source holds, with -output lines or -tui, the lines they were found on
+	// and any lines of context around them, by number.
+	Matches []ipgrep.Match
+	Source  map[int][]byte
+	Err     error // set if an I/O error occurs or the file is empty.
+	// Printed counts the IPs printed as they were found, when streaming,
+	// and so dropped from IPs.
+	Printed int
+	// Spilled holds, with -max-memory, the distinct IPs found, in place of
+	// IPs.
+	Spilled *spillSet
+}
+
+// found returns how many IPs were found, whether still held, printed, or
+// spilled.
+func (r *scanResult) found() int {
+	n := len(r.IPs) + r.Printed
+	if r.Spilled != nil {
+		n += r.Spilled.added()
+	}
+	return n
 }
 
 // Error satisfies the error interface.
@@ -57,114 +495,677 @@ func (r scanResult) Error() string {
 	return fmt.Sprintf("%v: %v", r.File, r.Err)
 }
 
-func main() {
-	if len(os.Args) < 2 {
-		help()
+// scanCommand implements “ipgrep [scan]”, scanning files for IPs.
+func scanCommand(args []string) {
+	flag.Usage = scanUsage
+	parseArgs(flag.CommandLine, args)
+	if *showVersion {
+		printVersion()
+		return
 	}
-	switch os.Args[1] {
-	case "-h", "-help", "--help":
+	if flag.NArg() < 1 {
 		help()
 	}
+	scanNames(flag.Args())
+}
+
+// scanNames scans the named inputs with the options given, as scanCommand
+// does the files it is given, and prints what it finds.
+func scanNames(names []string) {
+	if *onlyListed && !checkingFeeds() {
+		die("-only-listed requires -check-banlist or -check-feeds")
+	}
+	if *minAbuseScore > 0 && !*abuseIPDB {
+		die("-min-abuse-score requires -abuseipdb")
+	}
+	if *suppressNoise && !*greyNoise {
+		die("-suppress-noise requires -greynoise")
+	}
+	if err := setCacheTTLs(*cacheTTL); err != nil {
+		die(err)
+	}
+	if *slack < 0 {
+		die("-slack must not be negative")
+	}
+	printReport, ok := reports[*report]
+	if *report != "" && !ok {
+		die(fmt.Sprintf("unknown report %q", *report))
+	}
+	if *timeline != "" {
+		var err error
+		if timelineInterval, err = parseTimeline(*timeline); err != nil {
+			die(err)
+		}
+	}
+	var groupV4, groupV6 int
+	if *groupPrefix != "" {
+		var err error
+		if groupV4, groupV6, err = parseGroupPrefixes(*groupPrefix); err != nil {
+			die(err)
+		}
+	}
+	if *window < 0 || *window > 0 && !*follow {
+		die("-window requires -follow and a positive duration")
+	}
+	if *alertThreshold < 0 || *alertThreshold > 0 && !*follow {
+		die("-alert-threshold requires -follow and a positive count")
+	}
+	if *alertWindow <= 0 {
+		die("-alert-window must be positive")
+	}
+	if uniqueMemory > 0 && !*uniqueIPs {
+		die("-unique-memory requires -unique")
+	}
+	if *uniqueIPs && (*window > 0 || *alertThreshold > 0) {
+		die("-unique can’t be used with -window or -alert-threshold, which count repeats")
+	}
+	if *topN < 1 {
+		die("-top must be at least 1")
+	}
+	if *jobs < 0 {
+		die("-jobs must not be negative")
+	}
+	if *maxTotal < 0 {
+		die("-max-total must not be negative")
+	}
+	if *lookupJobs < 1 {
+		die("-lookup-jobs must be at least 1")
+	}
+	if err := setRewriter(); err != nil {
+		die(err)
+	}
+	if *inPlace && rewriteIP == nil {
+		die("-in-place requires -redact, -anonymize, -replace, or -map-file")
+	}
+	if (*tuiMode || *pick) && (*follow || *quiet || rewriteIP != nil) {
+		die("-tui and -pick can’t be used with -follow, -quiet, or when rewriting input")
+	}
+	if len(sinks) > 0 && (*follow || rewriteIP != nil || *tuiMode || *pick) {
+		die("-sink can’t be used with -follow, -tui, -pick, or when rewriting input")
+	}
+	if len(sinks) > 0 && *offline {
+		die("-sink can’t be used with -offline, which never touches the network")
+	}
+	if *quiet && (*follow || rewriteIP != nil) {
+		die("-quiet can’t be used with -follow or when rewriting input")
+	}
+	if *inputFormat != "" {
+		var err error
+		switch parser, err = ipgrep.ParserFor(*inputFormat); {
+		case err != nil:
+			die(fmt.Sprintf("invalid -format %q: %v", *inputFormat, err))
+		case parser == nil:
+			die(fmt.Sprintf("unknown -format %q: want %v", *inputFormat, strings.Join(ipgrep.Parsers(), ", ")))
+		}
+	}
+	if parser != nil {
+		// A command such as net reads the table it makes with a Parser,
+		// as -format does.
+		by := "-format"
+		if *inputFormat == "" {
+			by = parser.Name()
+		}
+		if *follow || rewriteIP != nil {
+			die(by + " can’t be used with -follow or when rewriting input")
+		}
+		if *afterContext > 0 || *beforeContext > 0 || *aroundContext > 0 {
+			die(by + " can’t be used with -after-context, -before-context, or -context")
+		}
+	}
+	if *backupSuffix != "" && !*inPlace {
+		die("-backup requires -in-place")
+	}
+	if _, ok := groupings[*groupBy]; !ok && *groupBy != "file" && *groupBy != "ip" {
+		die(fmt.Sprintf("unknown -group-by %q: want file, ip, version, classification, or none", *groupBy))
+	}
+	if (*groupBy != "file" || *intersectIPs) && *output == "lines" {
+		die("-group-by and -intersect can’t be used with -output lines, which shows each file’s lines")
+	}
+	if *follow && *output != "text" && *output != "json" {
+		die(fmt.Sprintf("-follow can’t be used with -output %v: want text or json", *output))
+	}
+	setColor(*colorMode)
+	setLogging()
+	startProfiling()
+	defer func() { stopProfiling() }()
+	f := ipgrep.LookupFormatter(*output)
+	if f == nil {
+		die(fmt.Sprintf("unknown output format %q: want %v", *output, strings.Join(ipgrep.Formatters(), ", ")))
+	}
+	printResults := formatWith(f)
+	if *output != "lines" && (*afterContext > 0 || *beforeContext > 0 || *aroundContext > 0) {
+		die("-after-context, -before-context, and -context require -output lines")
+	}
+	if *watchlist != "" {
+		var err error
+		if watched, err = loadWatchlist(*watchlist); err != nil {
+			die(err)
+		}
+	}
+	// Spilled IPs are merged only once every file is scanned, and are never
+	// all in memory for lookups and the like to go through.
+	if maxMemory > 0 && (!*uniqueIPs || uniqueMemory > 0 || *intersectIPs || *quiet || *pick || *tuiMode || enriching() || len(sinks) > 0 ||
+		!*count && (!streamable() || *classifyIPs || *withTimestamps)) {
+		die("-max-memory requires -unique, and either -count or text with nothing but IPs, and can’t be used with -unique-memory, -intersect, -quiet, -pick, -tui, lookups, or -sink")
+	}
+	if rewriteIP != nil {
+		if ipMapping != nil && *unmapped == "error" {
+			checkMapped(ipMapping, names)
+		}
+		if *inPlace {
+			rewriteInPlace(names, *backupSuffix)
+			return
+		}
+		rewriteFiles(names)
+		return
+	}
+	if *listFiles {
+		listInputs(names)
+		return
+	}
+	en := newEnricher()
+	if *follow {
+		followFiles(names, en)
+		return
+	}
+
+	if streamable() && maxMemory == 0 {
+		stream = newResultStream(len(names), !*classifyIPs && !*withTimestamps)
+	}
+	scanned, failed := scanFiles(names)
 
-	// If any of the input files cannot be read, quit with an error.
-	var files []*os.File
-	for _, fn := range os.Args[1:] {
-		fp, err := os.Open(fn)
+	if *intersectIPs {
+		common := &scanResult{
+			Group: fmt.Sprintf("results in all %d files", len(names)),
+			IPs:   intersect(scanned, len(names)),
+		}
+		scanned = []*scanResult{common}
+	}
+	if *uniqueIPs {
+		scanned = distinct(scanned)
+	}
+	if *tuiMode {
+		// Lookups are made on demand.
+		for _, r := range failed {
+			printError(r)
+		}
+		runTUI(scanned, en)
+		closeCache()
+		exitIfInterrupted()
+		return
+	}
+	ann := en.enrichAll(unique(scanned))
+	closeCache()
+	if ann != nil {
+		scanned = filter(scanned, func(ip netip.Addr) bool {
+			if !wanted(ann[ip]) {
+				logger.Debug("filtered out", "ip", ip)
+				return false
+			}
+			return true
+		})
+	}
+	if len(sinks) > 0 {
+		runSinks(scanned, ann)
+	}
+	switch {
+	case *quiet:
+		for _, r := range failed {
+			printError(r)
+		}
+		if watchlistHits(ann) > 0 {
+			exit(exitWatchlistHit)
+		}
+		if len(unique(scanned)) == 0 {
+			exitIfInterrupted() // the IPs may be in what wasn’t scanned.
+			exit(exitNoMatch)
+		}
+		return
+	case *pick:
+		pickIPs(unique(scanned), ann)
+	case *count:
+		printCounts(scanned)
+	case maxMemory > 0:
+		printSpilled(scanned)
+	case *filesWith:
+		printFileNames(scanned, true)
+	case *filesWithout:
+		printFileNames(scanned, false)
+	case *timeline != "":
+		tl, err := buildTimeline(scanned, timelineInterval)
 		if err != nil {
 			die(err)
 		}
-		files = append(files, fp)
+		printTimeline(tl)
+	case *summarizeIPs:
+		ips := unique(scanned)
+		printSummary(summarize(ips, *slack), len(ips))
+	case *groupPrefix != "":
+		printGroups(groupByPrefix(scanned, groupV4, groupV6))
+	case *byCountry:
+		printCountries(groupByCountry(scanned, ann))
+	case *byASN:
+		printASNs(groupByASN(scanned, ann))
+	case *report != "":
+		printReport(scanned)
+	case *intersectIPs:
+		printResults(scanned, ann)
+	case *groupBy == "ip":
+		printIPGroups(scanned, ann)
+	case *groupBy != "file":
+		printResults(regroup(scanned, groupings[*groupBy]), ann)
+	case stream != nil:
+		// Printed as they were found.
+	default:
+		printResults(scanned, ann)
 	}
+	if len(failed) > 0 {
+		// Counts and file names are meant for other programs, which
+		// shouldn’t have to skip a header.
+		if *output == "text" && !*count && !*filesWith && !*filesWithout {
+			fmt.Println("# errors:")
+		}
+		for _, r := range failed {
+			printError(r)
+		}
+	}
+	exitIfInterrupted()
+	if watchlistHits(ann) > 0 {
+		exit(exitWatchlistHit)
+	}
+	if status := failureStatus(failed); status != 0 {
+		exit(status)
+	}
+}
 
+// scanFiles scans the named files concurrently, at most -jobs at a time. It
+// returns the results for files scanned successfully, then those for files
+// that failed, each in the order they were named.
+//
+// If interrupted by SIGINT or SIGTERM, scanFiles returns what it has: files
+// not fully scanned fail with errInterrupted.
+func scanFiles(names []string) (scanned, failed []*scanResult) {
+	if *maxTotal > 0 {
+		budget = &matchBudget{left: int64(*maxTotal)}
+	}
+	if *showProgress {
+		meter = startProgress(names, time.Second)
+		defer meter.close()
+	}
+
+	// Stop on SIGINT or SIGTERM, keeping what has been found so far. Once the
+	// scans are done, signals work as usual again.
+	ctx, stop := cancelOnSignal(context.Background())
+	defer stop()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, *timeout,
+			&timeoutError{"-timeout", *timeout})
+		defer cancel()
+	}
+
+	// Each file is opened only when a worker is free to scan it, so no more
+	// than -jobs are open at once, and its results are stored at its index
+	// so they come out in argument order however the scans finish.
 	var (
-		results = make(chan *scanResult, len(files))
+		results = make([]*scanResult, len(names))
+		queue   = make(chan int)
 		wg      sync.WaitGroup
 	)
-	// Create a goroutine to scan and parse each input file, collecting the
-	// results in a channel.
-	for _, fp := range files {
+	// Other commands scan files too, without -jobs. GOMAXPROCS, unlike
+	// NumCPU, heeds a container’s CPU quota.
+	workers := *jobs
+	if workers == 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	// Leave room under the limit on open files for everything else open,
+	// and for files whose scans were given up on but whose reads hang on.
+	if limit := openFileLimit() / 2; limit > 0 && workers > limit {
+		logger.Info("limiting -jobs to half the open file limit", "jobs", limit)
+		workers = limit
+	}
+	if len(names) > 0 && len(names) < workers {
+		chunkJobs = workers / len(names)
+	}
+	for w := 0; w < workers && w < len(names); w++ {
 		wg.Add(1)
-		// TODO(princebot): Best practice would be to cap the number of
-		// goroutines this can launch, but this is just a simple little
-		// tool, and anyone calling it with hundreds of input files
-		// should prooooobably already be looking to fork/rewrite this
-		// if he wants it to be performant.
-		go func(fp *os.File) {
-			results <- scan(fp)
-			fp.Close()
-			wg.Done()
-		}(fp)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				results[i] = openAndScan(ctx, names[i], stream.file(i))
+				meter.finish(results[i])
+				stream.file(i).finish(results[i])
+			}
+		}()
+	}
+	for i := range names {
+		queue <- i
 	}
+	close(queue)
 	wg.Wait()
-	close(results)
 
-	var failed []*scanResult
-	for r := range results {
+	for _, r := range results {
 		// Show successfully extracted IPs first; display errors later.
 		if r.Err != nil {
+			if r.Spilled != nil {
+				r.Spilled.close()
+			}
 			failed = append(failed, r)
 			continue
 		}
-		fmt.Printf("# results for %v:\n", r.File)
-		for _, ip := range r.IPs {
-			fmt.Println(ip)
+		scanned = append(scanned, r)
+	}
+	return scanned, failed
+}
+
+// openAndScan opens and scans the named file, streaming its results to out
+// if it isn’t nil. If it cannot be opened, it
+// quits with an error — or, with -skip-errors, returns a result reporting it.
+// If ctx is done, or -file-timeout passes, before the scan is, the result
+// reports that instead.
+func openAndScan(ctx context.Context, name string, out *streamedFile) *scanResult {
+	if ctx.Err() != nil {
+		return &scanResult{File: name, Err: context.Cause(ctx)}
+	}
+	if *fileTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, *fileTimeout,
+			&timeoutError{"-file-timeout", *fileTimeout})
+		defer cancel()
+	}
+	// Open and scan in the background so that a call that never returns, as
+	// opening a FIFO with no writer does, can be abandoned.
+	done := make(chan *scanResult, 1)
+	go func() {
+		fp, err := openInput(name)
+		if err != nil {
+			if !*skipErrors {
+				printError(err)
+				exit(exitUnreadable)
+			}
+			// The result names the file, so its error needn’t.
+			if pe, ok := err.(*os.PathError); ok {
+				err = fmt.Errorf("%v: %w", pe.Op, pe.Err)
+			}
+			done <- &scanResult{File: name, Err: err}
+			return
+		}
+		defer fp.Close()
+		if fi, err := fp.Stat(); err == nil {
+			logger.Info("opened file", "file", name, "size", fi.Size())
 		}
-		fmt.Println()
+		done <- scan(ctx, name, fp, out)
+	}()
+	select {
+	case r := <-done:
+		return r
+	case <-ctx.Done():
+		return &scanResult{File: name, Err: context.Cause(ctx)}
 	}
-	if len(failed) > 0 {
-		fmt.Println("# errors:")
-		for _, r := range failed {
-			printError(r)
+}
+
+// openInput opens the named input for openAndScan: os.Open, unless a command
+// makes inputs of its own, as net does.
+var openInput = os.Open
+
+// parser is the Parser named by -format, if any, with which scan reads
+// input in place of looking for IPs in all of it.
+var parser ipgrep.Parser
+
+// errBudgetSpent stops a scan once -max-total matches are found.
+var errBudgetSpent = errors.New("-max-total reached")
+
+// scan reads fp, the input named name, splits its content in “words,” and
+// tests each word to see if it is a valid IPv4 or IPv6 address. It reads
+// the file as a stream, a line or a piece of one at a time, so that a file
+// of any size takes no more memory than its results do, and splits a big
+// file into pieces to scan at once when there are workers to spare. If
+// reading the file causes an I/O error, or if the file is empty,
+// *scanResult will have a non-nil Err field, as it will if ctx is done
+// before the scan is. Unless the file is split, the IPs found are streamed
+// to out as they are if it isn’t nil.
+func scan(ctx context.Context, name string, fp *os.File, out *streamedFile) *scanResult {
+	res := &scanResult{File: name}
+	if budget.spent() {
+		return res // -max-total matches were found elsewhere.
+	}
+	var (
+		lines  *lineKeeper
+		tokens int64
+		debug  = debugging()
+		opts   = []ipgrep.Option{ipgrep.WithSource(res.File)}
+	)
+	if *output == "lines" || *tuiMode {
+		lines = newLineKeeper()
+		res.Source = lines.kept
+	}
+	if maxMemory > 0 {
+		res.Spilled = newSpillSet(int64(maxMemory))
+	}
+	if parser != nil {
+		opts = append(opts, ipgrep.WithParser(parser))
+	}
+	if lines != nil || debug {
+		opts = append(opts, ipgrep.WithLines(func(n int, text []byte) {
+			if lines != nil {
+				lines.read(n, text)
+			}
+			if debug {
+				atomic.AddInt64(&tokens, int64(logTokens(res.File, text)))
+			}
+		}))
+	}
+	// Reading through meter lets -progress show headway through big files.
+	var (
+		r      = &meteredReader{r: fp}
+		mapped []byte
+	)
+	if *useMmap {
+		var unmap func() error
+		if mapped, unmap = mapInput(fp); mapped != nil {
+			defer unmap()
+			r.n = int64(len(mapped))
 		}
 	}
+	defer func() {
+		logger.Debug("tokens considered", "file", res.File, "tokens", tokens)
+		logger.Info("scanned file", "file", res.File, "bytes", r.n, "ips", res.found())
+	}()
+	var (
+		c   = newCollector(res, lines, mapped != nil, out)
+		err error
+	)
+	switch bounds := splitInput(fp, mapped, lines == nil && budget == nil && res.Spilled == nil && parser == nil); {
+	case bounds != nil:
+		r.n, err = scanChunks(ctx, fp, mapped, bounds, res, opts)
+	case mapped != nil:
+		err = ipgrep.ScanBytes(ctx, mapped, c.add, opts...)
+		meter.add(len(mapped) - int(c.metered))
+	default:
+		err = ipgrep.Scan(ctx, r, c.add, opts...)
+	}
+	switch {
+	case err != nil && err != errBudgetSpent:
+		res.Err = err
+	case r.n == 0:
+		res.Err = ipgrep.ErrEmptyInput
+	}
+	datedTimes(res.Times)
+	return res
+}
+
+// mapInput maps fp into memory for -mmap, returning its content and a
+// function that unmaps it, if it is a regular file that can be mapped, and
+// nil otherwise, in which case it is read as usual. Nothing kept from the
+// scan may refer to the content once it is unmapped.
+func mapInput(fp *os.File) ([]byte, func() error) {
+	fi, err := fp.Stat()
+	if err != nil || !fi.Mode().IsRegular() || fi.Size() == 0 || fi.Size() > math.MaxInt {
+		return nil, nil
+	}
+	b, unmap, err := mmapFile(fp, fi.Size())
+	if err != nil {
+		logger.Debug("not mapping file", "file", fp.Name(), "error", err)
+		return nil, nil
+	}
+	return b, unmap
+}
+
+// streamable reports whether results can be printed as they are found: as
+// text, needing no lookups, and with nothing else to be done across files.
+// In a table, as -classify and -with-timestamps print, they are printed a
+// file at a time, once each is scanned, so that its columns line up.
+func streamable() bool {
+	return *output == "text" && *groupBy == "file" && !enriching() && len(sinks) == 0 &&
+		!*intersectIPs && !*tuiMode && !*pick && !*quiet && !*count &&
+		!*filesWith && !*filesWithout && *timeline == "" && !*summarizeIPs &&
+		*groupPrefix == "" && !*byCountry && !*byASN && *report == ""
+}
+
+// provenance reports whether results must record where each IP was found,
+// as the output requested shows.
+func provenance() bool {
+	return *report == "by-ip" || *output != "text" || *tuiMode || len(sinks) > 0
+}
+
+// collector records each match of a scan in its result, having claimed it
+// from the -max-total budget.
+type collector struct {
+	res    *scanResult
+	lines  *lineKeeper   // if not nil, told of the line each match is on.
+	timed  bool          // whether to find the time on each match’s line.
+	keep   bool          // whether to keep the matches themselves.
+	mapped bool          // whether the input is mapped, and so passes the meter unread.
+	out    *streamedFile // if not nil, where each IP is streamed.
+
+	metered int64 // with mapped, how far the meter has been moved on.
+	line    int   // the line t was found on.
+	t       time.Time
+}
+
+func newCollector(res *scanResult, lines *lineKeeper, mapped bool, out *streamedFile) *collector {
+	timed := *timeline != "" || *withTimestamps
+	return &collector{res: res, lines: lines, timed: timed, keep: provenance(), mapped: mapped, out: out}
 }
 
-// split is used to divide file content into “words” that might be valid IP
-// addresses.
-func split(r rune) bool {
-	if unicode.IsSpace(r) || unicode.IsPunct(r) && r != '.' && r != ':' {
-		return true
+func (c *collector) add(m ipgrep.Match) error {
+	if budget.take(1) == 0 {
+		return errBudgetSpent
 	}
-	return false
+	if c.mapped {
+		meter.add(int(m.Offset - c.metered))
+		c.metered = m.Offset
+	}
+	if c.res.Spilled != nil {
+		c.res.Spilled.add(m.IP)
+		return nil
+	}
+	switch {
+	case c.lines != nil && parser != nil:
+		c.lines.keep(m.Line, m.Text) // a Parser reads ahead of its matches.
+	case c.lines != nil:
+		c.lines.matched(m.Line)
+	}
+	c.res.IPs = append(c.res.IPs, m.IP)
+	if c.timed {
+		if m.Line != c.line {
+			c.t, c.line = findTime(m.Text), m.Line
+		}
+		c.res.Times = append(c.res.Times, c.t)
+	}
+	if c.keep {
+		m.Text = nil // Source has it, if needed.
+		c.res.Matches = append(c.res.Matches, m)
+	}
+	c.out.found(c.res)
+	return nil
+}
+
+// meteredReader adds what is read from it to the -progress meter and counts
+// it.
+type meteredReader struct {
+	r io.Reader
+	n int64
+}
+
+func (m *meteredReader) Read(p []byte) (int, error) {
+	n, err := m.r.Read(p)
+	meter.add(n)
+	m.n += int64(n)
+	return n, err
 }
 
-// scan reads a file, splits its content in “words,” and tests each word to see
-// if it is a valid IPv4 or IPv6 address. If reading the file causes an I/O
-// error, or if the file is empty, *scanResult will have a non-nil Err field.
-func scan(fp *os.File) *scanResult {
+// unique returns each distinct IP found across results, in order of first
+// appearance.
+func unique(results []*scanResult) []netip.Addr {
 	var (
-		res = &scanResult{File: fp.Name()}
-		b   []byte
+		seen = make(map[netip.Addr]bool)
+		ips  []netip.Addr
 	)
-	if b, res.Err = ioutil.ReadAll(fp); res.Err != nil {
-		return res
-	}
-	if len(b) == 0 {
-		res.Err = fmt.Errorf("empty file")
-		return res
+	for _, r := range results {
+		for _, ip := range r.IPs {
+			if !seen[ip] {
+				seen[ip] = true
+				ips = append(ips, ip)
+			}
+		}
 	}
-	for _, word := range bytes.FieldsFunc(b, split) {
-		if ip := net.ParseIP(string(word)); ip != nil {
-			res.IPs = append(res.IPs, ip)
+	return ips
+}
+
+// filter returns a copy of results retaining only the IPs for which keep
+// returns true.
+func filter(results []*scanResult, keep func(netip.Addr) bool) []*scanResult {
+	out := make([]*scanResult, 0, len(results))
+	for _, r := range results {
+		fr := &scanResult{File: r.File, Group: r.Group, Source: r.Source, Err: r.Err, Printed: r.Printed}
+		for i, ip := range r.IPs {
+			if keep(ip) {
+				fr.IPs = append(fr.IPs, ip)
+				if r.Times != nil {
+					fr.Times = append(fr.Times, r.Times[i])
+				}
+				if r.Matches != nil {
+					fr.Matches = append(fr.Matches, r.Matches[i])
+				}
+			}
 		}
+		out = append(out, fr)
 	}
-	return res
+	return out
+}
+
+// scanUsage prints the main usage message.
+func scanUsage() {
+	fmt.Fprintf(os.Stderr, usage, prog, configPath("feeds.json"), configPath(""), cacheDir(), configFile())
 }
 
 func help() {
-	fmt.Fprintf(os.Stderr, usage, prog)
-	os.Exit(0)
+	flag.Usage()
+	exit(0)
 }
 
 func printError(errMsg interface{}) {
+	// With JSON output, so are errors, for programs to act on.
+	if *output == "json" {
+		printJSONError(errMsg)
+		return
+	}
 	var (
 		stderr = colorable.NewColorableStderr()
-		red    = color.New(color.FgRed).SprintfFunc()
+		red    = color.New(color.FgRed)
 	)
-	fmt.Fprintf(stderr, red("\n%v: error: %v\n", prog, errMsg))
+	// Errors are colored only if stderr itself is a terminal, so escapes
+	// don’t end up in logs it was redirected to.
+	if useColor(os.Stderr) {
+		red.EnableColor()
+	} else {
+		red.DisableColor()
+	}
+	fmt.Fprint(stderr, red.Sprintf("\n%v: error: %v\n", prog, errMsg))
 }
 
 func die(errMsg interface{}) {
 	printError(errMsg)
-	os.Exit(1)
+	exit(exitError)
 }
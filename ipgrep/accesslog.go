@@ -0,0 +1,275 @@
+package ipgrep
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"strings"
+)
+
+// defaultAccessLog is the format an accessLogParser reads unless told
+// otherwise: nginx’s “main” log format, which is Apache’s “combined” with the
+// X-Forwarded-For header after it, so that lines in either parse, as do
+// those in the Common Log Format of which both are extensions.
+const defaultAccessLog = `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent" "$http_x_forwarded_for"`
+
+// accessLogFields maps the directives of Apache’s LogFormat, without their
+// “%”, and the variables of nginx’s log_format, without their “$”, to what an
+// accessLogParser calls the fields they log, if it has a use for them.
+var accessLogFields = map[string]string{
+	"h":                         "remote_addr",
+	"a":                         "remote_addr",
+	"{c}a":                      "remote_addr",
+	"remote_addr":               "remote_addr",
+	"{x-forwarded-for}i":        "x_forwarded_for",
+	"http_x_forwarded_for":      "x_forwarded_for",
+	"proxy_add_x_forwarded_for": "x_forwarded_for",
+	"t":                         "time",
+	"time_local":                "time",
+	"time_iso8601":              "time",
+	"r":                         "request",
+	"request":                   "request",
+	"s":                         "status",
+	">s":                        "status",
+	"<s":                        "status",
+	"status":                    "status",
+	"b":                         "bytes",
+	"B":                         "bytes",
+	"body_bytes_sent":           "bytes",
+	"{user-agent}i":             "user_agent",
+	"http_user_agent":           "user_agent",
+	"{referer}i":                "referer",
+	"http_referer":              "referer",
+	"v":                         "host",
+	"host":                      "host",
+	"server_name":               "host",
+}
+
+// accessLogContext names the fields given as the context of a client.
+var accessLogContext = []string{"time", "request", "status", "bytes", "host"}
+
+// accessLogParser reads web server access logs in a format given as
+// Apache’s LogFormat or nginx’s log_format would, finding on each line the
+// address of the client: that of the first host named by the X-Forwarded-For
+// header, if it was logged and there is one — the client as the proxies it
+// passed through have it — in the field "x_forwarded_for", or else that of
+// the peer, in "remote_addr". Its context is the line’s "time", "request",
+// "status", "bytes", and "host", where the format has them, and, if the
+// client was forwarded, the "remote_addr" it was forwarded by and the whole
+// "x_forwarded_for" chain.
+type accessLogParser struct {
+	parts []logPart
+}
+
+// logPart is a part of an access log format: either text given as it is, or
+// a field, any text up to the next part, named as in accessLogFields.
+type logPart struct {
+	text  string
+	field string
+	isVar bool
+}
+
+func (p *accessLogParser) Name() string { return "accesslog" }
+
+// Specify returns a Parser of access logs in format, with Apache’s LogFormat
+// directives, as "%h %l %u %t \"%r\" %>s %b", or nginx’s log_format variables,
+// as "$remote_addr [$time_local] \"$request\"".
+func (p *accessLogParser) Specify(format string) (Parser, error) {
+	return newAccessLogParser(format)
+}
+
+func newAccessLogParser(format string) (*accessLogParser, error) {
+	var (
+		p       = &accessLogParser{}
+		text    strings.Builder
+		address bool
+	)
+	for i := 0; i < len(format); i++ {
+		var name string
+		switch c := format[i]; {
+		case c == '%' && i+1 < len(format) && format[i+1] == '%':
+			text.WriteByte('%')
+			i++
+			continue
+		case c == '%':
+			// %[<>!0-9,]*[{...}]letter, as in %>s or %{User-Agent}i.
+			j := i + 1
+			for j < len(format) && strings.IndexByte("<>!0123456789,", format[j]) >= 0 {
+				j++
+			}
+			mods := strings.Trim(format[i+1:j], "!0123456789,")
+			if j < len(format) && format[j] == '{' {
+				k := strings.IndexByte(format[j:], '}')
+				if k < 0 {
+					return nil, fmt.Errorf("unterminated %q", format[i:])
+				}
+				mods += strings.ToLower(format[j : j+k+1])
+				j += k + 1
+			}
+			if j >= len(format) {
+				return nil, fmt.Errorf("incomplete %q", format[i:])
+			}
+			name, i = mods+format[j:j+1], j
+		case c == '$':
+			// $name or ${name}.
+			j := i + 1
+			if j < len(format) && format[j] == '{' {
+				k := strings.IndexByte(format[j:], '}')
+				if k < 0 {
+					return nil, fmt.Errorf("unterminated %q", format[i:])
+				}
+				name, i = format[j+1:j+k], j+k
+				break
+			}
+			for j < len(format) && isVarByte(format[j]) {
+				j++
+			}
+			if j == i+1 {
+				text.WriteByte(c)
+				continue
+			}
+			name, i = format[i+1:j], j-1
+		default:
+			text.WriteByte(c)
+			continue
+		}
+		if text.Len() > 0 {
+			p.parts = append(p.parts, logPart{text: text.String()})
+			text.Reset()
+		} else if n := len(p.parts); n > 0 && p.parts[n-1].isVar {
+			return nil, errors.New("two fields with nothing between them can’t be told apart")
+		}
+		field := accessLogFields[name]
+		if field == "remote_addr" || field == "x_forwarded_for" {
+			address = true
+		}
+		p.parts = append(p.parts, logPart{field: field, isVar: true})
+	}
+	if text.Len() > 0 {
+		p.parts = append(p.parts, logPart{text: text.String()})
+	}
+	if !address {
+		return nil, errors.New("no field of the client’s address, such as %h or $remote_addr")
+	}
+	return p, nil
+}
+
+func isVarByte(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+func (p *accessLogParser) Parse(r io.Reader, emit func(Match) error) error {
+	return readLines(r, func(n int, off int64, line []byte) error {
+		if m, ok := p.client(string(line), n, off); ok {
+			m.Text = append([]byte(nil), line...)
+			return emit(m)
+		}
+		return nil
+	})
+}
+
+// logValue is the value of a field on a line, and where on it it begins.
+type logValue struct {
+	text string
+	col  int
+}
+
+// fields returns the values of the fields of the format on line, as far as
+// it has the format, which may not be all the way. A field runs to the next
+// part of the format, or, if it is quoted, to the next of that part after a
+// quote that isn’t escaped; one that begins with “[” runs to the next “]”,
+// as Apache’s %t does.
+func (p *accessLogParser) fields(line string) map[string]logValue {
+	vals := make(map[string]logValue)
+	pos := 0
+	for i, part := range p.parts {
+		if !part.isVar {
+			if !strings.HasPrefix(line[pos:], part.text) {
+				break // as in a line with fewer fields.
+			}
+			pos += len(part.text)
+			continue
+		}
+		end := len(line)
+		switch {
+		case strings.HasPrefix(line[pos:], "[") && part.field == "time":
+			if j := strings.IndexByte(line[pos:], ']'); j >= 0 {
+				end = pos + j + 1
+			}
+		case i+1 < len(p.parts):
+			next := p.parts[i+1].text
+			quoted := i > 0 && strings.HasSuffix(p.parts[i-1].text, `"`)
+			for k := pos; ; {
+				j := strings.Index(line[k:], next)
+				if j < 0 {
+					break
+				}
+				if quoted && j > 0 && line[k+j-1] == '\\' {
+					k += j + 1
+					continue
+				}
+				end = k + j
+				break
+			}
+		}
+		if part.field != "" {
+			vals[part.field] = logValue{line[pos:end], pos}
+		}
+		pos = end
+	}
+	return vals
+}
+
+// client returns the match of the client on line n, which begins at off.
+func (p *accessLogParser) client(line string, n int, off int64) (Match, bool) {
+	var (
+		vals  = p.fields(line)
+		peer  = vals["remote_addr"]
+		xff   = vals["x_forwarded_for"]
+		m     Match
+		found bool
+	)
+	// The chain is the client, then each proxy but the last; take the first
+	// that is an address, skipping any such as “unknown”.
+	col := xff.col
+	for _, hop := range strings.Split(xff.text, ",") {
+		if ip, text, ok := forwardedAddr(strings.TrimSpace(hop)); ok {
+			m = fieldMatch(ip, text, "x_forwarded_for", n, off, col+strings.Index(hop, text))
+			found = true
+			break
+		}
+		col += len(hop) + 1
+	}
+	if found {
+		m.Context = map[string]string{"x_forwarded_for": xff.text}
+		if peer.text != "" {
+			m.Context["remote_addr"] = peer.text
+		}
+	} else if ip, ok := ParseIP([]byte(peer.text)); ok {
+		m = fieldMatch(ip, peer.text, "remote_addr", n, off, peer.col)
+		m.Context = make(map[string]string)
+	} else {
+		return Match{}, false
+	}
+	for _, k := range accessLogContext {
+		if v := vals[k].text; v != "" && v != "-" {
+			m.Context[k] = strings.Trim(v, "[]")
+		}
+	}
+	return m, true
+}
+
+// forwardedAddr parses a host as X-Forwarded-For gives it, an address with
+// or without a port, returning it and its text without the port.
+func forwardedAddr(s string) (netip.Addr, string, bool) {
+	if ip, ok := ParseIP([]byte(s)); ok {
+		return ip, s, true
+	}
+	if ap, err := netip.ParseAddrPort(s); err == nil {
+		text := strings.TrimPrefix(s[:strings.LastIndexByte(s, ':')], "[")
+		text = strings.TrimSuffix(text, "]")
+		return ap.Addr().Unmap(), text, true
+	}
+	return netip.Addr{}, "", false
+}
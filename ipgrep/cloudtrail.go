@@ -0,0 +1,240 @@
+package ipgrep
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+)
+
+// cloudTrailContext names the fields of an event given as the context of
+// each address in it.
+var cloudTrailContext = map[string]bool{
+	"eventTime":        true,
+	"eventName":        true,
+	"eventSource":      true,
+	"awsRegion":        true,
+	"userIdentity.arn": true,
+	"errorCode":        true,
+}
+
+// cloudTrailParser reads AWS CloudTrail events: the log files CloudTrail
+// delivers, each an object whose "Records" are the events; the output of
+// “aws cloudtrail lookup-events”, whose "Events" each hold one as a string,
+// as "CloudTrailEvent"; or events given one after another, or in an array.
+// Each string in an event that is an address is a match in the field its
+// path names, as walkJSON gives it, not just the "sourceIPAddress" but those
+// in, say, "responseElements.networkInterface.privateIpAddress", in the
+// context of the event’s "eventTime", "eventName", "eventSource",
+// "awsRegion", "userIdentity.arn", and "errorCode". Its Text is the part of
+// its line in the event, as a file of events on one line would be too long.
+type cloudTrailParser struct{}
+
+func (cloudTrailParser) Name() string { return "cloudtrail" }
+
+func (cloudTrailParser) Parse(r io.Reader, emit func(Match) error) error {
+	var (
+		in = &lineIndex{r: r}
+		d  = json.NewDecoder(in)
+	)
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch tok {
+		case json.Delim('['):
+			err = cloudTrailEvents(d, in, emit)
+		case json.Delim('{'):
+			err = cloudTrailObject(d, in, emit)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// cloudTrailObject reads the rest of an object from d, whose opening brace
+// it follows: one with "Records" or "Events", whose events are emitted as
+// they come, or else an event itself, kept whole until it ends.
+func cloudTrailObject(d *json.Decoder, in *lineIndex, emit func(Match) error) error {
+	off := d.InputOffset() - 1
+	in.keep(d)
+	defer in.drop()
+	var events bool
+	for d.More() {
+		tok, err := d.Token()
+		if err != nil {
+			return err
+		}
+		if k, _ := tok.(string); k == "Records" || k == "Events" {
+			if tok, err = d.Token(); err != nil {
+				return err
+			}
+			if tok == json.Delim('[') {
+				in.drop()
+				if err := cloudTrailEvents(d, in, emit); err != nil {
+					return err
+				}
+				events = true
+			} else if err := skipJSON(d, tok); err != nil {
+				return err
+			}
+			continue
+		}
+		var v json.RawMessage
+		if err := d.Decode(&v); err != nil {
+			return err
+		}
+	}
+	if _, err := d.Token(); err != nil { // the closing brace.
+		return err
+	}
+	if events {
+		return nil
+	}
+	return in.emitEvent(jsonEvent{raw: in.kept[:d.InputOffset()-off], off: off}, emit)
+}
+
+// cloudTrailEvents reads the rest of an array of events from d, each of
+// which may be held as a string in a "CloudTrailEvent", emitting each in turn.
+func cloudTrailEvents(d *json.Decoder, in *lineIndex, emit func(Match) error) error {
+	for d.More() {
+		var raw json.RawMessage
+		if err := d.Decode(&raw); err != nil {
+			return err
+		}
+		e := jsonEvent{raw: raw, off: d.InputOffset() - int64(len(raw))}
+		var lookup struct {
+			CloudTrailEvent string
+		}
+		if json.Unmarshal(raw, &lookup) == nil && lookup.CloudTrailEvent != "" {
+			e.inner = []byte(lookup.CloudTrailEvent)
+		}
+		if err := in.emitEvent(e, emit); err != nil {
+			return err
+		}
+	}
+	_, err := d.Token() // the closing bracket.
+	return err
+}
+
+// jsonEvent is an event read as JSON, found at off in the input, and, if it
+// is held as a string, the event that string holds.
+type jsonEvent struct {
+	raw   []byte
+	off   int64
+	inner []byte
+}
+
+// skipJSON reads from d the rest of the value that began with tok.
+func skipJSON(d *json.Decoder, tok json.Token) error {
+	for depth := 0; ; {
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+		if depth == 0 {
+			return nil
+		}
+		var err error
+		if tok, err = d.Token(); err != nil {
+			return err
+		}
+	}
+}
+
+// emitEvent emits the addresses in e, which share its context. An address
+// in an event held as a string points to the string.
+func (in *lineIndex) emitEvent(e jsonEvent, emit func(Match) error) error {
+	in.at(e.off) // forgetting the lines before it, in case it has no matches.
+	b, at := e.raw, 0
+	if e.inner != nil {
+		b = e.inner
+		if i := bytes.Index(e.raw, []byte(`"CloudTrailEvent"`)); i >= 0 {
+			i += len(`"CloudTrailEvent"`)
+			at = i + bytes.IndexByte(e.raw[i:], '"')
+		}
+	}
+	ctx := make(map[string]string)
+	addrs, err := jsonAddrs(b, "", cloudTrailContext, ctx)
+	if err != nil {
+		return nil // an event held in a string that isn’t JSON.
+	}
+	for _, a := range addrs {
+		col := a.col
+		if e.inner != nil {
+			col = at
+		}
+		off := e.off + int64(col)
+		n, start := in.at(off)
+		m := fieldMatch(a.ip, a.text, a.path, n, start, int(off-start))
+		m.Text, m.Context = lineAt(e.raw, col), ctx
+		if err := emit(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lineAt returns a copy of the line of b that col, counting from 0, is on.
+func lineAt(b []byte, col int) []byte {
+	start := bytes.LastIndexByte(b[:col], '\n') + 1
+	end := len(b)
+	if i := bytes.IndexByte(b[col:], '\n'); i >= 0 {
+		end = col + i
+	}
+	return append([]byte(nil), bytes.TrimSuffix(b[start:end], []byte("\r"))...)
+}
+
+// lineIndex is the input of a Parser that reads ahead of the matches it
+// finds, as a json.Decoder does, keeping where the lines read end until at
+// has passed them, so that the line of a match can be found from its offset.
+type lineIndex struct {
+	r     io.Reader
+	read  int64
+	ends  []int64 // the offsets of the newlines read that at hasn’t passed.
+	line  int     // the lines before start.
+	start int64   // where the line that at last found begins.
+	kept  []byte  // what has been read since keep, until drop.
+}
+
+// keep keeps what is read from now on, from just past where d has got to,
+// which must be just past an opening brace, “{” and all.
+func (in *lineIndex) keep(d *json.Decoder) {
+	in.kept = []byte("{")
+	b, _ := io.ReadAll(d.Buffered())
+	in.kept = append(in.kept, b...)
+}
+
+// drop stops keeping what is read.
+func (in *lineIndex) drop() { in.kept = nil }
+
+func (in *lineIndex) Read(p []byte) (int, error) {
+	n, err := in.r.Read(p)
+	for i, c := range p[:n] {
+		if c == '\n' {
+			in.ends = append(in.ends, in.read+int64(i))
+		}
+	}
+	if in.kept != nil {
+		in.kept = append(in.kept, p[:n]...)
+	}
+	in.read += int64(n)
+	return n, err
+}
+
+// at returns the number, from 1, of the line that off is on, and the offset
+// at which it begins. off must be no less than that given before.
+func (in *lineIndex) at(off int64) (int, int64) {
+	for len(in.ends) > 0 && in.ends[0] < off {
+		in.start = in.ends[0] + 1
+		in.line++
+		in.ends = in.ends[1:]
+	}
+	return in.line + 1, in.start
+}
@@ -0,0 +1,83 @@
+package ipgrep
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+)
+
+// Errors returned by ScanFile, wrapped in an *OpenError or *ReadError, for
+// use with errors.Is.
+var (
+	ErrEmptyInput  = errors.New("empty input")
+	ErrIsDirectory = errors.New("is a directory")
+)
+
+// OpenError records a file that couldn’t be opened for scanning.
+type OpenError struct {
+	Name string
+	Err  error
+}
+
+func (e *OpenError) Error() string { return "open " + e.Name + ": " + e.Err.Error() }
+func (e *OpenError) Unwrap() error { return e.Err }
+
+// ReadError records a file that couldn’t be read to its end, including one
+// that was empty.
+type ReadError struct {
+	Name string
+	Err  error
+}
+
+func (e *ReadError) Error() string { return "read " + e.Name + ": " + e.Err.Error() }
+func (e *ReadError) Unwrap() error { return e.Err }
+
+// ScanFile is like Scan, but it reads the named file, and an error in
+// opening or reading it is an *OpenError or *ReadError. A directory can’t
+// be opened, with ErrIsDirectory; a file with nothing in it can’t be read,
+// with ErrEmptyInput. Errors from fn and ctx are returned as they are.
+func ScanFile(ctx context.Context, name string, fn func(Match) error, opts ...Option) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return &OpenError{Name: name, Err: unwrapPath(err)}
+	}
+	defer f.Close()
+	if fi, err := f.Stat(); err == nil && fi.IsDir() {
+		return &OpenError{Name: name, Err: ErrIsDirectory}
+	}
+	r := &countingReader{r: f}
+	var fnErr error
+	err = Scan(ctx, r, func(m Match) error {
+		fnErr = fn(m)
+		return fnErr
+	}, append([]Option{WithSource(name)}, opts...)...)
+	switch {
+	case err == nil && r.n == 0:
+		return &ReadError{Name: name, Err: ErrEmptyInput}
+	case err == nil, err == fnErr, ctx.Err() != nil && err == context.Cause(ctx):
+		return err
+	}
+	return &ReadError{Name: name, Err: unwrapPath(err)}
+}
+
+// unwrapPath strips an *os.PathError, which would name the file again.
+func unwrapPath(err error) error {
+	var pe *os.PathError
+	if errors.As(err, &pe) {
+		return pe.Err
+	}
+	return err
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,45 @@
+package ipgrep
+
+import (
+	"bytes"
+	"io"
+)
+
+// eveContext names the fields of a Suricata EVE event given as the context
+// of each address in it.
+var eveContext = map[string]bool{
+	"timestamp":       true,
+	"event_type":      true,
+	"proto":           true,
+	"app_proto":       true,
+	"src_port":        true,
+	"dest_port":       true,
+	"alert.action":    true,
+	"alert.signature": true,
+	"alert.category":  true,
+	"alert.severity":  true,
+}
+
+// eveParser reads Suricata’s EVE JSON output, an event to a line, such as
+// eve.json. Each address is a match in the field it is the value of, named
+// by its path, as "src_ip", "dest_ip", or "dns.answers.rdata", in the context
+// of the event’s "timestamp", "event_type", "proto", "app_proto", ports, and,
+// for an alert, its "alert.action", "alert.signature", "alert.category",
+// and "alert.severity".
+type eveParser struct{}
+
+func (eveParser) Name() string { return "eve" }
+
+func (eveParser) Parse(r io.Reader, emit func(Match) error) error {
+	return readLines(r, func(n int, off int64, line []byte) error {
+		if !bytes.HasPrefix(bytes.TrimLeft(line, " \t"), []byte("{")) {
+			return nil
+		}
+		for _, m := range jsonLine(line, n, off, eveContext) {
+			if err := emit(m); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,98 @@
+package ipgrep
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+	"sync"
+)
+
+// Artifact is something an Extractor found in text.
+type Artifact struct {
+	Kind   string // the Name of the Extractor that found it, e.g. "ip".
+	Text   string // as it appeared.
+	Value  any    // its parsed form, if the Extractor has one: a netip.Addr for "ip".
+	Offset int    // where it begins in the text given to Extract.
+}
+
+// Extractor finds artifacts of one kind in text. Extract is given a line, or
+// a piece of a long one ending between words, and returns what it finds in
+// the order it appears; it may be called from more than one goroutine.
+type Extractor interface {
+	Name() string
+	Extract(b []byte) []Artifact
+}
+
+// IPs is the built-in Extractor of IP addresses, named "ip", which a
+// Scanner uses unless told otherwise.
+var IPs Extractor = ipExtractor{}
+
+type ipExtractor struct{}
+
+func (ipExtractor) Name() string { return "ip" }
+
+func (ipExtractor) Extract(b []byte) []Artifact {
+	c := newConfig(nil)
+	return c.extractIPs(b)
+}
+
+var (
+	extractorsMu sync.RWMutex
+	extractors   = map[string]Extractor{"ip": IPs}
+)
+
+// Register makes e available by its name to Lookup, so that programs can
+// offer it alongside the built-in IP Extractor, as by a command-line option.
+// It panics if an Extractor of that name is registered already.
+func Register(e Extractor) {
+	extractorsMu.Lock()
+	defer extractorsMu.Unlock()
+	if _, ok := extractors[e.Name()]; ok {
+		panic(fmt.Sprintf("ipgrep: Register called twice for extractor %q", e.Name()))
+	}
+	extractors[e.Name()] = e
+}
+
+// Lookup returns the Extractor registered with name, or nil if there is
+// none.
+func Lookup(name string) Extractor {
+	extractorsMu.RLock()
+	defer extractorsMu.RUnlock()
+	return extractors[name]
+}
+
+// Extractors returns the names of the registered Extractors, sorted.
+func Extractors() []string {
+	extractorsMu.RLock()
+	defer extractorsMu.RUnlock()
+	names := make([]string, 0, len(extractors))
+	for name := range extractors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// extract runs the Scanner’s Extractors over b. The IP one follows the
+// Scanner’s Options.
+func (s *Scanner) extract(b []byte) []Artifact {
+	es := s.cfg.extractors
+	if es == nil {
+		es = []Extractor{IPs}
+	}
+	var found []Artifact
+	for _, e := range es {
+		if e != IPs {
+			found = append(found, e.Extract(b)...)
+			continue
+		}
+		found = append(found, s.cfg.extractIPs(b)...)
+	}
+	return found
+}
+
+// ip returns a’s IP address, or the zero Addr if it isn’t one.
+func (a Artifact) ip() netip.Addr {
+	ip, _ := a.Value.(netip.Addr)
+	return ip
+}
@@ -0,0 +1,441 @@
+package ipgrep
+
+import (
+	"encoding/binary"
+	"io"
+	"math/bits"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// firewallParser reads firewall rulesets: iptables-save’s output, or a
+// script of iptables commands; nftables’, as nft list ruleset prints them;
+// and pf.conf. Each address a rule matches or translates to is a match, and
+// each network, as 10.0.0.0/8, a match of the kind "cidr", with its first
+// address as its IP, in the field its option or keyword names, as "source"
+// and "destination" for -s and -d, "saddr" and "daddr", "from" and "to", or
+// "dnat" and "rdr-to", in the context of its rule’s "action", as ACCEPT,
+// drop, or pass, and its "table" and "chain", or, for pf, its "direction".
+// The elements of nft’s sets are in the field "elements", in the context of
+// their "set", and the addresses of pf’s tables in the field "table".
+type firewallParser struct{}
+
+func (firewallParser) Name() string { return "firewall" }
+
+func (firewallParser) Parse(r io.Reader, emit func(Match) error) error {
+	fw := &firewall{emit: emit}
+	if err := readLines(r, fw.line); err != nil {
+		return err
+	}
+	return fw.flush()
+}
+
+// firewallSyntax is which of the rulesets firewallParser reads a rule is
+// written for.
+type firewallSyntax int
+
+const (
+	iptablesSyntax firewallSyntax = iota
+	nftSyntax
+	pfSyntax
+)
+
+var (
+	// nftVerdicts are the statements of nft that say what becomes of a
+	// packet, but jump and goto, which name a chain as well.
+	nftVerdicts = map[string]bool{
+		"accept": true, "drop": true, "reject": true, "queue": true,
+		"continue": true, "return": true, "dnat": true, "snat": true,
+		"masquerade": true, "redirect": true, "notrack": true,
+	}
+
+	// nftCommands are the commands of nft scripts, as “add rule inet
+	// filter input ip saddr 10.0.0.1 drop”, which rulesets may be
+	// written as instead of blocks.
+	nftCommands = map[string]bool{
+		"add": true, "insert": true, "replace": true, "create": true,
+		"define": true, "flush": true, "delete": true,
+	}
+
+	// nftFamilies are the address families of nft’s tables.
+	nftFamilies = map[string]bool{
+		"ip": true, "ip6": true, "inet": true, "arp": true,
+		"bridge": true, "netdev": true,
+	}
+
+	// pfActions are the words pf’s rules begin with.
+	pfActions = map[string]bool{
+		"pass": true, "block": true, "match": true, "rdr": true, "nat": true,
+		"binat": true, "antispoof": true, "scrub": true,
+	}
+
+	// firewallComments are the options and keywords whose quoted values are
+	// comments, which may hold anything.
+	firewallComments = map[string]bool{
+		"--comment": true, "comment": true, "label": true,
+		"description": true, "--log-prefix": true, "prefix": true,
+	}
+)
+
+// firewall is what firewallParser knows as it reads a ruleset: the rule it
+// is reading, which may go on for lines, and where in the ruleset it is.
+type firewall struct {
+	emit   func(Match) error
+	table  string     // the table of iptables-save’s output, as *filter begins it.
+	blocks []nftBlock // nft’s blocks open, outermost first.
+	lists  int        // the braces open in nft’s rule, as of a set going on for lines.
+
+	syntax firewallSyntax
+	more   bool   // whether the rule goes on past the line.
+	key    string // the last word of the rule, which names the next address’s field.
+	field  string // the field of all the rule’s addresses, if its syntax says.
+	ms     []Match
+	ctx    map[string]string
+}
+
+// nftBlock is a block of an nft ruleset, as “chain input {” opens: a table,
+// chain, set, or map, and its name.
+type nftBlock struct {
+	kind, name string
+}
+
+// line reads line n of the ruleset, which begins at off.
+func (fw *firewall) line(n int, off int64, line []byte) error {
+	code := string(line)
+	if i := firewallComment(code); i >= 0 {
+		code = code[:i]
+	}
+	code = strings.TrimRight(code, " \t\r")
+	var (
+		toks   = firewallTokens(code)
+		opened bool
+		text   = append([]byte(nil), line...)
+	)
+	if !fw.more {
+		opened = fw.start(code, toks)
+	}
+	for _, t := range toks {
+		as := firewallAddrs(t)
+		if as == nil {
+			fw.word(t.text)
+			continue
+		}
+		for _, a := range as {
+			m := fieldMatch(a.ip, a.text, fw.fieldName(), n, off, a.col)
+			if a.net.IsValid() {
+				m.Artifact.Kind, m.Artifact.Value = "cidr", a.net
+			}
+			m.Text = text
+			fw.ms = append(fw.ms, m)
+		}
+	}
+	if fw.syntax == nftSyntax {
+		opens, closes := strings.Count(code, "{"), strings.Count(code, "}")
+		if opened {
+			opens--
+		}
+		for fw.lists += opens - closes; fw.lists < 0; fw.lists++ {
+			if len(fw.blocks) > 0 {
+				fw.blocks = fw.blocks[:len(fw.blocks)-1]
+			}
+		}
+	}
+	fw.more = fw.lists > 0 || strings.HasSuffix(code, `\`)
+	// A set’s elements and a definition, unlike a rule, have no action to
+	// wait for, however many lines they go on for.
+	if fw.more && fw.field == "" && fw.ctx["set"] == "" {
+		return nil
+	}
+	return fw.flush()
+}
+
+// start begins a rule with the line code, split into toks, reporting
+// whether it opens an nft block.
+func (fw *firewall) start(code string, toks []logValue) bool {
+	fw.ms, fw.ctx, fw.key, fw.field = nil, make(map[string]string), "", ""
+	word := func(i int) string {
+		if i < len(toks) {
+			return toks[i].text
+		}
+		return ""
+	}
+	kind, name, opens := nftOpener(code)
+	switch first := word(0); {
+	case strings.HasPrefix(first, "*"):
+		fw.syntax, fw.table = iptablesSyntax, first[1:]
+	case first == "COMMIT":
+		fw.syntax, fw.table = iptablesSyntax, ""
+	case strings.HasPrefix(first, "-") || strings.HasPrefix(first, ":"):
+		fw.syntax = iptablesSyntax
+		if fw.table != "" {
+			fw.ctx["table"] = fw.table
+		}
+	case strings.HasPrefix(first, "iptables") || strings.HasPrefix(first, "ip6tables"):
+		fw.syntax = iptablesSyntax
+		fw.ctx["table"] = "filter" // unless -t says otherwise.
+	case len(fw.blocks) > 0 || opens || nftCommands[first]:
+		fw.syntax = nftSyntax
+		if opens {
+			fw.blocks = append(fw.blocks, nftBlock{kind, name})
+		}
+		for _, b := range fw.blocks {
+			switch b.kind {
+			case "table", "chain":
+				fw.ctx[b.kind] = b.name
+			case "set", "map":
+				fw.ctx["set"] = b.name
+			}
+		}
+		switch obj := word(1); {
+		case first == "define":
+			fw.field, fw.ctx["name"] = "define", obj
+		case obj == "rule" || obj == "element":
+			i := 2
+			fw.ctx["table"] = word(i)
+			if nftFamilies[word(i)] {
+				i++
+				fw.ctx["table"] += " " + word(i)
+			}
+			if obj == "rule" {
+				fw.ctx["chain"] = word(i + 1)
+			} else {
+				fw.field, fw.ctx["set"] = "elements", word(i+1)
+			}
+		}
+	default:
+		fw.syntax = pfSyntax
+		switch {
+		case first == "table":
+			fw.field, fw.ctx["table"] = "table", strings.Trim(word(1), "<>")
+		case len(toks) > 0 && strings.HasPrefix(strings.TrimSpace(code[toks[0].col+len(first):]), "="):
+			fw.field, fw.ctx["name"] = "macro", first
+		}
+	}
+	return opens && fw.syntax == nftSyntax
+}
+
+// word reads a word of the rule that isn’t an address, which may say what
+// the rule does, and names the field of the addresses after it.
+func (fw *firewall) word(w string) {
+	switch fw.syntax {
+	case iptablesSyntax:
+		switch fw.key {
+		case "-A", "--append", "-I", "--insert", "-R", "--replace", "-D", "--delete", "-N", "--new-chain":
+			fw.ctx["chain"] = w
+		case "-j", "--jump", "-g", "--goto":
+			fw.ctx["action"] = w
+		case "-t", "--table":
+			fw.ctx["table"] = w
+		}
+	case nftSyntax:
+		switch {
+		case fw.key == "jump" || fw.key == "goto":
+			fw.ctx["action"] = fw.key + " " + w
+		case nftVerdicts[w]:
+			fw.ctx["action"] = w
+		}
+	case pfSyntax:
+		switch {
+		case fw.key == "" && pfActions[w]:
+			fw.ctx["action"] = w
+		case (w == "in" || w == "out") && fw.ctx["action"] != "" && fw.ctx["direction"] == "":
+			fw.ctx["direction"] = w
+		}
+	}
+	fw.key = w
+}
+
+// fieldName returns the field of the rule’s next address.
+func (fw *firewall) fieldName() string {
+	if fw.field != "" {
+		return fw.field
+	}
+	k := fw.key
+	switch fw.syntax {
+	case iptablesSyntax:
+		k = strings.TrimLeft(k, "-")
+		switch k {
+		case "s", "src", "source":
+			return "source"
+		case "d", "dst", "destination":
+			return "destination"
+		}
+	case nftSyntax:
+		if a := fw.ctx["action"]; k == "to" && (a == "dnat" || a == "snat") {
+			return a
+		}
+	case pfSyntax:
+		// The “->” of FreeBSD’s rdr, nat, and binat rules is OpenBSD’s
+		// rdr-to, nat-to, and binat-to.
+		if a := fw.ctx["action"]; k == "->" && a != "" {
+			return a + "-to"
+		}
+	}
+	if k == "" {
+		return "address"
+	}
+	return k
+}
+
+// flush emits the matches of the rule read so far.
+func (fw *firewall) flush() error {
+	for _, m := range fw.ms {
+		m.Context = fw.ctx
+		if err := fw.emit(m); err != nil {
+			return err
+		}
+	}
+	fw.ms = nil
+	return nil
+}
+
+// nftOpener reports whether code opens a block of an nft ruleset, as
+// “table inet filter {” or “set blocked {” does, and its kind and name.
+// pf’s tables, as “table <bad> {”, are named in angle brackets instead.
+func nftOpener(code string) (kind, name string, ok bool) {
+	head, _, ok := strings.Cut(code, "{")
+	if !ok {
+		return "", "", false
+	}
+	f := strings.Fields(head)
+	switch {
+	case len(f) == 2 && (f[0] == "table" || f[0] == "chain" || f[0] == "set" || f[0] == "map" || f[0] == "flowtable"):
+	case len(f) == 3 && f[0] == "table":
+	default:
+		return "", "", false
+	}
+	if strings.HasPrefix(f[1], "<") {
+		return "", "", false
+	}
+	return f[0], strings.Join(f[1:], " "), true
+}
+
+// firewallComment returns where the comment on line begins, at a “#” that
+// isn’t quoted, or -1 if it has none.
+func firewallComment(line string) int {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return i
+		}
+	}
+	return -1
+}
+
+// firewallSeps are the characters that separate the words of rulesets.
+const firewallSeps = " \t\r{},;=!()\"'\\"
+
+// firewallTokens returns the words of code, split at firewallSeps, but for
+// a quoted comment, which is a word, quotes and all.
+func firewallTokens(code string) []logValue {
+	var toks []logValue
+	for i := 0; i < len(code); {
+		c := code[i]
+		if (c == '"' || c == '\'') && len(toks) > 0 && firewallComments[toks[len(toks)-1].text] {
+			j := strings.IndexByte(code[i+1:], c)
+			if j < 0 {
+				j = len(code)
+			} else {
+				j += i + 2
+			}
+			toks = append(toks, logValue{code[i:j], i})
+			i = j
+			continue
+		}
+		if strings.IndexByte(firewallSeps, c) >= 0 {
+			i++
+			continue
+		}
+		j := i + 1
+		for j < len(code) && strings.IndexByte(firewallSeps, code[j]) < 0 {
+			j++
+		}
+		toks = append(toks, logValue{code[i:j], i})
+		i = j
+	}
+	return toks
+}
+
+// firewallAddr is an address or network in a ruleset, as it appeared, and
+// where on its line it begins.
+type firewallAddr struct {
+	ip   netip.Addr
+	net  netip.Prefix // if it is a network, rather than a host.
+	text string
+	col  int
+}
+
+// firewallAddrs returns the address or network t is, with or without a
+// port, or the two ends of the range it is, as 10.0.0.1-10.0.0.9, if any.
+func firewallAddrs(t logValue) []firewallAddr {
+	if a, ok := parseFirewallAddr(t.text, t.col); ok {
+		return []firewallAddr{a}
+	}
+	if lo, hi, ok := strings.Cut(t.text, "-"); ok {
+		a, ok := parseFirewallAddr(lo, t.col)
+		b, bok := parseFirewallAddr(hi, t.col+len(lo)+1)
+		if ok && bok {
+			return []firewallAddr{a, b}
+		}
+	}
+	return nil
+}
+
+// parseFirewallAddr parses s, at col, as an address, with or without a port
+// or ports, or a network, its prefix given as a length or, for IPv4, a
+// netmask. A network of one address, as iptables-save writes a host, is
+// that address.
+func parseFirewallAddr(s string, col int) (firewallAddr, bool) {
+	if ip, ok := ParseIP([]byte(s)); ok {
+		return firewallAddr{ip: ip, text: s, col: col}, true
+	}
+	if addr, length, ok := strings.Cut(s, "/"); ok {
+		ip, ok := ParseIP([]byte(addr))
+		if !ok {
+			return firewallAddr{}, false
+		}
+		n, err := strconv.Atoi(length)
+		if mask, ok := ParseIP([]byte(length)); ok && mask.Is4() && ip.Is4() {
+			n, err = maskBits(mask), nil
+		}
+		if err != nil || n < 0 || n > ip.BitLen() {
+			return firewallAddr{}, false
+		}
+		if n == ip.BitLen() {
+			return firewallAddr{ip: ip, text: addr, col: col}, true
+		}
+		p := netip.PrefixFrom(ip, n).Masked()
+		return firewallAddr{ip: p.Addr(), net: p, text: s, col: col}, true
+	}
+	host := s
+	if rest, ok := strings.CutPrefix(s, "["); ok {
+		host, _, _ = strings.Cut(rest, "]")
+		col++
+	} else if i := strings.IndexByte(s, ':'); i > 0 && strings.Count(s, ":") == 1 {
+		host = s[:i]
+	}
+	if ip, ok := ParseIP([]byte(host)); ok && host != s {
+		return firewallAddr{ip: ip, text: host, col: col}, true
+	}
+	return firewallAddr{}, false
+}
+
+// maskBits returns the length of the prefix the IPv4 netmask mask is, or -1
+// if its ones don’t all come before its zeros.
+func maskBits(mask netip.Addr) int {
+	b := mask.As4()
+	m := binary.BigEndian.Uint32(b[:])
+	n := bits.LeadingZeros32(^m)
+	if n < 32 && m<<n != 0 {
+		return -1
+	}
+	return n
+}
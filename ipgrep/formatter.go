@@ -0,0 +1,437 @@
+package ipgrep
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+	"unicode/utf8"
+)
+
+// Result is what was found in one input.
+type Result struct {
+	Source  string // the input’s name, such as a file name; may be empty.
+	Group   string // what the matches have in common, if grouped otherwise.
+	Matches []Match
+
+	// Notes, unless it is nil, holds what more is known about each of
+	// Matches, in the same order, as the ipgrep command learns with
+	// -classify and its lookups.
+	Notes []Note
+
+	// Lines holds, by number, the lines of the input the lines format
+	// shows: those with Matches and any of context around them. If it is
+	// nil, the format shows each match’s Text instead.
+	Lines map[int][]byte
+}
+
+// Note is what more is known about a match than where it was found: the
+// Time its line gives, if any, which text shows before it; the Columns text
+// and csv show after it; and the fields of Fields, a value that encodes as a
+// JSON object, which json shows with it.
+type Note struct {
+	Time    time.Time
+	Columns []Column
+	Fields  any
+}
+
+// Column is one of a Note’s columns, under its header.
+type Column struct {
+	Header, Value string
+}
+
+// Formatter writes results in some format, as the ipgrep command’s -output
+// option chooses.
+type Formatter interface {
+	Format(w io.Writer, results []Result) error
+}
+
+// FormatterFunc is a function used as a Formatter.
+type FormatterFunc func(w io.Writer, results []Result) error
+
+// Format calls f.
+func (f FormatterFunc) Format(w io.Writer, results []Result) error {
+	return f(w, results)
+}
+
+// Colorer is a writer that shows colors, as a terminal does. The text and
+// lines formats color what they write to one, giving Color each part of
+// the output that is a "header", an "ip", or a "source" to color.
+type Colorer interface {
+	io.Writer
+	Color(part, s string) string
+}
+
+var (
+	formattersMu sync.RWMutex
+	formatters   = map[string]Formatter{
+		"text":  FormatterFunc(formatText),
+		"json":  FormatterFunc(formatJSON),
+		"lines": FormatterFunc(formatLines),
+		"csv":   FormatterFunc(formatCSV),
+	}
+)
+
+// RegisterFormatter makes f available to LookupFormatter as the format
+// called name, beside the built-in text, json, lines, and csv. It panics if
+// a format of that name is registered already.
+func RegisterFormatter(name string, f Formatter) {
+	formattersMu.Lock()
+	defer formattersMu.Unlock()
+	if _, ok := formatters[name]; ok {
+		panic(fmt.Sprintf("ipgrep: RegisterFormatter called twice for format %q", name))
+	}
+	formatters[name] = f
+}
+
+// LookupFormatter returns the Formatter registered as name, or nil if there
+// is none.
+func LookupFormatter(name string) Formatter {
+	formattersMu.RLock()
+	defer formattersMu.RUnlock()
+	return formatters[name]
+}
+
+// Formatters returns the names of the registered formats, sorted.
+func Formatters() []string {
+	formattersMu.RLock()
+	defer formattersMu.RUnlock()
+	names := make([]string, 0, len(formatters))
+	for name := range formatters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// colored returns s colored as the part of the output it is, if w is a
+// Colorer, and otherwise s as it is.
+func colored(w io.Writer, part, s string) string {
+	if c, ok := w.(Colorer); ok {
+		return c.Color(part, s)
+	}
+	return s
+}
+
+// matchText returns what text shows of m: its IP, or the artifact as it
+// appeared if it isn’t one.
+func matchText(m Match) string {
+	if m.IP.IsValid() {
+		return m.IP.String()
+	}
+	return m.Artifact.Text
+}
+
+// noteAt returns r’s note on its ith match, which is empty if it has none.
+func (r Result) noteAt(i int) Note {
+	if i < len(r.Notes) {
+		return r.Notes[i]
+	}
+	return Note{}
+}
+
+// noted reports whether any of r’s notes give a time, and any columns.
+func (r Result) noted() (timed, cols bool) {
+	for _, n := range r.Notes {
+		timed = timed || !n.Time.IsZero()
+		cols = cols || len(n.Columns) > 0
+	}
+	return timed, cols
+}
+
+// timeText returns what text and csv show of t, which is zero if no time
+// is known.
+func timeText(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
+
+// formatText writes a commented header for each result with a Source or a
+// Group, followed by what was found, one per line, as the command does, or
+// a table of them and their notes’ columns if they have any.
+func formatText(w io.Writer, results []Result) error {
+	bw := bufio.NewWriter(w)
+	for _, r := range results {
+		switch {
+		case r.Group != "":
+			fmt.Fprintln(bw, colored(w, "header", fmt.Sprintf("# %v:", r.Group)))
+		case r.Source != "":
+			fmt.Fprintln(bw, colored(w, "header", fmt.Sprintf("# results for %v:", r.Source)))
+		}
+		if timed, cols := r.noted(); !timed && !cols {
+			for _, m := range r.Matches {
+				fmt.Fprintln(bw, colored(w, "ip", matchText(m)))
+			}
+		} else {
+			writeTable(bw, w, r)
+		}
+		fmt.Fprintln(bw)
+	}
+	return bw.Flush()
+}
+
+// writeTable writes r’s matches to bw as a table with a column for their
+// times, if any are known, and for each of their notes’ Columns, colored as
+// w colors them.
+func writeTable(bw *bufio.Writer, w io.Writer, r Result) {
+	// Color the table only once it’s aligned, since tabwriter would count
+	// the escape sequences as part of each cell’s width.
+	var buf bytes.Buffer
+	tw := tabwriter.NewWriter(&buf, 0, 8, 2, ' ', 0)
+	timed, _ := r.noted()
+	for i, m := range r.Matches {
+		n := r.noteAt(i)
+		if i == 0 {
+			var row []string
+			if timed {
+				row = append(row, "TIME")
+			}
+			row = append(row, "IP")
+			for _, c := range n.Columns {
+				row = append(row, c.Header)
+			}
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+		var row []string
+		if timed {
+			row = append(row, timeText(n.Time))
+		}
+		row = append(row, matchText(m))
+		for _, c := range n.Columns {
+			row = append(row, c.Value)
+		}
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	tw.Flush()
+	for i, line := range strings.SplitAfter(buf.String(), "\n") {
+		if i > 0 && i <= len(r.Matches) {
+			s := matchText(r.Matches[i-1])
+			line = strings.Replace(line, s, colored(w, "ip", s), 1)
+		}
+		bw.WriteString(line)
+	}
+}
+
+// jsonResult and jsonMatch define the shape of the json format, which a
+// match’s note adds its Fields to.
+type jsonResult struct {
+	File    string            `json:"file,omitempty"`
+	Group   string            `json:"group,omitempty"`
+	Matches []json.RawMessage `json:"ips"`
+}
+
+type jsonMatch struct {
+	File    string            `json:"file,omitempty"` // if its result has no Source.
+	IP      string            `json:"ip,omitempty"`
+	Kind    string            `json:"kind"`
+	Token   string            `json:"token"`          // the artifact as it appeared.
+	Line    int               `json:"line,omitempty"` // it and the next two only if known.
+	Column  int               `json:"column,omitempty"`
+	Offset  *int64            `json:"offset,omitempty"`
+	Field   string            `json:"field,omitempty"`
+	Context map[string]string `json:"context,omitempty"`
+	Time    *time.Time        `json:"time,omitempty"`
+}
+
+// formatJSON writes results as a single JSON array with an object for each.
+// A match gives its own Source as its file only if its result has none, as
+// when results are grouped otherwise.
+func formatJSON(w io.Writer, results []Result) error {
+	out := make([]jsonResult, 0, len(results))
+	for _, r := range results {
+		jr := jsonResult{File: r.Source, Group: r.Group, Matches: make([]json.RawMessage, 0, len(r.Matches))}
+		for i, m := range r.Matches {
+			if r.Source != "" {
+				m.Source = ""
+			}
+			b, err := MarshalMatch(m, r.noteAt(i))
+			if err != nil {
+				return err
+			}
+			jr.Matches = append(jr.Matches, b)
+		}
+		out = append(out, jr)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+// MarshalMatch returns m as the json format gives it, with the fields of
+// n, and with m’s Source as its file, if it has one, for output that gives
+// each match on its own, as a line of JSON. Where m was found is left out
+// if its Line is 0, as it is when that isn’t known.
+func MarshalMatch(m Match, n Note) ([]byte, error) {
+	jm := jsonMatch{File: m.Source, Kind: m.Artifact.Kind, Token: m.Artifact.Text, Line: m.Line, Column: m.Column, Field: m.Field, Context: m.Context}
+	if m.Line > 0 {
+		jm.Offset = &m.Offset
+	}
+	if m.IP.IsValid() {
+		jm.IP = m.IP.String()
+	}
+	if !n.Time.IsZero() {
+		jm.Time = &n.Time
+	}
+	b, err := json.Marshal(jm)
+	if err != nil || n.Fields == nil {
+		return b, err
+	}
+	fb, err := json.Marshal(n.Fields)
+	if err != nil {
+		return nil, err
+	}
+	if len(fb) < 2 || fb[0] != '{' {
+		return nil, fmt.Errorf("ipgrep: a note’s Fields are %s, not a JSON object", fb)
+	}
+	if len(fb) > 2 {
+		b = append(append(b[:len(b)-1], ','), fb[1:]...)
+	}
+	return b, nil
+}
+
+// formatLines writes each line with a match, as SOURCE:LINE:TEXT, as
+// “grep -Hn” does, and with them any other lines in Lines, of context, as
+// SOURCE-LINE-TEXT, with “--” between runs of lines that aren’t adjacent.
+func formatLines(w io.Writer, results []Result) error {
+	var (
+		bw      = bufio.NewWriter(w)
+		matched = make([]map[int]bool, len(results))
+		context bool // whether any Lines are lines of context.
+		printed bool
+	)
+	for i, r := range results {
+		matched[i] = make(map[int]bool, len(r.Matches))
+		for _, m := range r.Matches {
+			matched[i][m.Line] = true
+		}
+		for n := range r.Lines {
+			context = context || !matched[i][n]
+		}
+	}
+	for i, r := range results {
+		lines := r.Lines
+		if lines == nil {
+			lines = make(map[int][]byte, len(r.Matches))
+			for _, m := range r.Matches {
+				if _, ok := lines[m.Line]; !ok {
+					lines[m.Line] = m.Text
+				}
+			}
+		}
+		ns := make([]int, 0, len(lines))
+		for n := range lines {
+			ns = append(ns, n)
+		}
+		sort.Ints(ns)
+		for j, n := range ns {
+			if printed && context && (j == 0 || n != ns[j-1]+1) {
+				fmt.Fprintln(bw, "--")
+			}
+			sep := "-"
+			if matched[i][n] {
+				sep = ":"
+			}
+			fmt.Fprintf(bw, "%v%v%d%v%s\n", colored(w, "source", r.Source), sep, n, sep, highlight(w, lines[n]))
+			printed = true
+		}
+	}
+	return bw.Flush()
+}
+
+// highlight returns line with each IP in it colored, if w is a Colorer.
+func highlight(w io.Writer, line []byte) string {
+	if _, ok := w.(Colorer); !ok {
+		return string(line)
+	}
+	var (
+		out   []byte
+		start = -1 // where the current word began, if in one.
+	)
+	flush := func(end int) {
+		if start < 0 {
+			return
+		}
+		word := line[start:end]
+		if _, ok := ParseIP(word); ok {
+			out = append(out, colored(w, "ip", string(word))...)
+		} else {
+			out = append(out, word...)
+		}
+		start = -1
+	}
+	for i := 0; i < len(line); {
+		r, size := utf8.DecodeRune(line[i:])
+		if IsSeparator(r) {
+			flush(i)
+			out = append(out, line[i:i+size]...)
+		} else if start < 0 {
+			start = i
+		}
+		i += size
+	}
+	flush(len(line))
+	return string(out)
+}
+
+// formatCSV writes a header row and then a row for each match: its result’s
+// source, or its own if the result has none, its line, column, offset, kind,
+// text, and IP, if it is one, and then its time, if any match’s is known, and
+// the values of its note’s columns, under the headers of the first note with
+// any.
+func formatCSV(w io.Writer, results []Result) error {
+	var (
+		cw     = csv.NewWriter(w)
+		header = []string{"source", "line", "column", "offset", "kind", "text", "ip"}
+		timed  bool
+		cols   []Column
+	)
+	for _, r := range results {
+		t, _ := r.noted()
+		timed = timed || t
+		for _, n := range r.Notes {
+			if cols == nil && len(n.Columns) > 0 {
+				cols = n.Columns
+			}
+		}
+	}
+	if timed {
+		header = append(header, "time")
+	}
+	for _, c := range cols {
+		header = append(header, strings.ToLower(c.Header))
+	}
+	cw.Write(header)
+	for _, r := range results {
+		for i, m := range r.Matches {
+			ip := ""
+			if m.IP.IsValid() {
+				ip = m.IP.String()
+			}
+			source := r.Source
+			if source == "" {
+				source = m.Source
+			}
+			row := []string{source, strconv.Itoa(m.Line), strconv.Itoa(m.Column),
+				strconv.FormatInt(m.Offset, 10), m.Artifact.Kind, m.Artifact.Text, ip}
+			if timed {
+				row = append(row, timeText(r.noteAt(i).Time))
+			}
+			for _, c := range r.noteAt(i).Columns {
+				row = append(row, c.Value)
+			}
+			cw.Write(row)
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,175 @@
+package ipgrep
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+// seeds are inputs of the kinds ipgrep is pointed at, hostile ones included.
+var seeds = []string{
+	"10.10.10.2 https://webserver.com",
+	`{"ip": "172.16.2.84"}`,
+	"log -> time=13:10, event=foo, addr=192.168.0.2, desc=\"a foo went bar\"",
+	"There’s no place like 127.0.0.1.",
+	"http://[2001:db8::1]:8080/path?q=10.0.0.1#frag",
+	"[::1] (fe80::1%eth0) <::ffff:192.0.2.1>",
+	"1[.]2[.]3[.]4 hxxps://5(.)6(.)7(.)8/ 2001[:]db8[:][:]1",
+	"010.000.000.001 1.2.3.4:443 1.2.3.4.5 999.1.1.1 ::::",
+	"a\r\nb 8.8.8.8\r\n\x00\xff\xfe 1.1.1.1\n",
+	strings.Repeat("1.", 40) + " " + strings.Repeat(":", 70),
+}
+
+// FuzzExtract checks that Extract and a Scanner agree on any input, and that
+// every match is a real IP address found where the Scanner says it was.
+func FuzzExtract(f *testing.F) {
+	for _, s := range seeds {
+		f.Add([]byte(s), false)
+	}
+	f.Fuzz(func(t *testing.T, b []byte, lenient bool) {
+		for _, word := range bytes.FieldsFunc(b, IsSeparator) {
+			want := net.ParseIP(string(word))
+			if want != nil && !maybeIP(word) {
+				t.Fatalf("%q passed over but is an IP", word)
+			}
+			ip, ok := ParseIP(word)
+			if ok != (want != nil) || ok && !want.Equal(ip.AsSlice()) {
+				t.Fatalf("%q parsed as %v, want %v", word, ip, want)
+			}
+		}
+		want := Extract(b)
+		var opts []Option
+		if lenient {
+			opts = append(opts, WithLenientParsing())
+		}
+		var got []netip.Addr
+		s := NewScanner(bytes.NewReader(b), opts...)
+		for s.Scan() {
+			m := s.Match()
+			if !m.IP.IsValid() {
+				t.Fatalf("match %q has no IP", m.Artifact.Text)
+			}
+			if end := m.Offset + int64(len(m.Artifact.Text)); m.Offset < 0 || end > int64(len(b)) ||
+				string(b[m.Offset:end]) != m.Artifact.Text {
+				t.Fatalf("match %q not at offset %d", m.Artifact.Text, m.Offset)
+			}
+			if _, err := netip.ParseAddr(m.IP.String()); err != nil {
+				t.Fatalf("match %q parsed as %v, which doesn’t parse", m.Artifact.Text, m.IP)
+			}
+			got = append(got, m.IP)
+		}
+		if err := s.Err(); err != nil {
+			t.Fatal(err)
+		}
+		if lenient {
+			if len(got) < len(want) {
+				t.Fatalf("lenient scan found %v, fewer than Extract’s %v", got, want)
+			}
+			return
+		}
+		if len(got) != len(want) {
+			t.Fatalf("Scanner found %v, Extract %v", got, want)
+		}
+		for i := range got {
+			if got[i] != want[i] {
+				t.Fatalf("Scanner found %v, Extract %v", got, want)
+			}
+		}
+	})
+}
+
+// FuzzLongLines checks that a line read in pieces yields what it would
+// whole, whatever comes at the boundaries between them.
+func FuzzLongLines(f *testing.F) {
+	for _, s := range seeds {
+		f.Add(s, 0)
+	}
+	f.Fuzz(func(t *testing.T, s string, pad int) {
+		if strings.Contains(s, "\n") {
+			return
+		}
+		// Put s across the first boundary between pieces of a long line.
+		if pad = pad % len(s+" "); pad < 0 {
+			pad = -pad
+		}
+		line := strings.Repeat("x", maxLine-pad) + " " + s
+		want := Extract([]byte(s))
+		var (
+			got     []netip.Addr
+			matches []Match
+		)
+		for m := range All(strings.NewReader(line)) {
+			got = append(got, m.IP)
+			matches = append(matches, m)
+		}
+		if len(got) != len(want) {
+			t.Fatalf("found %v across a boundary, %v otherwise", got, want)
+		}
+		// Reading in place must find the same, in the same places.
+		var i int
+		for m := range NewBytesScanner([]byte(line)).All() {
+			if i >= len(matches) || m.Offset != matches[i].Offset || m.Artifact.Text != matches[i].Artifact.Text {
+				t.Fatalf("read in place, found %q at %d", m.Artifact.Text, m.Offset)
+			}
+			i++
+		}
+		if i != len(matches) {
+			t.Fatalf("read in place, found %d matches, %d otherwise", i, len(matches))
+		}
+	})
+}
+
+// FuzzParsers checks that each Parser, given any input, finds only IP
+// addresses, at places within it, and the same ones whether its matches are
+// pulled by a Scanner or pushed to a callback.
+func FuzzParsers(f *testing.F) {
+	for _, s := range append(seeds,
+		"<nmaprun><host><status state=\"up\"/>\n<address addr=\"10.0.0.1\" addrtype=\"ipv4\"/>\n"+
+			"<ports><port protocol=\"tcp\" portid=\"22\"><state state=\"open\"/><service name=\"ssh\"/></port></ports></host></nmaprun>",
+		"Host: 10.0.0.1 (a.example)\tStatus: Up\nHost: 10.0.0.1 (a.example)\tPorts: 22/open/tcp//ssh///\n",
+		"{\"src_ip\": \"10.0.0.1\", \"dest_ip\": \"10.0.0.\\u0032\", \"dns\": {\"answers\": [{\"rdata\": \"::1\"}]}}\n",
+		"#separator \\x09\n#set_separator\t,\n#fields\tts\tid.orig_h\tips\n#types\ttime\taddr\tset[addr]\n1\t10.0.0.1\t::1,10.0.0.2\n",
+		"10.0.0.2 - - [12/Oct/2026:10:00:01 +0000] \"GET / HTTP/1.1\" 200 0 \"-\" \"a \\\" b\" \"unknown, [::1]:80\"\n",
+		"[\n{\"ip\": \"10.0.0.1\", \"timestamp\": \"1\", \"ports\": [{\"port\": 80, \"proto\": \"tcp\"}]},\n]\nopen tcp 22 10.0.0.2 1\n",
+		"2 123456789010 eni-0a1b 10.0.0.1 10.0.0.2 443 49152 6 10 840 1 2 ACCEPT OK\nversion pkt-srcaddr srcaddr action\n5 ::1 - REJECT\n",
+		"{\"Records\": [{\"eventName\": \"a\", \"sourceIPAddress\": \"10.0.0.1\"}, {\"x\": [\"::1\"]}]}\n{\"sourceIPAddress\": \"10.0.0.2\"}\n"+
+			"[{\"CloudTrailEvent\": \"{\\\"sourceIPAddress\\\": \\\"10.0.0.3\\\"}\"}]",
+		"#Fields: date c-ip s-ip X-Forwarded-For\r\n2026-10-12 ::1 - 10.0.0.1,+[::2]:80\r\n#Fields: c-ip\n10.0.0.3\n",
+		"#Fields: date time action protocol src-ip dst-ip src-port dst-port path pid\r\n\r\n"+
+			"2026-10-12 10:00:01 DROP TCP 10.0.0.1 ::1 49152 445 RECEIVE 4\r\n2026-10-12 10:00:02 ALLOW UDP - 10.0.0.2 - 53 SEND -\n",
+		"*filter\n-A INPUT -s 10.0.0.0/255.0.0.0 -m comment --comment \"a # 10.0.0.9\" -j ACCEPT\nCOMMIT\n"+
+			"table inet f {\n\tset s { elements = { 10.0.0.1-10.0.0.9,\n\t\t::1/64 } }\n\tchain c {\n\t\tip saddr { 10.0.0.2 } dnat to [::2]:80\n\t}\n}\n"+
+			"t = \"{ 10.0.0.3 }\"\nrdr pass in from ! <bad> to 10.0.0.4 -> 10.0.0.5 port 80 \\\n\tlabel \"x\"\n",
+	) {
+		f.Add([]byte(s))
+	}
+	f.Fuzz(func(t *testing.T, b []byte) {
+		for _, name := range Parsers() {
+			p := WithParser(LookupParser(name))
+			var pushed []Match
+			ScanBytes(context.Background(), b, func(m Match) error {
+				pushed = append(pushed, m)
+				return nil
+			}, p)
+			var i int
+			for m := range NewScanner(bytes.NewReader(b), p).All() {
+				if !m.IP.IsValid() {
+					t.Fatalf("%v: match %q has no IP", name, m.Artifact.Text)
+				}
+				if m.Offset < 0 || m.Offset > int64(len(b)) || m.Line < 1 || m.Column < 1 {
+					t.Fatalf("%v: match %q at line %d, column %d, offset %d", name, m.Artifact.Text, m.Line, m.Column, m.Offset)
+				}
+				if i >= len(pushed) || pushed[i].IP != m.IP || pushed[i].Offset != m.Offset {
+					t.Fatalf("%v: pulled %v at %d, not pushed", name, m.IP, m.Offset)
+				}
+				i++
+			}
+			if i != len(pushed) {
+				t.Fatalf("%v: pulled %d matches, pushed %d", name, i, len(pushed))
+			}
+		}
+	})
+}
@@ -0,0 +1,453 @@
+// Package ipgrep extracts IPv4 and IPv6 addresses from text, as the ipgrep
+// command does.
+//
+// Text is split into “words” at whitespace and at punctuation other than
+// ‘.’ and ‘:’, and each word that parses as an IP address is a match. So
+// “10.0.0.1,” and “(2001:db8::1)” match, but “10.0.0.1.” doesn’t.
+//
+// A Scanner reads matches from any io.Reader one at a time:
+//
+//	s := ipgrep.NewScanner(r)
+//	for s.Scan() {
+//		m := s.Match()
+//		fmt.Println(m.Line, m.IP)
+//	}
+//	if err := s.Err(); err != nil {
+//		// handle it.
+//	}
+//
+// Or, with the iterators All and AllErr:
+//
+//	for m := range ipgrep.All(r) {
+//		fmt.Println(m.Line, m.IP)
+//	}
+//
+// Scan does the same with a callback and Scanner.Matches with a channel,
+// both stopping early when a context is done. Extract finds the IPs in text
+// already in memory.
+//
+// A Scanner can find other things as well, or instead, given an Extractor
+// for each kind by WithExtractors; Register makes one available by name.
+// Other Options choose the address families and limits of a scan.
+package ipgrep
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"iter"
+	"net/netip"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Match is an IP address, or another artifact, found in text, and where it
+// was found. The address or artifact is as it appeared in Artifact.Text and
+// parsed in IP, for an address, or Artifact.Value. A network a Parser finds,
+// as in a firewall’s rule, has its first address in IP as well.
+type Match struct {
+	IP       netip.Addr // the zero Addr if the artifact isn’t an IP address.
+	Artifact Artifact   // what was found, by whichever Extractor.
+	Source   string     // the input’s name, as set by WithSource or ScanFile.
+	Line     int        // number of the line it was found on, counting from 1.
+	Column   int        // byte offset of the match in its line, counting from 1.
+	Offset   int64      // byte offset of the match in the input, counting from 0.
+	Text     []byte     // its line, without its newline, or a piece of it.
+
+	// With WithParser, the field of its record it was found in, as the
+	// format names it, e.g. "src_ip", and what else its record says, such
+	// as the ports open on a host that was scanned, if anything.
+	Field   string
+	Context map[string]string
+}
+
+const (
+	// maxLine is how much of a line a Scanner holds at once. Longer lines
+	// are read in pieces, each ending between words.
+	maxLine = 64 << 10
+
+	// maxWord is the length of the longest IP address, as text. Longer
+	// words needn’t be kept whole across pieces of a line, unless other
+	// Extractors look for longer artifacts in them.
+	maxWord = len("ffff:ffff:ffff:ffff:ffff:ffff:255.255.255.255")
+)
+
+// Scanner reads the IP addresses in its input, line by line, holding no
+// more than 64 KB of it at once: lines longer than that are read in pieces,
+// each ending between words, and reported as Text of that many Matches.
+type Scanner struct {
+	r       *bufio.Reader
+	data    []byte          // with NewBytesScanner, the input, read in place.
+	pos     int             // how much of data has been read.
+	ctx     context.Context // if not nil, stops the scan when done.
+	err     error
+	line    int
+	text    []byte
+	start   int64      // offset in the input of the start of the line.
+	textAt  int        // offset of text in its line.
+	inLine  int        // bytes of the line read so far.
+	partial bool       // whether text ended before its line did.
+	carry   []byte     // the start of a word cut off the end of text.
+	skip    bool       // whether the rest of a word too long to carry is skipped.
+	pending []Artifact // those found in text not yet returned.
+	match   Match
+
+	cfg     config
+	read    int64           // bytes of input read so far.
+	matches int             // matches returned so far.
+	seen    map[string]bool // with WithUnique, the artifacts returned.
+
+	// With WithParser, the coroutine running it for Scan.
+	pull func() (Match, bool)
+	stop func()
+}
+
+// NewScanner returns a Scanner reading from r, configured by opts.
+func NewScanner(r io.Reader, opts ...Option) *Scanner {
+	s := &Scanner{r: bufio.NewReaderSize(r, maxLine), cfg: newConfig(opts)}
+	if s.cfg.unique {
+		s.seen = make(map[string]bool)
+	}
+	return s
+}
+
+// NewBytesScanner returns a Scanner reading b in place rather than copying
+// it, as for a file mapped into memory. b mustn’t change until the scan is
+// done, and the Text of its matches is part of b.
+func NewBytesScanner(b []byte, opts ...Option) *Scanner {
+	s := &Scanner{data: b, cfg: newConfig(opts)}
+	if s.cfg.unique {
+		s.seen = make(map[string]bool)
+	}
+	return s
+}
+
+// Scan advances to the next match, which Match then returns. It returns
+// false at the end of the input or on an error, which Err then returns.
+func (s *Scanner) Scan() bool {
+	if s.cfg.maxMatches > 0 && s.matches >= s.cfg.maxMatches {
+		s.stopParser()
+		return false
+	}
+	if s.cfg.parser != nil {
+		return s.scanParsed()
+	}
+	for {
+		for len(s.pending) == 0 {
+			if s.err != nil {
+				return false
+			}
+			if s.ctx != nil && s.ctx.Err() != nil {
+				s.err = context.Cause(s.ctx)
+				return false
+			}
+			s.next()
+			s.pending = s.extract(s.text)
+		}
+		a := s.pending[0]
+		s.pending = s.pending[1:]
+		if s.seen != nil {
+			k := a.Kind + " " + a.Text
+			if s.seen[k] {
+				continue
+			}
+			s.seen[k] = true
+		}
+		col := s.textAt + a.Offset
+		s.match = Match{
+			IP:       a.ip(),
+			Artifact: a,
+			Source:   s.cfg.source,
+			Line:     s.line,
+			Column:   col + 1,
+			Offset:   s.start + int64(col),
+			Text:     s.text,
+		}
+		s.matches++
+		return true
+	}
+}
+
+// next reads the next line, or the next piece of one, into text.
+func (s *Scanner) next() {
+	b, err := s.readSlice()
+	full := err == bufio.ErrBufferFull
+	if err != nil && !full {
+		s.err = err
+	}
+	if !s.partial {
+		s.line++
+		s.start, s.inLine = s.read, 0
+	}
+	if s.read += int64(len(b)); s.cfg.maxBytes > 0 && s.read > s.cfg.maxBytes {
+		s.err, s.text = ErrTooLarge, nil
+		return
+	}
+	if s.cfg.lines != nil && (len(b) > 0 || s.err == nil) {
+		s.cfg.lines(s.line, bytes.TrimSuffix(b, []byte("\n")))
+	}
+	s.textAt = s.inLine - len(s.carry)
+	s.inLine += len(b)
+	if s.skip {
+		if i := bytes.IndexFunc(b, s.cfg.separator); i >= 0 {
+			b, s.skip = b[i:], false
+			s.textAt += i
+		} else {
+			b = nil
+		}
+	}
+	// b is overwritten by the next read, so text must be a copy, unless it
+	// is read in place.
+	text := b
+	if s.data == nil || len(s.carry) > 0 {
+		text = append(append(make([]byte, 0, len(s.carry)+len(b)), s.carry...), b...)
+	}
+	s.carry = nil
+	s.partial = full
+	if !full {
+		s.text = bytes.TrimSuffix(text, []byte("\n"))
+		return
+	}
+	tail := text
+	if i := bytes.LastIndexFunc(text, s.cfg.separator); i >= 0 {
+		_, size := utf8.DecodeRune(text[i:])
+		tail = text[i+size:]
+	}
+	if len(tail) > s.cfg.maxCarry() {
+		s.skip = true
+	} else {
+		s.carry = append([]byte(nil), tail...)
+	}
+	s.text = text[:len(text)-len(tail)]
+}
+
+// readSlice reads up to and including the next newline, as the Scanner’s
+// bufio.Reader’s ReadSlice does, from data if it is read in place.
+func (s *Scanner) readSlice() ([]byte, error) {
+	if s.data == nil {
+		return s.r.ReadSlice('\n')
+	}
+	rest := s.data[s.pos:]
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	n := min(len(rest), maxLine)
+	if i := bytes.IndexByte(rest[:n], '\n'); i >= 0 {
+		s.pos += i + 1
+		return rest[:i+1], nil
+	}
+	s.pos += n
+	if n < len(rest) {
+		return rest[:n], bufio.ErrBufferFull
+	}
+	return rest, io.EOF
+}
+
+// Match returns the match found by the last call to Scan. Its Text may be
+// shared with other matches on the same line but not overwritten by later
+// calls.
+func (s *Scanner) Match() Match {
+	return s.match
+}
+
+// Err returns the first error other than io.EOF met by the Scanner.
+func (s *Scanner) Err() error {
+	if s.err == io.EOF {
+		return nil
+	}
+	return s.err
+}
+
+// Matches sends each match the Scanner finds on the channel it returns, from
+// a goroutine of its own, for use in pipelines. The channel is closed at the
+// end of the input, on an error, or when ctx is done, after which Err says
+// which. It must be drained or ctx cancelled, lest the goroutine be left
+// blocked, and the Scanner mustn’t otherwise be used in the meantime.
+func (s *Scanner) Matches(ctx context.Context) <-chan Match {
+	c := make(chan Match)
+	s.ctx = ctx
+	go func() {
+		defer close(c)
+		defer s.stopParser()
+		for s.Scan() {
+			select {
+			case c <- s.Match():
+			case <-ctx.Done():
+				s.err = context.Cause(ctx)
+				return
+			}
+		}
+	}()
+	return c
+}
+
+// All returns the matches the Scanner finds as an iterator; Err then
+// returns any error that ended them early.
+func (s *Scanner) All() iter.Seq[Match] {
+	return func(yield func(Match) bool) {
+		defer s.stopParser()
+		if s.cfg.parser != nil && s.pull == nil {
+			// Run the Parser here, rather than as Scan would, so that
+			// breaking off leaves nothing behind.
+			s.parse(func(m Match) error {
+				if !yield(m) {
+					return errEnough
+				}
+				return nil
+			})
+			return
+		}
+		for s.Scan() {
+			if !yield(s.Match()) {
+				return
+			}
+		}
+	}
+}
+
+// All returns an iterator over the matches in r. A read error ends it
+// silently, so it suits readers that can’t fail, such as a strings.Reader;
+// for others, use AllErr, or a Scanner’s All and then its Err.
+func All(r io.Reader, opts ...Option) iter.Seq[Match] {
+	return NewScanner(r, opts...).All()
+}
+
+// AllErr returns an iterator over the matches in r, each paired with a nil
+// error, that ends with a zero Match and the error if reading r fails.
+func AllErr(r io.Reader, opts ...Option) iter.Seq2[Match, error] {
+	return func(yield func(Match, error) bool) {
+		s := NewScanner(r, opts...)
+		defer s.stopParser()
+		for s.Scan() {
+			if !yield(s.Match(), nil) {
+				return
+			}
+		}
+		if err := s.Err(); err != nil {
+			yield(Match{}, err)
+		}
+	}
+}
+
+// Scan calls fn with each IP address read from r, in the order they appear,
+// until r is exhausted, ctx is done, or fn returns an error, and returns
+// the error that stopped it, if any: that from r (other than io.EOF), fn’s,
+// or ctx’s cause. Like a Scanner, it holds no more than 64 KB of r at once,
+// so it suits inputs of any size, such as streams that never end.
+func Scan(ctx context.Context, r io.Reader, fn func(Match) error, opts ...Option) error {
+	return NewScanner(r, opts...).each(ctx, fn)
+}
+
+// ScanBytes is like Scan but reads b in place, as a Scanner from
+// NewBytesScanner does.
+func ScanBytes(ctx context.Context, b []byte, fn func(Match) error, opts ...Option) error {
+	return NewBytesScanner(b, opts...).each(ctx, fn)
+}
+
+func (s *Scanner) each(ctx context.Context, fn func(Match) error) error {
+	s.ctx = ctx
+	if s.cfg.parser != nil {
+		return s.parse(fn)
+	}
+	for s.Scan() {
+		if err := fn(s.Match()); err != nil {
+			return err
+		}
+	}
+	return s.Err()
+}
+
+// Extract returns the IP addresses in b, in the order they appear.
+func Extract(b []byte) []netip.Addr {
+	var ips []netip.Addr
+	for _, word := range bytes.FieldsFunc(b, IsSeparator) {
+		if ip, ok := ParseIP(word); ok {
+			ips = append(ips, ip)
+		}
+	}
+	return ips
+}
+
+// ParseIP parses word as an IP address, as a Scanner does, reporting whether
+// it is one. It accepts just what net.ParseIP does, and, as net.IP does,
+// takes an IPv4-mapped IPv6 address, like ::ffff:192.0.2.1, as the IPv4
+// address it maps. IPv4 addresses, the usual kind, are parsed from word
+// directly instead of from a copy of it as a string.
+func ParseIP(word []byte) (netip.Addr, bool) {
+	if !maybeIP(word) {
+		return netip.Addr{}, false
+	}
+	if bytes.IndexByte(word, ':') < 0 {
+		return parseIPv4(word)
+	}
+	ip, err := netip.ParseAddr(string(word))
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return ip.Unmap(), true
+}
+
+// parseIPv4 parses word as a dotted-decimal IPv4 address, which, as for
+// net.ParseIP, mustn’t have leading zeros.
+func parseIPv4(word []byte) (netip.Addr, bool) {
+	var (
+		ip     [4]byte
+		part   int
+		n      int
+		digits int
+	)
+	for _, c := range word {
+		switch {
+		case c == '.':
+			if digits == 0 || part == 3 {
+				return netip.Addr{}, false
+			}
+			ip[part] = byte(n)
+			part, n, digits = part+1, 0, 0
+		case c >= '0' && c <= '9':
+			if digits > 0 && n == 0 {
+				return netip.Addr{}, false // a leading zero.
+			}
+			if n = n*10 + int(c-'0'); n > 255 {
+				return netip.Addr{}, false
+			}
+			digits++
+		default:
+			return netip.Addr{}, false
+		}
+	}
+	if digits == 0 || part != 3 {
+		return netip.Addr{}, false
+	}
+	ip[3] = byte(n)
+	return netip.AddrFrom4(ip), true
+}
+
+// maybeIP reports whether word could be an IP address, so that the many
+// words of most text that can’t be are passed over without the cost of
+// parsing them: it must be no longer than the longest address and have
+// nothing in it but hex digits and the dots or colons of one.
+func maybeIP(word []byte) bool {
+	if len(word) < len("::") || len(word) > maxWord {
+		return false
+	}
+	seps := false
+	for _, c := range word {
+		switch {
+		case c >= '0' && c <= '9':
+		case c == '.' || c == ':':
+			seps = true
+		case c >= 'a' && c <= 'f', c >= 'A' && c <= 'F':
+		default:
+			return false
+		}
+	}
+	return seps
+}
+
+// IsSeparator reports whether r separates the “words” of text that are
+// tested as IP addresses, for those rewriting text around its IPs.
+func IsSeparator(r rune) bool {
+	return unicode.IsSpace(r) || unicode.IsPunct(r) && r != '.' && r != ':'
+}
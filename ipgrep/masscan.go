@@ -0,0 +1,127 @@
+package ipgrep
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// masscanParser reads masscan’s JSON (-oJ), NDJSON (-oD), and list (-oL)
+// output, all of which give a record to a line, each mostly for one port on
+// one host. Each address is a match in the field "ip" for each port it is
+// given with, in the context of its "port", "proto", "status", and, where
+// masscan records them, its "reason", "ttl", "service", "banner", and the
+// "timestamp" of the record, in seconds since 1970.
+type masscanParser struct{}
+
+func (masscanParser) Name() string { return "masscan" }
+
+func (masscanParser) Parse(r io.Reader, emit func(Match) error) error {
+	return readLines(r, func(n int, off int64, line []byte) error {
+		var ms []Match
+		switch rec := bytes.Trim(line, " \t\r,"); {
+		case len(rec) == 0, rec[0] == '#', rec[0] == '[', rec[0] == ']':
+			return nil
+		case rec[0] == '{':
+			ms = masscanJSON(rec, line, n, off)
+		default:
+			ms = masscanList(line, n, off)
+		}
+		for _, m := range ms {
+			if err := emit(m); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// masscanRecord is a record of masscan’s JSON output.
+type masscanRecord struct {
+	IP        string          `json:"ip"`
+	Timestamp json.RawMessage `json:"timestamp"` // a string, or in some versions a number.
+	Ports     []struct {
+		Port    int    `json:"port"`
+		Proto   string `json:"proto"`
+		Status  string `json:"status"`
+		Reason  string `json:"reason"`
+		TTL     int    `json:"ttl"`
+		Service *struct {
+			Name   string `json:"name"`
+			Banner string `json:"banner"`
+		} `json:"service"`
+	} `json:"ports"`
+}
+
+// masscanJSON returns the matches in rec, a record of masscan’s JSON output
+// on line n, which begins at off, or none if it isn’t one, as with the
+// “{finished: 1}” that older versions end with.
+func masscanJSON(rec, line []byte, n int, off int64) []Match {
+	var r masscanRecord
+	if json.Unmarshal(rec, &r) != nil {
+		return nil
+	}
+	ip, ok := ParseIP([]byte(r.IP))
+	if !ok {
+		return nil
+	}
+	col := bytes.Index(line, []byte(`"`+r.IP+`"`)) + 1
+	if col == 0 {
+		col = bytes.IndexByte(line, '{') // the address was escaped.
+	}
+	ts := strings.Trim(string(r.Timestamp), `"`)
+	var ms []Match
+	for _, p := range r.Ports {
+		m := fieldMatch(ip, r.IP, "ip", n, off, col)
+		m.Text = append([]byte(nil), line...)
+		m.Context = map[string]string{"port": strconv.Itoa(p.Port), "proto": p.Proto}
+		setContext(m.Context, "status", p.Status)
+		setContext(m.Context, "reason", p.Reason)
+		if p.TTL > 0 {
+			m.Context["ttl"] = strconv.Itoa(p.TTL)
+		}
+		if p.Service != nil {
+			setContext(m.Context, "service", p.Service.Name)
+			setContext(m.Context, "banner", p.Service.Banner)
+		}
+		setContext(m.Context, "timestamp", ts)
+		ms = append(ms, m)
+	}
+	return ms
+}
+
+// masscanList returns the match on line n of masscan’s list output, which
+// begins at off, as “open tcp 80 10.0.0.1 1560000000” or, for a banner,
+// “banner tcp 80 10.0.0.1 1560000000 http HTTP/1.0 200 OK”, or none if it
+// isn’t one.
+func masscanList(line []byte, n int, off int64) []Match {
+	f := strings.SplitN(string(line), " ", 7)
+	if len(f) < 5 {
+		return nil
+	}
+	ip, ok := ParseIP([]byte(f[3]))
+	if !ok {
+		return nil
+	}
+	m := fieldMatch(ip, f[3], "ip", n, off, len(f[0])+len(f[1])+len(f[2])+3)
+	m.Text = append([]byte(nil), line...)
+	m.Context = map[string]string{"port": f[2], "proto": f[1], "timestamp": f[4]}
+	if f[0] == "banner" && len(f) > 5 {
+		m.Context["service"] = f[5]
+		if len(f) > 6 {
+			m.Context["banner"] = f[6]
+		}
+	} else {
+		m.Context["status"] = f[0]
+	}
+	return []Match{m}
+}
+
+// setContext sets context[k] to v, unless v is empty.
+func setContext(context map[string]string, k, v string) {
+	if v != "" {
+		context[k] = v
+	}
+}
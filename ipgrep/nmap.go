@@ -0,0 +1,262 @@
+package ipgrep
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+// nmapParser reads the hosts nmap scanned from its XML output (-oX) or its
+// greppable output (-oG), telling them apart by how the input begins. Each
+// address is a match in the field "host", with the context nmap gives it:
+// its "status", "hostname", and open "ports", as in “22/tcp ssh, 80/tcp”.
+type nmapParser struct{}
+
+func (nmapParser) Name() string { return "nmap" }
+
+func (nmapParser) Parse(r io.Reader, emit func(Match) error) error {
+	br := bufio.NewReader(r)
+	b, _ := br.Peek(512) // an error reading shows up again when parsing.
+	if bytes.HasPrefix(bytes.TrimLeft(b, " \t\r\n\ufeff"), []byte("<")) {
+		return parseNmapXML(br, emit)
+	}
+	return parseNmapGreppable(br, emit)
+}
+
+// nmapHost is what parseNmapXML has read of a <host> element so far.
+type nmapHost struct {
+	addrs     []Match
+	context   map[string]string
+	hostnames []string
+	ports     []string // those open.
+
+	port, state, service string // of the <port> being read.
+}
+
+// parseNmapXML reads nmap’s XML output, emitting the addresses of each host
+// once its element ends, as that is where its ports have been read.
+func parseNmapXML(r *bufio.Reader, emit func(Match) error) error {
+	var (
+		in = &xmlInput{r: r}
+		d  = xml.NewDecoder(in)
+		h  *nmapHost
+	)
+	for {
+		line, col := d.InputPos()
+		off := d.InputOffset()
+		tok, err := d.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if h == nil {
+			if t, ok := tok.(xml.StartElement); ok && t.Name.Local == "host" {
+				h = &nmapHost{context: make(map[string]string)}
+			}
+			continue // as in <hosthint>, which may name hosts that go unscanned.
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "address":
+				if kind := xmlAttr(t, "addrtype"); kind != "ipv4" && kind != "ipv6" {
+					break // a MAC address.
+				}
+				text := xmlAttr(t, "addr")
+				if ip, ok := ParseIP([]byte(text)); ok {
+					h.addrs = append(h.addrs, in.match(ip, text, line, off-int64(col-1), col-1))
+				}
+			case "status":
+				h.context["status"] = xmlAttr(t, "state")
+			case "hostname":
+				h.hostnames = append(h.hostnames, xmlAttr(t, "name"))
+			case "port":
+				h.port = xmlAttr(t, "portid") + "/" + xmlAttr(t, "protocol")
+				h.state, h.service = "", ""
+			case "state":
+				h.state = xmlAttr(t, "state")
+			case "service":
+				h.service = xmlAttr(t, "name")
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "port":
+				if h.state == "open" {
+					h.ports = append(h.ports, nmapPort(h.port, h.service))
+				}
+			case "host":
+				if err := h.emit(emit); err != nil {
+					return err
+				}
+				h = nil
+			}
+		}
+	}
+}
+
+// xmlInput is the input of an xml.Decoder, which reads it a byte at a time,
+// keeping what it has read of the current line, for the Text of matches.
+type xmlInput struct {
+	r    *bufio.Reader
+	line []byte
+}
+
+func (in *xmlInput) Read(p []byte) (int, error) {
+	n, err := in.r.Read(p)
+	for _, c := range p[:n] {
+		in.keep(c)
+	}
+	return n, err
+}
+
+func (in *xmlInput) ReadByte() (byte, error) {
+	c, err := in.r.ReadByte()
+	if err == nil {
+		in.keep(c)
+	}
+	return c, err
+}
+
+func (in *xmlInput) keep(c byte) {
+	switch {
+	case c == '\n':
+		in.line = in.line[:0]
+	case len(in.line) < maxLine:
+		in.line = append(in.line, c)
+	}
+}
+
+// match returns the match of ip, found as text in an element just read at
+// col, counting from 0, of line n, which begins at off, pointing to text
+// itself if it can be told apart there.
+func (in *xmlInput) match(ip netip.Addr, text string, n int, off int64, col int) Match {
+	if col < len(in.line) {
+		if i := bytes.Index(in.line[col:], []byte(`"`+text+`"`)); i >= 0 {
+			col += i + 1
+		}
+	}
+	m := fieldMatch(ip, text, "host", n, off, col)
+	m.Text = append([]byte(nil), in.line...)
+	return m
+}
+
+// emit emits the addresses of h, with what was read of it.
+func (h *nmapHost) emit(emit func(Match) error) error {
+	if len(h.hostnames) > 0 {
+		h.context["hostname"] = strings.Join(slices.Compact(h.hostnames), ", ")
+	}
+	if len(h.ports) > 0 {
+		h.context["ports"] = strings.Join(h.ports, ", ")
+	}
+	for _, m := range h.addrs {
+		m.Context = h.context
+		if err := emit(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseNmapGreppable reads nmap’s greppable output, a line for each host
+// seen but, when ports were scanned, a second for its ports. A host’s Status
+// line is held back, so that it can be emitted as part of the match for its
+// Ports line instead, if it has one, rather than making two of each host.
+func parseNmapGreppable(r io.Reader, emit func(Match) error) error {
+	var held *Match // a Status line, not yet emitted.
+	err := readLines(r, func(n int, off int64, line []byte) error {
+		m, status, ok := nmapGreppableHost(n, off, line)
+		if !ok {
+			return nil
+		}
+		if held != nil {
+			h := *held
+			held = nil
+			if status || h.IP != m.IP {
+				if err := emit(h); err != nil {
+					return err
+				}
+			} else if s, ok := h.Context["status"]; ok {
+				m.Context["status"] = s
+			}
+		}
+		if status {
+			held = &m
+			return nil
+		}
+		return emit(m)
+	})
+	if err == nil && held != nil {
+		err = emit(*held)
+	}
+	return err
+}
+
+// nmapGreppableHost returns the match for a line of nmap’s greppable output,
+// and whether it is a Status line, unless it names no host.
+func nmapGreppableHost(n int, off int64, line []byte) (m Match, status, ok bool) {
+	const prefix = "Host: "
+	rest, ok := bytes.CutPrefix(line, []byte(prefix))
+	if !ok {
+		return Match{}, false, false // a comment.
+	}
+	fields := strings.Split(string(rest), "\t")
+	addr, name, _ := strings.Cut(fields[0], " ")
+	ip, ok := ParseIP([]byte(addr))
+	if !ok {
+		return Match{}, false, false
+	}
+	m = fieldMatch(ip, addr, "host", n, off, len(prefix))
+	m.Text = append([]byte(nil), line...)
+	m.Context = make(map[string]string)
+	if name = strings.Trim(name, "()"); name != "" {
+		m.Context["hostname"] = name
+	}
+	for _, f := range fields[1:] {
+		k, v, _ := strings.Cut(f, ": ")
+		switch k {
+		case "Status":
+			m.Context["status"], status = v, true
+		case "Ports":
+			var open []string
+			for _, p := range strings.Split(v, ", ") {
+				// port/state/protocol/owner/service/rpc info/version/
+				parts := strings.Split(p, "/")
+				if len(parts) > 4 && parts[1] == "open" {
+					open = append(open, nmapPort(parts[0]+"/"+parts[2], parts[4]))
+				}
+			}
+			if len(open) > 0 {
+				m.Context["ports"] = strings.Join(open, ", ")
+			}
+		case "OS":
+			m.Context["os"] = v
+		}
+	}
+	return m, status, true
+}
+
+// nmapPort describes an open port, as “22/tcp ssh”, or just “22/tcp” if its
+// service is unknown.
+func nmapPort(port, service string) string {
+	if service == "" {
+		return port
+	}
+	return port + " " + service
+}
+
+// xmlAttr returns the value of the attribute of t with the given name, or ""
+// if it has none.
+func xmlAttr(t xml.StartElement, name string) string {
+	for _, a := range t.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
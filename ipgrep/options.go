@@ -0,0 +1,167 @@
+package ipgrep
+
+import (
+	"bytes"
+	"errors"
+	"net/netip"
+	"strconv"
+)
+
+// ErrTooLarge is the error with which a Scanner stops upon reading more of
+// its input than WithMaxBytes allows.
+var ErrTooLarge = errors.New("input too large")
+
+// Option configures a Scanner, as given to NewScanner and the functions
+// built on it.
+type Option func(*config)
+
+// config is what Options set. Its zero value finds every IP address, split
+// out by IsSeparator, with no limits.
+type config struct {
+	separator  func(rune) bool
+	lenient    bool
+	noIPv4     bool
+	noIPv6     bool
+	unique     bool
+	maxMatches int
+	maxBytes   int64
+	extractors []Extractor
+	parser     Parser
+	source     string
+	lines      func(n int, text []byte)
+}
+
+func newConfig(opts []Option) config {
+	c := config{separator: IsSeparator}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c
+}
+
+// WithSeparators splits text into words with isSeparator rather than
+// IsSeparator, as for input whose addresses are set off by characters
+// IsSeparator doesn’t consider, or run into punctuation it does.
+func WithSeparators(isSeparator func(rune) bool) Option {
+	return func(c *config) { c.separator = isSeparator }
+}
+
+// WithLenientParsing also accepts words that are IP addresses but for a
+// trailing ‘.’ or ‘:’, as at the end of a sentence, and IPv4 addresses with
+// leading zeros, as in 010.000.000.001, which are read as decimal.
+func WithLenientParsing() Option {
+	return func(c *config) { c.lenient = true }
+}
+
+// WithIPv4Only finds only IPv4 addresses.
+func WithIPv4Only() Option {
+	return func(c *config) { c.noIPv4, c.noIPv6 = false, true }
+}
+
+// WithIPv6Only finds only IPv6 addresses.
+func WithIPv6Only() Option {
+	return func(c *config) { c.noIPv4, c.noIPv6 = true, false }
+}
+
+// WithUnique returns each artifact only the first time it is found.
+func WithUnique() Option {
+	return func(c *config) { c.unique = true }
+}
+
+// WithMaxMatches ends the scan, without an error, once n matches are found.
+func WithMaxMatches(n int) Option {
+	return func(c *config) { c.maxMatches = n }
+}
+
+// WithMaxBytes stops the scan with ErrTooLarge once more than n bytes of
+// its input are read.
+func WithMaxBytes(n int64) Option {
+	return func(c *config) { c.maxBytes = n }
+}
+
+// WithExtractors finds artifacts with es rather than just the IP Extractor;
+// each line’s artifacts are returned extractor by extractor, in the order
+// given. In a line too long to hold, read in pieces, a word cut in two by
+// the end of a piece is put back together for them if it is no longer than
+// a piece, 64 KB, and otherwise skipped.
+func WithExtractors(es ...Extractor) Option {
+	return func(c *config) { c.extractors = es }
+}
+
+// maxCarry returns the longest word a Scanner configured by c puts back
+// together when it is cut in two by the end of a piece of a line: the
+// longest IP address, unless other Extractors are used, which may look for
+// longer artifacts.
+func (c *config) maxCarry() int {
+	for _, e := range c.extractors {
+		if e != IPs {
+			return maxLine
+		}
+	}
+	return maxWord
+}
+
+// WithSource names the input, for the Source of each Match.
+func WithSource(name string) Option {
+	return func(c *config) { c.source = name }
+}
+
+// WithLines calls fn with each line the Scanner reads, numbered from 1 and
+// without its newline, before returning any matches on it, as for showing
+// them in context. A line too long to hold is given in pieces, one call
+// each, that together make it up. text is only valid until fn returns.
+func WithLines(fn func(n int, text []byte)) Option {
+	return func(c *config) { c.lines = fn }
+}
+
+// extractIPs is the IP Extractor as configured by c.
+func (c *config) extractIPs(b []byte) []Artifact {
+	var found []Artifact
+	for start := 0; start < len(b); {
+		// Skip separators, then take the word up to the next one.
+		i := bytes.IndexFunc(b[start:], func(r rune) bool { return !c.separator(r) })
+		if i < 0 {
+			break
+		}
+		start += i
+		end := len(b)
+		if j := bytes.IndexFunc(b[start:], c.separator); j >= 0 {
+			end = start + j
+		}
+		word := b[start:end]
+		ip, ok := ParseIP(word)
+		if !ok && c.lenient {
+			ip, ok = parseLenient(word)
+		}
+		if ok && !(c.noIPv4 && ip.Is4() || c.noIPv6 && ip.Is6()) {
+			found = append(found, Artifact{Kind: "ip", Text: string(word), Value: ip, Offset: start})
+		}
+		start = end
+	}
+	return found
+}
+
+// parseLenient parses word as WithLenientParsing allows, reporting whether
+// it is an IP address after all.
+func parseLenient(word []byte) (netip.Addr, bool) {
+	word = bytes.TrimRight(word, ".:")
+	if ip, ok := ParseIP(word); ok {
+		return ip, true
+	}
+	parts := bytes.Split(word, []byte("."))
+	if len(parts) != 4 {
+		return netip.Addr{}, false
+	}
+	var ip [4]byte
+	for i, p := range parts {
+		if len(p) == 0 || len(p) > 3 {
+			return netip.Addr{}, false
+		}
+		n, err := strconv.ParseUint(string(p), 10, 8)
+		if err != nil {
+			return netip.Addr{}, false
+		}
+		ip[i] = byte(n)
+	}
+	return netip.AddrFrom4(ip), true
+}
@@ -0,0 +1,389 @@
+package ipgrep
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Parser reads input in a format it knows, such as nmap’s XML output, and
+// finds the addresses in the fields of its records that hold them, rather
+// than every word that parses as one. Parse calls emit with each, in the
+// order of the input, with its IP, Artifact, Field, Line, Column, and
+// Offset set, and Text and Context where it has them, and returns the error
+// from r or emit, as it was given, that stopped it, if any. A Parser may be
+// used by more than one scan at once.
+type Parser interface {
+	Name() string
+	Parse(r io.Reader, emit func(Match) error) error
+}
+
+// SpecParser is a Parser of a family of formats, such as the access logs a
+// web server can be configured to write, that can be told which its input is
+// in by a spec, whose syntax is its own.
+type SpecParser interface {
+	Parser
+	// Specify returns a Parser of the format spec describes, or an error
+	// saying why it describes none.
+	Specify(spec string) (Parser, error)
+}
+
+// defaultAccessLogParser reads access logs in defaultAccessLog.
+var defaultAccessLogParser, _ = newAccessLogParser(defaultAccessLog)
+
+var (
+	parsersMu sync.RWMutex
+	parsers   = map[string]Parser{
+		"accesslog":  defaultAccessLogParser,
+		"cloudtrail": cloudTrailParser{},
+		"eve":        eveParser{},
+		"firewall":   firewallParser{},
+		"iis":        iisParser,
+		"masscan":    masscanParser{},
+		"nmap":       nmapParser{},
+		"pfirewall":  pfirewallParser,
+		"vpcflow":    vpcFlowParser{},
+		"zeek":       zeekParser{},
+	}
+)
+
+// RegisterParser makes p available by its name to LookupParser, beside the
+// built-in ones. It panics if a Parser of that name is registered already.
+func RegisterParser(p Parser) {
+	parsersMu.Lock()
+	defer parsersMu.Unlock()
+	if _, ok := parsers[p.Name()]; ok {
+		panic(fmt.Sprintf("ipgrep: RegisterParser called twice for parser %q", p.Name()))
+	}
+	parsers[p.Name()] = p
+}
+
+// LookupParser returns the Parser registered with name, or nil if there is
+// none.
+func LookupParser(name string) Parser {
+	parsersMu.RLock()
+	defer parsersMu.RUnlock()
+	return parsers[name]
+}
+
+// ParserFor returns the Parser named by s, which is the name of a registered
+// Parser, or, for a SpecParser, that followed by a colon and a spec, as in
+// "accesslog:%h %t \"%r\"". It returns nil, with no error, if there is no
+// Parser of that name.
+func ParserFor(s string) (Parser, error) {
+	name, spec, ok := strings.Cut(s, ":")
+	p := LookupParser(name)
+	if p == nil || !ok {
+		return p, nil
+	}
+	sp, isSpec := p.(SpecParser)
+	if !isSpec {
+		return nil, fmt.Errorf("the %v format takes no spec", name)
+	}
+	return sp.Specify(spec)
+}
+
+// Parsers returns the names of the registered Parsers, sorted.
+func Parsers() []string {
+	parsersMu.RLock()
+	defer parsersMu.RUnlock()
+	names := make([]string, 0, len(parsers))
+	for name := range parsers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// WithParser reads the input as p’s format, finding the addresses p does
+// rather than those among its words, so that WithSeparators,
+// WithLenientParsing, and WithExtractors have no effect. The other Options
+// apply as usual. p holds as much of the input at once as its format needs,
+// a whole record at least, rather than 64 KB.
+func WithParser(p Parser) Option {
+	return func(c *config) { c.parser = p }
+}
+
+// errEnough stops a Parser once no more matches are wanted.
+var errEnough = errors.New("enough matches")
+
+// parse runs the Scanner’s Parser over its input, calling fn with each match
+// the Options let through.
+func (s *Scanner) parse(fn func(Match) error) error {
+	err := s.cfg.parser.Parse(&parseInput{s: s}, func(m Match) error {
+		if s.cfg.maxMatches > 0 && s.matches >= s.cfg.maxMatches {
+			return errEnough
+		}
+		if s.cfg.noIPv4 && m.IP.Is4() || s.cfg.noIPv6 && m.IP.Is6() {
+			return nil
+		}
+		if s.seen != nil {
+			k := m.Artifact.Kind + " " + m.Artifact.Text
+			if s.seen[k] {
+				return nil
+			}
+			s.seen[k] = true
+		}
+		m.Source = s.cfg.source
+		s.matches++
+		return fn(m)
+	})
+	if err == errEnough {
+		err = nil
+	}
+	if s.err = err; err == nil {
+		s.err = io.EOF
+	}
+	return err
+}
+
+// scanParsed is Scan for a Scanner with a Parser, which pushes matches
+// rather than having them pulled, and so is run as a coroutine.
+func (s *Scanner) scanParsed() bool {
+	if s.pull == nil {
+		if s.err != nil {
+			return false
+		}
+		s.pull, s.stop = iter.Pull(func(yield func(Match) bool) {
+			s.parse(func(m Match) error {
+				if !yield(m) {
+					return errEnough
+				}
+				return nil
+			})
+		})
+	}
+	m, ok := s.pull()
+	if !ok {
+		s.stop()
+		return false
+	}
+	s.match = m
+	return true
+}
+
+// stopParser ends the coroutine running the Scanner’s Parser for Scan, if
+// there is one. Whatever loops over Scan defers it, so that breaking off
+// early doesn’t leave the coroutine suspended for good.
+func (s *Scanner) stopParser() {
+	if s.stop != nil {
+		s.stop()
+	}
+}
+
+// parseInput is a Scanner’s input as its Parser reads it. It stops the scan
+// once ctx is done or more than WithMaxBytes is read, and passes each line to
+// WithLines as it goes by.
+type parseInput struct {
+	s    *Scanner
+	line int    // lines read whole so far.
+	part []byte // the line being read, so far.
+}
+
+func (in *parseInput) Read(p []byte) (int, error) {
+	s := in.s
+	if s.ctx != nil && s.ctx.Err() != nil {
+		return 0, context.Cause(s.ctx)
+	}
+	var (
+		n   int
+		err error
+	)
+	if s.data != nil {
+		if n = copy(p, s.data[s.pos:]); n == 0 {
+			err = io.EOF
+		}
+		s.pos += n
+	} else {
+		n, err = s.r.Read(p)
+	}
+	if s.read += int64(n); s.cfg.maxBytes > 0 && s.read > s.cfg.maxBytes {
+		return 0, ErrTooLarge
+	}
+	if s.cfg.lines != nil {
+		in.lines(p[:n], err != nil)
+	}
+	return n, err
+}
+
+// lines passes the lines in b, which follows what was read before it, to
+// WithLines, holding any left unfinished until the rest is read, or end is
+// set, or it is too long to hold.
+func (in *parseInput) lines(b []byte, end bool) {
+	for {
+		i := bytes.IndexByte(b, '\n')
+		if i < 0 {
+			break
+		}
+		text := b[:i]
+		if len(in.part) > 0 {
+			text = append(in.part, text...)
+		}
+		in.line++
+		in.s.cfg.lines(in.line, text)
+		in.part, b = in.part[:0], b[i+1:]
+	}
+	in.part = append(in.part, b...)
+	if len(in.part) >= maxLine || end && len(in.part) > 0 {
+		in.s.cfg.lines(in.line+1, in.part)
+		in.part = in.part[:0]
+	}
+}
+
+// readLines calls fn with each line of r, however long, numbered from 1,
+// without its newline, and with the offset in r at which it begins, for
+// Parsers of formats with a record to a line. line is only valid until fn
+// returns.
+func readLines(r io.Reader, fn func(n int, off int64, line []byte) error) error {
+	var (
+		br   = bufio.NewReaderSize(r, maxLine)
+		n    int
+		off  int64
+		long []byte // a line longer than br’s buffer, so far.
+	)
+	for {
+		b, err := br.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			long = append(long, b...)
+			continue
+		}
+		if len(long) > 0 {
+			b = append(long, b...)
+			long = long[:0]
+		}
+		if len(b) > 0 {
+			n++
+			if err := fn(n, off, bytes.TrimSuffix(b, []byte("\n"))); err != nil {
+				return err
+			}
+			off += int64(len(b))
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// fieldMatch returns the match of ip, found as text in field, at col,
+// counting from 0, of line n, which begins at off in the input.
+func fieldMatch(ip netip.Addr, text, field string, n int, off int64, col int) Match {
+	return Match{
+		IP:       ip,
+		Artifact: Artifact{Kind: "ip", Text: text, Value: ip, Offset: col},
+		Field:    field,
+		Line:     n,
+		Column:   col + 1,
+		Offset:   off + int64(col),
+	}
+}
+
+// walkJSON reads a JSON value from d, which must use numbers, calling fn
+// with each scalar in it but null by its path, the keys leading to it joined
+// by dots, as in "alert.signature", an array’s elements sharing its path;
+// its value, a string’s unquoted, other’s as their JSON; and the offset in
+// d’s input just past it.
+func walkJSON(d *json.Decoder, path string, fn func(path, value string, str bool, end int64)) error {
+	tok, err := d.Token()
+	if err != nil {
+		return err
+	}
+	switch t := tok.(type) {
+	case json.Delim:
+		for d.More() {
+			p := path
+			if t == '{' {
+				k, err := d.Token()
+				if err != nil {
+					return err
+				}
+				if p = k.(string); path != "" {
+					p = path + "." + p
+				}
+			}
+			if err := walkJSON(d, p, fn); err != nil {
+				return err
+			}
+		}
+		_, err = d.Token() // the closing delimiter.
+		return err
+	case string:
+		fn(path, t, true, d.InputOffset())
+	case json.Number:
+		fn(path, t.String(), false, d.InputOffset())
+	case bool:
+		fn(path, strconv.FormatBool(t), false, d.InputOffset())
+	}
+	return nil
+}
+
+// jsonLine returns the matches in line n, which begins at off, a JSON object
+// whose strings that are IP addresses are found in the fields their paths
+// name, as walkJSON gives them, sharing a Context of the scalars with paths
+// in context. It returns none if the line isn’t one.
+func jsonLine(line []byte, n int, off int64, context map[string]bool) []Match {
+	var (
+		ms  []Match
+		ctx = make(map[string]string)
+	)
+	addrs, err := jsonAddrs(line, "", context, ctx)
+	if err != nil {
+		return nil
+	}
+	text := append([]byte(nil), line...)
+	for _, a := range addrs {
+		m := fieldMatch(a.ip, a.text, a.path, n, off, a.col)
+		m.Text, m.Context = text, ctx
+		ms = append(ms, m)
+	}
+	return ms
+}
+
+// jsonAddr is an address found in JSON, the string at path, at col, counting
+// from 0, in the JSON’s text.
+type jsonAddr struct {
+	ip   netip.Addr
+	text string
+	path string
+	col  int
+}
+
+// jsonAddrs returns the strings that are IP addresses in b, a JSON value at
+// path, as walkJSON gives them, setting ctx[p] to each scalar with a path p
+// in context. Each begins where the address itself does, unless it was
+// escaped, and so at its string’s opening quote instead.
+func jsonAddrs(b []byte, path string, context map[string]bool, ctx map[string]string) ([]jsonAddr, error) {
+	var (
+		addrs []jsonAddr
+		d     = json.NewDecoder(bytes.NewReader(b))
+	)
+	d.UseNumber()
+	err := walkJSON(d, path, func(path, v string, str bool, end int64) {
+		if context[path] {
+			ctx[path] = v
+		}
+		if !str {
+			return
+		}
+		if ip, ok := ParseIP([]byte(v)); ok {
+			col := int(end) - len(v) - 1
+			if !bytes.HasSuffix(b[:end], []byte(`"`+v+`"`)) {
+				col = bytes.LastIndexByte(b[:end-1], '"')
+			}
+			addrs = append(addrs, jsonAddr{ip, v, path, col})
+		}
+	})
+	return addrs, err
+}
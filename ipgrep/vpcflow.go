@@ -0,0 +1,161 @@
+package ipgrep
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// vpcFlowDefault is the fields of the default format of AWS VPC Flow Logs,
+// version 2; those of versions 3 to 5 are only ever in custom formats.
+var vpcFlowDefault = strings.Fields("version account-id interface-id srcaddr dstaddr srcport dstport protocol packets bytes start end action log-status")
+
+// vpcFlowFields are the fields a VPC Flow Log record can have, through
+// version 5, those holding addresses mapped to true.
+var vpcFlowFields = map[string]bool{
+	"srcaddr": true, "dstaddr": true, "pkt-srcaddr": true, "pkt-dstaddr": true,
+	"version": false, "account-id": false, "interface-id": false,
+	"srcport": false, "dstport": false, "protocol": false, "packets": false,
+	"bytes": false, "start": false, "end": false, "action": false,
+	"log-status": false, "vpc-id": false, "subnet-id": false,
+	"instance-id": false, "tcp-flags": false, "type": false, "region": false,
+	"az-id": false, "sublocation-type": false, "sublocation-id": false,
+	"pkt-src-aws-service": false, "pkt-dst-aws-service": false,
+	"flow-direction": false, "traffic-path": false,
+	"ecs-cluster-arn": false, "ecs-cluster-name": false,
+	"ecs-container-instance-arn": false, "ecs-container-instance-id": false,
+	"ecs-container-id": false, "ecs-second-container-id": false,
+	"ecs-service-name": false, "ecs-task-definition-arn": false,
+	"ecs-task-arn": false, "ecs-task-id": false,
+	"reject-reason": false,
+}
+
+// vpcFlowContext names the fields of a record given as the context of each
+// address in it.
+var vpcFlowContext = map[string]bool{
+	"action":         true,
+	"bytes":          true,
+	"packets":        true,
+	"srcport":        true,
+	"dstport":        true,
+	"protocol":       true,
+	"start":          true,
+	"end":            true,
+	"interface-id":   true,
+	"flow-direction": true,
+	"log-status":     true,
+}
+
+// vpcFlowParser reads AWS VPC Flow Logs, a record to a line, its fields
+// separated by spaces, in the default format, of version 2, or a custom one,
+// given as a spec or by the header line that logs delivered to S3 begin with.
+// Each address is a match in the field holding it, "srcaddr" or "dstaddr",
+// or "pkt-srcaddr" or "pkt-dstaddr", in the context of the record’s
+// "action", "bytes", "packets", ports, "protocol", "start", "end",
+// "interface-id", "flow-direction", and "log-status", where it has them.
+type vpcFlowParser struct {
+	fields []string
+}
+
+func (p vpcFlowParser) Name() string { return "vpcflow" }
+
+// Specify returns a Parser of VPC Flow Logs in format, given as AWS takes it,
+// as "${version} ${srcaddr} ${dstaddr} ${action}", or as the field names
+// alone, separated by spaces.
+func (p vpcFlowParser) Specify(format string) (Parser, error) {
+	var fields []string
+	for _, f := range strings.Fields(format) {
+		f = strings.TrimSuffix(strings.TrimPrefix(f, "${"), "}")
+		if _, ok := vpcFlowFields[f]; !ok {
+			return nil, fmt.Errorf("unknown field %q", f)
+		}
+		fields = append(fields, f)
+	}
+	if !vpcFlowAddresses(fields) {
+		return nil, errors.New("no field of an address, such as srcaddr")
+	}
+	return vpcFlowParser{fields}, nil
+}
+
+func (p vpcFlowParser) Parse(r io.Reader, emit func(Match) error) error {
+	fields := p.fields
+	if fields == nil {
+		fields = vpcFlowDefault
+	}
+	return readLines(r, func(n int, off int64, line []byte) error {
+		vals := spaced(strings.TrimSuffix(string(line), "\r"))
+		if h, ok := vpcFlowHeader(vals); ok {
+			fields = h
+			return nil
+		}
+		var (
+			ms  []Match
+			ctx = make(map[string]string)
+		)
+		for i, v := range vals {
+			if i >= len(fields) || v.text == "-" {
+				continue // NODATA or SKIPDATA.
+			}
+			if vpcFlowContext[fields[i]] {
+				ctx[fields[i]] = v.text
+			}
+			if !vpcFlowFields[fields[i]] {
+				continue
+			}
+			if ip, ok := ParseIP([]byte(v.text)); ok {
+				ms = append(ms, fieldMatch(ip, v.text, fields[i], n, off, v.col))
+			}
+		}
+		text := append([]byte(nil), line...)
+		for _, m := range ms {
+			m.Text, m.Context = text, ctx
+			if err := emit(m); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// vpcFlowHeader returns the fields of a record that vals, separated by
+// spaces, name, if they are a header line, naming nothing but fields.
+func vpcFlowHeader(vals []logValue) ([]string, bool) {
+	fields := make([]string, len(vals))
+	for i, v := range vals {
+		if _, ok := vpcFlowFields[v.text]; !ok {
+			return nil, false
+		}
+		fields[i] = v.text
+	}
+	return fields, vpcFlowAddresses(fields)
+}
+
+// vpcFlowAddresses reports whether any of fields holds addresses.
+func vpcFlowAddresses(fields []string) bool {
+	for _, f := range fields {
+		if vpcFlowFields[f] {
+			return true
+		}
+	}
+	return false
+}
+
+// spaced returns the values in line separated by spaces, and where each
+// begins.
+func spaced(line string) []logValue {
+	var vals []logValue
+	for col := 0; col < len(line); {
+		if line[col] == ' ' {
+			col++
+			continue
+		}
+		end := strings.IndexByte(line[col:], ' ')
+		if end < 0 {
+			end = len(line) - col
+		}
+		vals = append(vals, logValue{line[col : col+end], col})
+		col += end
+	}
+	return vals
+}
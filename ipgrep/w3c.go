@@ -0,0 +1,103 @@
+package ipgrep
+
+import (
+	"bytes"
+	"io"
+	"strings"
+)
+
+// w3cParser reads logs in the W3C Extended Log File Format, a record to a
+// line, its fields separated by spaces, as the last “#Fields:” directive
+// before it names them, with “-” for those with no value. Each address is a
+// match in the field holding it, in the context of the fields of its record
+// in context, where it has them.
+type w3cParser struct {
+	name    string
+	fields  []string        // those of records before any #Fields directive.
+	addrs   map[string]bool // the fields holding addresses.
+	context map[string]bool
+}
+
+// iisParser reads the logs of IIS, finding a record’s client as "c-ip" and
+// server as "s-ip", and the hosts of the X-Forwarded-For header, if it is
+// logged, in the context of its "date", "time", "s-sitename", "cs-method",
+// "cs-uri-stem", "s-port", "cs-username", "cs-host", and "sc-status". Its
+// records are in IIS’s default fields until a #Fields directive says not.
+var iisParser = &w3cParser{
+	name:   "iis",
+	fields: strings.Fields("date time s-ip cs-method cs-uri-stem cs-uri-query s-port cs-username c-ip cs(User-Agent) cs(Referer) sc-status sc-substatus sc-win32-status time-taken"),
+	addrs: map[string]bool{
+		"c-ip": true, "s-ip": true,
+		"cs(X-Forwarded-For)": true, "X-Forwarded-For": true,
+	},
+	context: map[string]bool{
+		"date": true, "time": true, "s-sitename": true, "cs-method": true,
+		"cs-uri-stem": true, "s-port": true, "cs-username": true,
+		"cs-host": true, "sc-status": true,
+	},
+}
+
+// pfirewallParser reads the logs of Windows Firewall, pfirewall.log,
+// finding the source of each packet logged as "src-ip" and its destination
+// as "dst-ip", in the context of its "date", "time", "action", "protocol",
+// "src-port", "dst-port", ICMP "icmptype" and "icmpcode", "info", "path",
+// and, as Windows 11 logs it, the "pid" of its process. Its records are in
+// the fields every version of Windows logs until a #Fields directive says.
+var pfirewallParser = &w3cParser{
+	name:   "pfirewall",
+	fields: strings.Fields("date time action protocol src-ip dst-ip src-port dst-port size tcpflags tcpsyn tcpack tcpwin icmptype icmpcode info path"),
+	addrs:  map[string]bool{"src-ip": true, "dst-ip": true},
+	context: map[string]bool{
+		"date": true, "time": true, "action": true, "protocol": true,
+		"src-port": true, "dst-port": true, "icmptype": true, "icmpcode": true,
+		"info": true, "path": true, "pid": true,
+	},
+}
+
+func (p *w3cParser) Name() string { return p.name }
+
+func (p *w3cParser) Parse(r io.Reader, emit func(Match) error) error {
+	fields := p.fields
+	return readLines(r, func(n int, off int64, line []byte) error {
+		if rest, ok := bytes.CutPrefix(line, []byte("#Fields:")); ok {
+			fields = strings.Fields(string(rest))
+			return nil
+		}
+		if bytes.HasPrefix(line, []byte("#")) {
+			return nil // another directive, as #Software or #Date.
+		}
+		var (
+			ms  []Match
+			ctx = make(map[string]string)
+		)
+		for i, v := range spaced(strings.TrimSuffix(string(line), "\r")) {
+			if i >= len(fields) || v.text == "-" {
+				continue
+			}
+			f := fields[i]
+			if p.context[f] {
+				ctx[f] = v.text
+			}
+			if !p.addrs[f] {
+				continue
+			}
+			// A chain of hosts, as X-Forwarded-For gives them, its spaces
+			// logged as “+”, holds just one address in other fields.
+			col := v.col
+			for _, hop := range strings.Split(v.text, ",") {
+				if ip, text, ok := forwardedAddr(strings.Trim(hop, "+ ")); ok {
+					ms = append(ms, fieldMatch(ip, text, f, n, off, col+strings.Index(hop, text)))
+				}
+				col += len(hop) + 1
+			}
+		}
+		text := append([]byte(nil), line...)
+		for _, m := range ms {
+			m.Text, m.Context = text, ctx
+			if err := emit(m); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
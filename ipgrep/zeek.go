@@ -0,0 +1,157 @@
+package ipgrep
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// zeekContext names the fields of a Zeek log record given as the context of
+// each address in it.
+var zeekContext = map[string]bool{
+	"_path":     true,
+	"ts":        true,
+	"uid":       true,
+	"id.orig_p": true,
+	"id.resp_p": true,
+	"proto":     true,
+	"service":   true,
+}
+
+// zeekParser reads Zeek’s logs, such as conn.log, in its usual tab-separated
+// format, described by the #fields and #types lines of its header, or as
+// JSON, a record to a line. Each address is a match in the field holding it,
+// as "id.orig_h" or "id.resp_h", in the context of the record’s "ts", "uid",
+// "id.orig_p", "id.resp_p", "proto", and "service", where it has them, and
+// the log’s "_path", such as "conn".
+type zeekParser struct{}
+
+func (zeekParser) Name() string { return "zeek" }
+
+func (zeekParser) Parse(r io.Reader, emit func(Match) error) error {
+	var l zeekLog
+	return readLines(r, func(n int, off int64, line []byte) error {
+		var ms []Match
+		switch {
+		case bytes.HasPrefix(line, []byte("#")):
+			l.header(string(line))
+			return nil
+		case bytes.HasPrefix(line, []byte("{")):
+			ms = jsonLine(line, n, off, zeekContext)
+		default:
+			ms = l.record(line, n, off)
+		}
+		for _, m := range ms {
+			if err := emit(m); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// zeekLog is what the header of a Zeek log in its tab-separated format says
+// of the records after it.
+type zeekLog struct {
+	sep, setSep   string
+	unset, empty  string
+	path          string
+	fields, types []string
+}
+
+// header reads a line of the header of a Zeek log.
+func (l *zeekLog) header(line string) {
+	if v, ok := strings.CutPrefix(line, "#separator "); ok {
+		if s, err := strconv.Unquote(`"` + v + `"`); err == nil {
+			l.sep = s // as "\x09".
+		}
+		return
+	}
+	sep := l.sep
+	if sep == "" {
+		sep = "\t"
+	}
+	k, v, _ := strings.Cut(line, sep)
+	switch k {
+	case "#set_separator":
+		l.setSep = v
+	case "#unset_field":
+		l.unset = v
+	case "#empty_field":
+		l.empty = v
+	case "#path":
+		l.path = v
+	case "#fields":
+		l.fields, l.types = strings.Split(v, sep), nil
+	case "#types":
+		l.types = strings.Split(v, sep)
+	}
+}
+
+// addr reports whether field i of l’s records holds addresses: one of type
+// addr, or a set or vector of them, or, if l has no types, any at all.
+func (l *zeekLog) addr(i int) bool {
+	if l.types == nil {
+		return true
+	}
+	if i >= len(l.types) {
+		return false
+	}
+	t := l.types[i]
+	return t == "addr" || t == "set[addr]" || t == "vector[addr]"
+}
+
+// record returns the matches in line n of l, a record, which begins at off.
+func (l *zeekLog) record(line []byte, n int, off int64) []Match {
+	if l.fields == nil {
+		return nil // no header said what its fields are.
+	}
+	sep := l.sep
+	if sep == "" {
+		sep = "\t"
+	}
+	var (
+		ms   []Match
+		ctx  = make(map[string]string)
+		vals = strings.Split(string(line), sep)
+		col  = 0
+	)
+	if l.path != "" {
+		ctx["_path"] = l.path
+	}
+	for i, v := range vals {
+		if i < len(l.fields) && v != l.unset && v != l.empty {
+			name := l.fields[i]
+			if zeekContext[name] {
+				ctx[name] = v
+			}
+			if l.addr(i) {
+				ms = append(ms, l.addrs(name, v, n, off, col)...)
+			}
+		}
+		col += len(v) + len(sep)
+	}
+	text := append([]byte(nil), line...)
+	for i := range ms {
+		ms[i].Text, ms[i].Context = text, ctx
+	}
+	return ms
+}
+
+// addrs returns the matches in v, the value of the named field at col, an
+// address or a set of them.
+func (l *zeekLog) addrs(name, v string, n int, off int64, col int) []Match {
+	elems := []string{v}
+	if l.setSep != "" {
+		elems = strings.Split(v, l.setSep)
+	}
+	var ms []Match
+	for _, e := range elems {
+		if ip, ok := ParseIP([]byte(e)); ok {
+			ms = append(ms, fieldMatch(ip, e, name, n, off, col))
+		}
+		col += len(e) + len(l.setSep)
+	}
+	return ms
+}
@@ -0,0 +1,38 @@
+package main
+
+import "sync/atomic"
+
+// budget enforces -max-total across every file scanned. It is nil if there
+// is no limit, in which case its methods allow everything.
+var budget *matchBudget
+
+// matchBudget counts down the matches a run may still make. Scans draw on
+// it concurrently.
+type matchBudget struct {
+	left int64
+}
+
+// take claims up to n matches, returning how many were granted.
+func (b *matchBudget) take(n int) int {
+	if b == nil {
+		return n
+	}
+	for {
+		left := atomic.LoadInt64(&b.left)
+		if left <= 0 {
+			return 0
+		}
+		got := int64(n)
+		if got > left {
+			got = left
+		}
+		if atomic.CompareAndSwapInt64(&b.left, left, left-got) {
+			return int(got)
+		}
+	}
+}
+
+// spent reports whether no matches are left.
+func (b *matchBudget) spent() bool {
+	return b != nil && atomic.LoadInt64(&b.left) <= 0
+}
@@ -0,0 +1,97 @@
+package main
+
+import "github.com/fatih/color"
+
+var fileColor = color.New(color.FgMagenta)
+
+// shownLines returns the lines of r that -output lines shows: each with a
+// result, and any lines of context requested around it.
+func shownLines(r *scanResult) map[int][]byte {
+	if r.Source == nil {
+		return nil
+	}
+	before, after := contextLines()
+	shown := make(map[int][]byte, len(r.Matches))
+	for _, m := range r.Matches {
+		for l := m.Line - before; l <= m.Line+after; l++ {
+			if text, ok := r.Source[l]; ok {
+				shown[l] = text
+			}
+		}
+	}
+	return shown
+}
+
+// contextLines returns the number of lines of context for -output lines to
+// print before and after each line with a result.
+func contextLines() (before, after int) {
+	before, after = *beforeContext, *afterContext
+	if before == 0 {
+		before = *aroundContext
+	}
+	if after == 0 {
+		after = *aroundContext
+	}
+	return before, after
+}
+
+// lineKeeper keeps, of the lines a scan reads, only those results are found
+// on and, for -output lines, those of context around them, so that a big file
+// needn’t be held whole to show them.
+type lineKeeper struct {
+	before, after int
+	recent        []numberedLine // the last before+1 lines read, until a match.
+	until         int            // the last line to keep after a match.
+	kept          map[int][]byte
+}
+
+type numberedLine struct {
+	n    int
+	text []byte
+}
+
+func newLineKeeper() *lineKeeper {
+	k := &lineKeeper{kept: make(map[int][]byte)}
+	if *output == "lines" {
+		k.before, k.after = contextLines()
+	}
+	return k
+}
+
+// read takes line n, or a piece of it, as the scan reads it, which is before
+// any results on it are found.
+func (k *lineKeeper) read(n int, text []byte) {
+	if _, ok := k.kept[n]; ok || n <= k.until {
+		k.kept[n] = append(k.kept[n], text...)
+		return
+	}
+	if last := len(k.recent) - 1; last >= 0 && k.recent[last].n == n {
+		k.recent[last].text = append(k.recent[last].text, text...)
+		return
+	}
+	if len(k.recent) > k.before {
+		k.recent = append(k.recent[:0], k.recent[1:]...)
+	}
+	k.recent = append(k.recent, numberedLine{n, append([]byte(nil), text...)})
+}
+
+// matched keeps line n, on which a result was found, and its context.
+func (k *lineKeeper) matched(n int) {
+	for _, l := range k.recent {
+		if l.n >= n-k.before {
+			k.kept[l.n] = l.text
+		}
+	}
+	k.recent = k.recent[:0]
+	if n+k.after > k.until {
+		k.until = n + k.after
+	}
+}
+
+// keep keeps line n, on which a result was found, as text, its line as
+// given with the result, rather than as read.
+func (k *lineKeeper) keep(n int, text []byte) {
+	if _, ok := k.kept[n]; !ok {
+		k.kept[n] = append([]byte(nil), text...)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/princebot/ipgrep/ipgrep"
+)
+
+// logger reports what ipgrep is doing, for -verbose and -debug: files
+// opened and read at the info level, and at the debug level every token
+// rejected as an IP and every lookup made. It discards everything unless
+// one of those options was given.
+var logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// setLogging applies -verbose and -debug.
+func setLogging() {
+	level := slog.LevelInfo
+	switch {
+	case *debugLog:
+		level = slog.LevelDebug
+	case !*verbose:
+		return
+	}
+	logger = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+}
+
+// debugging reports whether debug messages are logged, so that work needed
+// only for them can be skipped otherwise.
+func debugging() bool {
+	return logger.Enabled(context.Background(), slog.LevelDebug)
+}
+
+// logTokens logs, at the debug level, each token in b, a line of a file or a
+// piece of one, that looked like an IP but didn’t parse as one — the usual
+// answer to “why didn’t it find this IP?” — and returns how many tokens
+// there were.
+func logTokens(file string, b []byte) int {
+	words := bytes.FieldsFunc(b, ipgrep.IsSeparator)
+	for _, word := range words {
+		if !ipLike(word) {
+			continue
+		}
+		if _, ok := ipgrep.ParseIP(word); !ok {
+			logger.Debug("rejected token", "file", file, "token", string(word))
+		}
+	}
+	return len(words)
+}
+
+// ipLike reports whether word is made only of what IP addresses are made of
+// and has the separators of one, so that it may have been meant as one.
+func ipLike(word []byte) bool {
+	var digits, seps int
+	for _, c := range word {
+		switch {
+		case c >= '0' && c <= '9':
+			digits++
+		case c == '.' || c == ':':
+			seps++
+		case c >= 'a' && c <= 'f', c >= 'A' && c <= 'F':
+		default:
+			return false
+		}
+	}
+	return digits > 0 && seps > 0
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const manUsage = `
+usage: %[1]v man
+
+Prints %[1]v’s manual page, in roff, generated from its command-line
+definitions. To read it:
+
+	%[1]v man | man -l -
+
+To install it:
+
+	%[1]v man > /usr/local/share/man/man1/%[1]v.1
+`
+
+// manFlags holds the options of “ipgrep man”, of which there are none.
+var manFlags = flag.NewFlagSet("man", flag.ExitOnError)
+
+func init() {
+	manFlags.Usage = func() { fmt.Fprintf(os.Stderr, manUsage, prog) }
+}
+
+// manCommand implements “ipgrep man”.
+func manCommand(args []string) {
+	fs := manFlags
+	parseArgs(fs, args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	writeMan(os.Stdout, describeCLI(), time.Now())
+}
+
+// writeMan writes a man page describing cmds, dated now.
+func writeMan(w io.Writer, cmds []*cliCommand, now time.Time) {
+	fmt.Fprintf(w, ".TH %v 1 %q %q %q\n", strings.ToUpper(prog), now.Format("2006-01-02"), prog, "User Commands")
+	fmt.Fprintf(w, ".SH NAME\n%v \\- find IPv4 and IPv6 addresses in files\n", prog)
+
+	fmt.Fprintf(w, ".SH SYNOPSIS\n")
+	fmt.Fprintf(w, ".B %v\n[\\fBscan\\fR] [\\fIoptions\\fR] %v\n", prog, roff(cmds[0].Args))
+	for _, c := range cmds[1:] {
+		fmt.Fprintf(w, ".br\n.B %v %v\n", prog, c.Name)
+		var args []string
+		if len(c.Flags) > 0 {
+			args = append(args, "[\\fIoptions\\fR]")
+		}
+		if c.Args != "" {
+			args = append(args, roff(c.Args))
+		}
+		if len(args) > 0 {
+			fmt.Fprintf(w, "%v\n", strings.Join(args, " "))
+		}
+	}
+
+	fmt.Fprintf(w, ".SH DESCRIPTION\n")
+	fmt.Fprintf(w, "%v scans one or more input files for valid IPv4 or IPv6 addresses and prints the result. ", roff(prog))
+	fmt.Fprintf(w, "It accepts text files in any format (plaintext, JSON, YAML, etc.) so long as the files contain IPs separated by whitespace or by any punctuation character other than ")
+	fmt.Fprintf(w, "\\(oq.\\(cq or \\(oq:\\(cq.\n")
+	fmt.Fprintf(w, ".PP\nOptions may come before or after file names, for every command; any arguments after \\fB\\-\\-\\fR are taken as file names.\n")
+
+	fmt.Fprintf(w, ".SH COMMANDS\n")
+	for _, c := range cmds {
+		fmt.Fprintf(w, ".TP\n.B %v\n%v.\n", c.Name, roff(capitalize(c.Summary)))
+	}
+
+	fmt.Fprintf(w, ".SH OPTIONS\n")
+	writeManFlags(w, cmds[0].Flags)
+	for _, c := range cmds[1:] {
+		if len(c.Flags) == 0 || c.ScanFlags {
+			continue // its options, if any, are listed above.
+		}
+		fmt.Fprintf(w, ".SS %v options\n", c.Name)
+		writeManFlags(w, c.Flags)
+	}
+
+	fmt.Fprintf(w, ".SH ENVIRONMENT\n")
+	fmt.Fprintf(w, ".TP\n.B %vOPTION\nSets the default for the option named OPTION in upper case, with dashes as underscores, e.g. \\fB%vLOOKUP_TIMEOUT=10s\\fR.\n", envPrefix, envPrefix)
+	fmt.Fprintf(w, ".TP\n.B %vCONFIG\nNames the config file to use instead of \\fI%v\\fR.\n", envPrefix, roff(tildify(configPath("config.yaml"))))
+	fmt.Fprintf(w, ".TP\n.B NO_COLOR\nIf set, disables colored output unless \\fB\\-color always\\fR is given.\n")
+	for _, v := range []string{"SHODAN_API_KEY", "ABUSEIPDB_API_KEY", "VT_API_KEY", "GREYNOISE_API_KEY"} {
+		fmt.Fprintf(w, ".TP\n.B %v\nThe API key for the corresponding lookup.\n", v)
+	}
+
+	fmt.Fprintf(w, ".SH FILES\n")
+	fmt.Fprintf(w, ".TP\n.I %v\nOption defaults and API keys.\n", roff(tildify(configPath("config.yaml"))))
+	fmt.Fprintf(w, ".TP\n.I %v\nThreat feeds used by \\fB\\-check\\-feeds\\fR.\n", roff(tildify(configPath("feeds.json"))))
+	fmt.Fprintf(w, ".TP\n.I %v\nThe lookup cache and stored feeds.\n", roff(tildify(cacheDir())))
+
+	fmt.Fprintf(w, ".SH EXIT STATUS\n")
+	fmt.Fprintf(w, ".TP\n.B 0\nSuccess; with \\fB\\-quiet\\fR, some IPs were found.\n")
+	fmt.Fprintf(w, ".TP\n.B %d\nWith \\fB\\-quiet\\fR, no IPs were found, or with \\fB\\-pick\\fR, none were chosen.\n", exitNoMatch)
+	fmt.Fprintf(w, ".TP\n.B %d\nAn error occurred, or the command line was invalid.\n", exitError)
+	fmt.Fprintf(w, ".TP\n.B %d\nA result matched \\fB\\-watchlist\\fR.\n", exitWatchlistHit)
+	fmt.Fprintf(w, ".TP\n.B %d\nAn input file was empty or could not be opened or read, or with \\fB\\-in\\-place\\fR, rewritten.\n", exitUnreadable)
+	fmt.Fprintf(w, ".TP\n.B %d\nAn input file was not scanned within \\fB\\-timeout\\fR or \\fB\\-file\\-timeout\\fR.\n", exitTimedOut)
+	fmt.Fprintf(w, ".TP\n.B %d\nScanning was interrupted by SIGINT or SIGTERM; the results printed are partial.\n", exitInterrupted)
+}
+
+// writeManFlags writes a man page entry for each of flags.
+func writeManFlags(w io.Writer, flags []cliFlag) {
+	for _, f := range flags {
+		fmt.Fprintf(w, ".TP\n\\fB%v\\fR", roff("-"+f.Name))
+		if !f.Bool {
+			fmt.Fprintf(w, " \\fI%v\\fR", roff(strings.ToUpper(f.Arg)))
+		}
+		fmt.Fprintf(w, "\n%v", roff(capitalize(f.Usage)))
+		if f.Default != "" && f.Default != "false" && f.Default != "0" {
+			fmt.Fprintf(w, " (default %v)", roff(tildify(f.Default)))
+		}
+		fmt.Fprintf(w, ".\n")
+	}
+}
+
+// roff escapes s for use in running text.
+func roff(s string) string {
+	s = strings.NewReplacer(`\`, `\e`, "-", `\-`).Replace(s)
+	if strings.HasPrefix(s, ".") || strings.HasPrefix(s, "'") {
+		s = `\&` + s
+	}
+	return s
+}
+
+// tildify abbreviates a path under the user’s home directory, so the man
+// page doesn’t depend on who generated it.
+func tildify(path string) string {
+	home, err := os.UserHomeDir()
+	if err != nil || home == "" || !strings.HasPrefix(path, home+string(filepath.Separator)) {
+		return path
+	}
+	return "~" + path[len(home):]
+}
+
+// capitalize returns s with its first letter in upper case.
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
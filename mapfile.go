@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/princebot/ipgrep/ipgrep"
+)
+
+// ipMapping is the -map-file mapping, if one was given.
+var ipMapping *ipMap
+
+// ipMap rewrites IPs according to a -map-file.
+type ipMap struct {
+	ips      map[netip.Addr]netip.Addr
+	prefixes []prefixMapping // longest prefix first.
+}
+
+// prefixMapping moves the addresses in one prefix to another of the same
+// length, keeping their host bits.
+type prefixMapping struct {
+	from, to netip.Prefix
+}
+
+// loadIPMap reads a -map-file: CSV rows of an old IP and its new one, or an
+// old prefix and a new prefix of the same length. Blank lines and lines
+// starting with ‘#’ are ignored, as is a header row.
+func loadIPMap(path string) (*ipMap, error) {
+	fp, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+	r := csv.NewReader(fp)
+	r.Comment = '#'
+	r.FieldsPerRecord = 2
+	r.TrimLeadingSpace = true
+	m := &ipMap{ips: make(map[netip.Addr]netip.Addr)}
+	for row := 1; ; row++ {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", path, err)
+		}
+		from, to := strings.TrimSpace(rec[0]), strings.TrimSpace(rec[1])
+		if err := m.add(from, to); err != nil {
+			if _, ok := ipgrep.ParseIP([]byte(from)); row == 1 && !ok && !strings.Contains(from, "/") {
+				continue // a header.
+			}
+			line, _ := r.FieldPos(0)
+			return nil, fmt.Errorf("%v:%d: %v", path, line, err)
+		}
+	}
+	sort.SliceStable(m.prefixes, func(i, j int) bool {
+		return m.prefixes[i].from.Bits() > m.prefixes[j].from.Bits()
+	})
+	return m, nil
+}
+
+// add maps from to to, both IPs or both prefixes.
+func (m *ipMap) add(from, to string) error {
+	a, okA := ipgrep.ParseIP([]byte(from))
+	b, okB := ipgrep.ParseIP([]byte(to))
+	if okA && okB {
+		m.ips[a] = b
+		return nil
+	}
+	pa, err := netip.ParsePrefix(from)
+	if err != nil {
+		return fmt.Errorf("invalid mapping %v → %v", from, to)
+	}
+	pb, err := netip.ParsePrefix(to)
+	if err != nil {
+		return fmt.Errorf("invalid mapping %v → %v", from, to)
+	}
+	pa, pb = pa.Masked(), pb.Masked()
+	if pa.Addr().Is4() != pb.Addr().Is4() || pa.Bits() != pb.Bits() {
+		return fmt.Errorf("can’t map %v to %v: prefixes differ in family or length", pa, pb)
+	}
+	m.prefixes = append(m.prefixes, prefixMapping{pa, pb})
+	return nil
+}
+
+// lookup returns the new address for ip, or the zero Addr if it isn’t
+// mapped.
+func (m *ipMap) lookup(ip netip.Addr) netip.Addr {
+	if to, ok := m.ips[ip]; ok {
+		return to
+	}
+	for _, p := range m.prefixes {
+		if !p.from.Contains(ip) {
+			continue
+		}
+		var (
+			addr = ip.AsSlice()
+			to   = p.to.Addr().AsSlice()
+			bits = p.from.Bits()
+		)
+		for i := range addr {
+			// The prefix covers the first bits of the address.
+			mask := byte(0xff)
+			if n := bits - i*8; n <= 0 {
+				mask = 0
+			} else if n < 8 {
+				mask <<= 8 - n
+			}
+			addr[i] = to[i] | addr[i]&^mask
+		}
+		out, _ := netip.AddrFromSlice(addr)
+		return out
+	}
+	return netip.Addr{}
+}
+
+// replace returns the new form of ip, or ip itself if it isn’t mapped.
+func (m *ipMap) replace(ip netip.Addr) string {
+	if to := m.lookup(ip); to.IsValid() {
+		return to.String()
+	}
+	return ip.String()
+}
+
+// checkMapped dies, listing them, if any IPs in the named files are not
+// mapped by m.
+func checkMapped(m *ipMap, names []string) {
+	scanned, failed := scanFiles(names)
+	for _, r := range failed {
+		if !errors.Is(r.Err, ipgrep.ErrEmptyInput) {
+			die(r)
+		}
+	}
+	var unmapped []string
+	for _, ip := range unique(scanned) {
+		if !m.lookup(ip).IsValid() {
+			unmapped = append(unmapped, ip.String())
+		}
+	}
+	if len(unmapped) > 0 {
+		die(fmt.Sprintf("-map-file has no mapping for %v", strings.Join(unmapped, ", ")))
+	}
+}
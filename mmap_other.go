@@ -0,0 +1,14 @@
+//go:build !unix
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// mmapFile reports that -mmap isn’t supported here, so files are read as
+// usual.
+func mmapFile(fp *os.File, size int64) ([]byte, func() error, error) {
+	return nil, nil, errors.New("memory mapping not supported on this platform")
+}
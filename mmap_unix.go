@@ -0,0 +1,21 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// mmapFile maps the regular file fp into memory for -mmap, returning its
+// content and a function that unmaps it. The pages are read in by the
+// kernel as the scan reaches them, ahead of it since it reads them in order.
+func mmapFile(fp *os.File, size int64) ([]byte, func() error, error) {
+	b, err := unix.Mmap(int(fp.Fd()), 0, int(size), unix.PROT_READ, unix.MAP_SHARED)
+	if err != nil {
+		return nil, nil, err
+	}
+	unix.Madvise(b, unix.MADV_SEQUENTIAL)
+	return b, func() error { return unix.Munmap(b) }, nil
+}
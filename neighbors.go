@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+const neighborsUsage = `
+usage: %[1]v neighbors [options]
+
+Lists the hosts in the system’s ARP and IPv6 neighbor tables, those it has
+seen on its own links lately, and scans them as a file would be scanned, so
+that every option of a scan applies to their addresses, as during triage on
+a host: -output json finds each in the field "address", in the context of
+its "mac" address, if it has been resolved, its "state", and its
+"interface". Multicast and broadcast entries aren’t hosts, and are left out.
+
+	%[1]v neighbors -classify
+	%[1]v neighbors -watchlist known.txt -output json
+
+Neighbors are read from the kernel on Linux, over netlink, from the IP
+Helper API on Windows, and from arp -an and ndp -an elsewhere.
+`
+
+// neighborsInput is the name of the input neighbors makes of the table.
+const neighborsInput = "neighbors"
+
+// neighborsCommand implements “ipgrep neighbors”.
+func neighborsCommand(args []string) {
+	tableArgs("neighbors", neighborsUsage, args)
+	ns, err := neighbors()
+	if err != nil {
+		die(fmt.Errorf("listing neighbors: %w", err))
+	}
+	scanTable(neighborsInput, neighborTable(ns), tableParser{"neighbors", "address"})
+}
+
+// neighbor is an entry of the system’s ARP or IPv6 neighbor table: the
+// address of a host on one of its links, its link-layer address, if it has
+// been resolved, the state of the entry, as the system names it, if it
+// says, and the interface of the link.
+type neighbor struct {
+	addr  netip.Addr
+	mac   string
+	state string
+	iface string
+}
+
+// neighborTable returns a table of ns, but those that aren’t hosts, with a
+// line for each after a header, as
+//
+//	address mac state interface
+//	10.0.0.1 00:11:22:33:44:55 REACHABLE eth0
+//
+// with “-” for whatever isn’t known. Addresses lose their zones.
+func neighborTable(ns []neighbor) []byte {
+	var b bytes.Buffer
+	b.WriteString("address mac state interface\n")
+	for _, n := range ns {
+		if !n.addr.IsValid() || n.addr.IsMulticast() || strings.EqualFold(n.mac, "ff:ff:ff:ff:ff:ff") {
+			continue
+		}
+		fmt.Fprintf(&b, "%v %v %v %v\n", n.addr.WithZone("").Unmap(), orMissing(n.mac), orMissing(n.state), orMissing(n.iface))
+	}
+	return b.Bytes()
+}
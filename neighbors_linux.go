@@ -0,0 +1,72 @@
+//go:build linux
+
+package main
+
+import (
+	"encoding/binary"
+	"net"
+	"net/netip"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// nudStates names the states of neighbor table entries, as ip neigh does.
+var nudStates = map[uint16]string{
+	unix.NUD_INCOMPLETE: "INCOMPLETE", unix.NUD_REACHABLE: "REACHABLE",
+	unix.NUD_STALE: "STALE", unix.NUD_DELAY: "DELAY", unix.NUD_PROBE: "PROBE",
+	unix.NUD_FAILED: "FAILED", unix.NUD_PERMANENT: "PERMANENT",
+}
+
+// neighbors returns the entries of the kernel’s neighbor tables, for IPv4
+// and IPv6, as netlink dumps them, but those of links without ARP, as
+// loopback and tunnels are.
+func neighbors() ([]neighbor, error) {
+	b, err := syscall.NetlinkRIB(syscall.RTM_GETNEIGH, syscall.AF_UNSPEC)
+	if err != nil {
+		return nil, os.NewSyscallError("netlinkrib", err)
+	}
+	msgs, err := syscall.ParseNetlinkMessage(b)
+	if err != nil {
+		return nil, os.NewSyscallError("parsenetlinkmessage", err)
+	}
+	var (
+		ns     []neighbor
+		ifaces = make(map[int]string)
+	)
+	for _, m := range msgs {
+		if m.Header.Type != syscall.RTM_NEWNEIGH || len(m.Data) < unix.SizeofNdMsg {
+			continue
+		}
+		// An ndmsg: family, padding, ifindex, state, flags, and type; then
+		// its attributes, each its length and type, then its value,
+		// padded to four bytes.
+		index, state := int(int32(binary.NativeEndian.Uint32(m.Data[4:]))), binary.NativeEndian.Uint16(m.Data[8:])
+		if state&unix.NUD_NOARP != 0 {
+			continue
+		}
+		n := neighbor{state: nudStates[state]}
+		for a := m.Data[unix.SizeofNdMsg:]; len(a) >= 4; {
+			l, typ := int(binary.NativeEndian.Uint16(a)), binary.NativeEndian.Uint16(a[2:])
+			if l < 4 || l > len(a) {
+				break
+			}
+			switch v := a[4:l]; typ {
+			case unix.NDA_DST:
+				n.addr, _ = netip.AddrFromSlice(v)
+			case unix.NDA_LLADDR:
+				n.mac = net.HardwareAddr(v).String()
+			}
+			a = a[min((l+3)&^3, len(a)):]
+		}
+		if _, ok := ifaces[index]; !ok {
+			if iface, err := net.InterfaceByIndex(index); err == nil {
+				ifaces[index] = iface.Name
+			}
+		}
+		n.iface = ifaces[index]
+		ns = append(ns, n)
+	}
+	return ns, nil
+}
@@ -0,0 +1,108 @@
+//go:build !linux && !windows
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net/netip"
+	"os/exec"
+	"strings"
+)
+
+// ndpStates names the states of IPv6 neighbors as ndp abbreviates them.
+var ndpStates = map[string]string{
+	"N": "NOSTATE", "W": "WAITDELETE", "I": "INCOMPLETE", "R": "REACHABLE",
+	"S": "STALE", "D": "DELAY", "P": "PROBE",
+}
+
+// neighbors returns the entries of the system’s ARP table, as arp -an lists
+// them, and of its IPv6 neighbor table, as ndp -an does, if it has one.
+func neighbors() ([]neighbor, error) {
+	out, err := exec.Command("arp", "-an").Output()
+	if err != nil {
+		return nil, err
+	}
+	ns := arpNeighbors(out)
+	out, err = exec.Command("ndp", "-an").Output()
+	if errors.Is(err, exec.ErrNotFound) {
+		return ns, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return append(ns, ndpNeighbors(out)...), nil
+}
+
+// arpNeighbors returns the entries arp -an lists in out, as on macOS and
+// FreeBSD, as in
+//
+//	? (10.0.0.1) at 0:11:22:33:44:55 on en0 ifscope [ethernet]
+//	? (10.0.0.7) at (incomplete) on en0 ifscope [ethernet]
+//
+// or as on OpenBSD, in a table of the address, MAC address, and interface.
+func arpNeighbors(out []byte) []neighbor {
+	var (
+		ns []neighbor
+		sc = bufio.NewScanner(bytes.NewReader(out))
+	)
+	for sc.Scan() {
+		row := strings.Fields(sc.Text())
+		if len(row) >= 6 && row[2] == "at" && row[4] == "on" {
+			ip, err := netip.ParseAddr(strings.Trim(row[1], "()"))
+			if err != nil {
+				continue
+			}
+			n := neighbor{addr: ip, mac: row[3], iface: row[5]}
+			switch {
+			case n.mac == "(incomplete)":
+				n.mac, n.state = "", "INCOMPLETE"
+			case strings.Contains(sc.Text(), " permanent"):
+				n.state = "PERMANENT"
+			}
+			ns = append(ns, n)
+		} else if len(row) >= 3 {
+			ip, err := netip.ParseAddr(row[0])
+			if err != nil {
+				continue // the header.
+			}
+			n := neighbor{addr: ip, mac: row[1], iface: row[2]}
+			if n.mac == "(incomplete)" {
+				n.mac, n.state = "", "INCOMPLETE"
+			}
+			ns = append(ns, n)
+		}
+	}
+	return ns
+}
+
+// ndpNeighbors returns the entries ndp -an lists in out, in a table of the
+// address, link-layer address, interface, time to expiry, and state, as in
+//
+//	fe80::1%en0      0:11:22:33:44:55   en0 23h59m58s  S R
+func ndpNeighbors(out []byte) []neighbor {
+	var (
+		ns []neighbor
+		sc = bufio.NewScanner(bytes.NewReader(out))
+	)
+	for sc.Scan() {
+		row := strings.Fields(sc.Text())
+		if len(row) < 3 {
+			continue
+		}
+		ip, err := netip.ParseAddr(row[0])
+		if err != nil {
+			continue // the header.
+		}
+		n := neighbor{addr: ip, mac: row[1], iface: row[2]}
+		if n.mac == "(incomplete)" {
+			n.mac = ""
+		}
+		if len(row) > 4 {
+			n.state = ndpStates[row[4]]
+		}
+		ns = append(ns, n)
+	}
+	return ns
+}
@@ -0,0 +1,70 @@
+//go:build windows
+
+package main
+
+import (
+	"encoding/binary"
+	"net"
+	"net/netip"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	procGetIpNetTable2 = iphlpapi.NewProc("GetIpNetTable2")
+	procFreeMibTable   = iphlpapi.NewProc("FreeMibTable")
+)
+
+// nlNeighborStates names the states of NL_NEIGHBOR_STATE, from 0.
+var nlNeighborStates = []string{"UNREACHABLE", "INCOMPLETE", "PROBE", "DELAY", "STALE", "REACHABLE", "PERMANENT"}
+
+// neighbors returns the entries of the system’s neighbor table, for IPv4
+// and IPv6, from GetIpNetTable2.
+func neighbors() ([]neighbor, error) {
+	var table unsafe.Pointer
+	if r, _, _ := procGetIpNetTable2.Call(windows.AF_UNSPEC, uintptr(unsafe.Pointer(&table))); r != 0 {
+		return nil, windows.Errno(r)
+	}
+	defer procFreeMibTable.Call(uintptr(table))
+	// A MIB_IPNET_TABLE2: the number of rows, then, aligned to eight
+	// bytes, each MIB_IPNET_ROW2: a SOCKADDR_INET, the interface’s index
+	// and LUID, the physical address and its length, the state, flags,
+	// and the time it was last reachable.
+	const size = 88
+	var (
+		n      = int(*(*uint32)(table))
+		rows   = unsafe.Slice((*byte)(unsafe.Add(table, 8)), n*size)
+		ns     []neighbor
+		ifaces = make(map[int]string)
+	)
+	for i := range n {
+		var (
+			row   = rows[i*size : (i+1)*size]
+			nb    neighbor
+			index = int(binary.LittleEndian.Uint32(row[28:]))
+			phys  = min(binary.LittleEndian.Uint32(row[72:]), 32)
+			state = binary.LittleEndian.Uint32(row[76:])
+		)
+		switch binary.LittleEndian.Uint16(row) {
+		case windows.AF_INET:
+			nb.addr = netip.AddrFrom4([4]byte(row[4:8]))
+		case windows.AF_INET6:
+			nb.addr = netip.AddrFrom16([16]byte(row[8:24]))
+		}
+		if phys > 0 {
+			nb.mac = net.HardwareAddr(row[40 : 40+phys]).String()
+		}
+		if int(state) < len(nlNeighborStates) {
+			nb.state = nlNeighborStates[state]
+		}
+		if _, ok := ifaces[index]; !ok {
+			if iface, err := net.InterfaceByIndex(index); err == nil {
+				ifaces[index] = iface.Name
+			}
+		}
+		nb.iface = ifaces[index]
+		ns = append(ns, nb)
+	}
+	return ns, nil
+}
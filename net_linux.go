@@ -0,0 +1,114 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// tcpStates names the states of TCP sockets as /proc/net/tcp numbers them.
+var tcpStates = map[string]string{
+	"01": "ESTABLISHED", "02": "SYN_SENT", "03": "SYN_RECV", "04": "FIN_WAIT1",
+	"05": "FIN_WAIT2", "06": "TIME_WAIT", "07": "CLOSE", "08": "CLOSE_WAIT",
+	"09": "LAST_ACK", "0A": "LISTEN", "0B": "CLOSING",
+}
+
+// connections returns the system’s connections, as /proc/net lists them,
+// with the processes they belong to, as far as /proc lets them be seen.
+func connections() ([]conn, error) {
+	var (
+		conns  []conn
+		owners = socketOwners()
+	)
+	for _, proto := range []string{"tcp", "tcp6", "udp", "udp6"} {
+		cs, err := procNet(proto, owners)
+		if os.IsNotExist(err) {
+			continue // as for IPv6, if it is disabled.
+		}
+		if err != nil {
+			return nil, err
+		}
+		conns = append(conns, cs...)
+	}
+	return conns, nil
+}
+
+// procNet returns the sockets in /proc/net/proto, with the pids of those
+// whose inodes owners has, and their commands.
+func procNet(proto string, owners map[string]int) ([]conn, error) {
+	f, err := os.Open("/proc/net/" + proto)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var (
+		conns []conn
+		sc    = bufio.NewScanner(f)
+	)
+	sc.Scan() // the header.
+	for sc.Scan() {
+		// sl local_address rem_address st tx_queue:rx_queue tr:tm->when
+		// retrnsmt uid timeout inode ...
+		row := strings.Fields(sc.Text())
+		if len(row) < 10 {
+			continue
+		}
+		var (
+			c        = conn{proto: strings.TrimSuffix(proto, "6"), pid: owners[row[9]]}
+			ok1, ok2 bool
+		)
+		c.local, ok1 = procNetAddr(row[1])
+		c.remote, ok2 = procNetAddr(row[2])
+		if !ok1 || !ok2 {
+			continue
+		}
+		if c.proto == "tcp" {
+			c.state = tcpStates[row[3]]
+		}
+		if c.pid > 0 {
+			comm, _ := os.ReadFile(filepath.Join("/proc", strconv.Itoa(c.pid), "comm"))
+			c.process = strings.TrimSpace(string(comm))
+		}
+		conns = append(conns, c)
+	}
+	return conns, sc.Err()
+}
+
+// procNetAddr parses an address as /proc/net gives it, as “0100007F:0016”:
+// in hex, its 32-bit words in the machine’s byte order, then its port.
+func procNetAddr(s string) (netip.AddrPort, bool) {
+	addr, port, ok := strings.Cut(s, ":")
+	b, err := hex.DecodeString(addr)
+	p, perr := strconv.ParseUint(port, 16, 16)
+	if !ok || err != nil || perr != nil || len(b) != 4 && len(b) != 16 {
+		return netip.AddrPort{}, false
+	}
+	for i := 0; i < len(b); i += 4 {
+		binary.NativeEndian.PutUint32(b[i:], binary.BigEndian.Uint32(b[i:]))
+	}
+	ip, _ := netip.AddrFromSlice(b)
+	return netip.AddrPortFrom(ip, uint16(p)), true
+}
+
+// socketOwners maps the inode of each socket open in a process that /proc
+// lets be seen to that process’s pid.
+func socketOwners() map[string]int {
+	owners := make(map[string]int)
+	fds, _ := filepath.Glob("/proc/[0-9]*/fd/*")
+	for _, fd := range fds {
+		link, err := os.Readlink(fd)
+		if !strings.HasPrefix(link, "socket:[") || err != nil {
+			continue
+		}
+		pid, _ := strconv.Atoi(strings.Split(fd, "/")[2])
+		owners[strings.TrimSuffix(strings.TrimPrefix(link, "socket:["), "]")] = pid
+	}
+	return owners
+}
@@ -0,0 +1,70 @@
+//go:build !linux && !windows
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"net/netip"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// connections returns the system’s connections as netstat -an lists them,
+// in the format of the BSDs and macOS, as in
+//
+//	tcp4       0      0  192.168.1.5.52000      17.57.144.1.443        ESTABLISHED
+//
+// which doesn’t say what process each belongs to.
+func connections() ([]conn, error) {
+	out, err := exec.Command("netstat", "-an").Output()
+	if err != nil {
+		return nil, err
+	}
+	var (
+		conns []conn
+		sc    = bufio.NewScanner(bytes.NewReader(out))
+	)
+	for sc.Scan() {
+		// proto recv-q send-q local foreign (state)
+		row := strings.Fields(sc.Text())
+		if len(row) < 5 || !strings.HasPrefix(row[0], "tcp") && !strings.HasPrefix(row[0], "udp") {
+			continue // a header, or a socket of another family.
+		}
+		var (
+			c        = conn{proto: strings.TrimRight(row[0], "46")}
+			ok1, ok2 bool
+		)
+		c.local, ok1 = netstatAddr(row[3])
+		c.remote, ok2 = netstatAddr(row[4])
+		if !ok1 || !ok2 {
+			continue
+		}
+		if c.proto == "tcp" && len(row) > 5 {
+			c.state = row[5]
+		}
+		conns = append(conns, c)
+	}
+	return conns, nil
+}
+
+// netstatAddr parses an address as BSD netstat gives it, with its port after
+// a dot, as “10.0.0.1.22” or “fe80::1%lo0.22”, or “*” for either part if it
+// has none.
+func netstatAddr(s string) (netip.AddrPort, bool) {
+	i := strings.LastIndexByte(s, '.')
+	if i < 0 {
+		return netip.AddrPort{}, false
+	}
+	addr, port := s[:i], s[i+1:]
+	if addr == "*" {
+		return netip.AddrPort{}, true // unconnected.
+	}
+	ip, err := netip.ParseAddr(addr)
+	p, _ := strconv.ParseUint(port, 10, 16) // 0 for “*”.
+	if err != nil {
+		return netip.AddrPort{}, false
+	}
+	return netip.AddrPortFrom(ip, uint16(p)), true
+}
@@ -0,0 +1,113 @@
+//go:build windows
+
+package main
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"path/filepath"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	iphlpapi                = windows.NewLazySystemDLL("iphlpapi.dll")
+	procGetExtendedTcpTable = iphlpapi.NewProc("GetExtendedTcpTable")
+)
+
+// tcpTableOwnerPIDAll asks GetExtendedTcpTable for every TCP socket, with
+// the pid of the process it belongs to.
+const tcpTableOwnerPIDAll = 5
+
+// mibTCPStates names the states of MIB_TCP_STATE, from 1.
+var mibTCPStates = []string{"", "CLOSED", "LISTEN", "SYN_SENT", "SYN_RCVD", "ESTABLISHED",
+	"FIN_WAIT1", "FIN_WAIT2", "CLOSE_WAIT", "CLOSING", "LAST_ACK", "TIME_WAIT", "DELETE_TCB"}
+
+// connections returns the system’s TCP connections, from the IP Helper
+// API’s tables of them, for IPv4 and IPv6, with the processes they belong
+// to, as far as they can be opened. Its tables of UDP sockets say nothing
+// of where they send, and so are left out.
+func connections() ([]conn, error) {
+	var (
+		conns []conn
+		names = make(map[uint32]string)
+	)
+	for _, af := range []uint32{windows.AF_INET, windows.AF_INET6} {
+		table, err := tcpTable(af)
+		if err != nil {
+			return nil, err
+		}
+		// MIB_TCPROW_OWNER_PID: state, local address and port, remote
+		// address and port, pid; or MIB_TCP6ROW_OWNER_PID: local address,
+		// scope and port, remote address, scope and port, state, pid. The
+		// rows follow their number; ports are in their first two bytes,
+		// in network order, as the addresses are.
+		n, size := binary.LittleEndian.Uint32(table), 24
+		if af == windows.AF_INET6 {
+			size = 56
+		}
+		for i := range min(int(n), (len(table)-4)/size) {
+			row := table[4+i*size : 4+(i+1)*size]
+			var c conn
+			var state, pid uint32
+			if af == windows.AF_INET {
+				state, pid = binary.LittleEndian.Uint32(row), binary.LittleEndian.Uint32(row[20:])
+				c.local = netip.AddrPortFrom(netip.AddrFrom4([4]byte(row[4:8])), binary.BigEndian.Uint16(row[8:]))
+				c.remote = netip.AddrPortFrom(netip.AddrFrom4([4]byte(row[12:16])), binary.BigEndian.Uint16(row[16:]))
+			} else {
+				state, pid = binary.LittleEndian.Uint32(row[48:]), binary.LittleEndian.Uint32(row[52:])
+				c.local = netip.AddrPortFrom(netip.AddrFrom16([16]byte(row[0:16])), binary.BigEndian.Uint16(row[20:]))
+				c.remote = netip.AddrPortFrom(netip.AddrFrom16([16]byte(row[24:40])), binary.BigEndian.Uint16(row[44:]))
+			}
+			c.proto, c.pid = "tcp", int(pid)
+			if int(state) < len(mibTCPStates) {
+				c.state = mibTCPStates[state]
+			}
+			if _, ok := names[pid]; !ok {
+				names[pid] = processName(pid)
+			}
+			c.process = names[pid]
+			conns = append(conns, c)
+		}
+	}
+	return conns, nil
+}
+
+// tcpTable returns GetExtendedTcpTable’s table of the TCP sockets of the
+// address family af.
+func tcpTable(af uint32) ([]byte, error) {
+	size := uint32(16 << 10)
+	for {
+		table := make([]byte, size)
+		r, _, _ := procGetExtendedTcpTable.Call(uintptr(unsafe.Pointer(&table[0])), uintptr(unsafe.Pointer(&size)),
+			0, uintptr(af), tcpTableOwnerPIDAll, 0)
+		switch windows.Errno(r) {
+		case 0:
+			return table, nil
+		case windows.ERROR_INSUFFICIENT_BUFFER:
+			continue // size is now what is needed.
+		default:
+			return nil, windows.Errno(r)
+		}
+	}
+}
+
+// processName returns the name of the executable of process pid, or "" if
+// it can’t be opened, as those of other users can’t be without privileges.
+func processName(pid uint32) string {
+	if pid == 0 {
+		return ""
+	}
+	h, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, pid)
+	if err != nil {
+		return ""
+	}
+	defer windows.CloseHandle(h)
+	buf := make([]uint16, windows.MAX_LONG_PATH)
+	size := uint32(len(buf))
+	if windows.QueryFullProcessImageName(h, 0, &buf[0], &size) != nil {
+		return ""
+	}
+	return filepath.Base(windows.UTF16ToString(buf[:size]))
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/netip"
+	"strconv"
+)
+
+const netUsage = `
+usage: %[1]v net [options]
+
+Lists the system’s TCP and UDP connections, as netstat does, and scans them
+as a file would be scanned — who is this machine talking to? — so that every
+option of a scan applies to their remote addresses, from -rdns and
+-check-feeds to -output json, in which each is found in the field "remote",
+in the context of its "proto", "local" address, remote "port", "state", and,
+where the system says, the "pid" and "process" it belongs to. Sockets that
+are listening, or otherwise unconnected, have no remote address to scan.
+
+	%[1]v net -unique -rdns -asn-lookup
+	%[1]v net -check-feeds -only-listed -output json
+
+Connections are read from /proc/net on Linux, from the IP Helper API on
+Windows, which has no remote addresses for UDP, and from netstat -an
+elsewhere, which doesn’t say what process each belongs to. Seeing which
+process those of other users belong to may take root or an administrator.
+`
+
+// netInput is the name of the input net makes of the connections it finds.
+const netInput = "connections"
+
+// netCommand implements “ipgrep net”.
+func netCommand(args []string) {
+	tableArgs("net", netUsage, args)
+	conns, err := connections()
+	if err != nil {
+		die(fmt.Errorf("listing connections: %w", err))
+	}
+	scanTable(netInput, connTable(conns), tableParser{"net", "remote"})
+}
+
+// conn is a connection of the system’s: its protocol, "tcp" or "udp", its
+// addresses, its state, if it has one, and the process it belongs to, if
+// known, with a pid of 0 if not.
+type conn struct {
+	proto         string
+	local, remote netip.AddrPort
+	state         string
+	pid           int
+	process       string
+}
+
+// connTable returns a table of the conns with remote addresses, with a line
+// for each after a header, as
+//
+//	proto local remote state pid process
+//	tcp 10.0.0.5:22 203.0.113.7:51234 ESTABLISHED 812 sshd
+//
+// with “-” for whatever isn’t known. Addresses lose their zones, and IPv4
+// ones mapped to IPv6 their mapping.
+func connTable(conns []conn) []byte {
+	var b bytes.Buffer
+	b.WriteString("proto local remote state pid process\n")
+	for _, c := range conns {
+		if !c.remote.IsValid() || c.remote.Addr().IsUnspecified() {
+			continue
+		}
+		pid := missing
+		if c.pid > 0 {
+			pid = strconv.Itoa(c.pid)
+		}
+		fmt.Fprintf(&b, "%v %v %v %v %v %v\n", c.proto, addrPortText(c.local), addrPortText(c.remote),
+			orMissing(c.state), pid, orMissing(c.process))
+	}
+	return b.Bytes()
+}
+
+// addrPortText returns ap as text, without its address’s zone or IPv4
+// mapping, or missing if it has no address.
+func addrPortText(ap netip.AddrPort) string {
+	if !ap.IsValid() {
+		return missing
+	}
+	return netip.AddrPortFrom(ap.Addr().WithZone("").Unmap(), ap.Port()).String()
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/mattn/go-colorable"
+	"github.com/mattn/go-isatty"
+	"github.com/princebot/ipgrep/ipgrep"
+)
+
+// stdout is where text results go, with their colors translated for the
+// Windows console. setColor decides whether they are colored at all.
+var (
+	stdout      = colorable.NewColorableStdout()
+	headerColor = color.New(color.FgCyan)
+	ipColor     = color.New(color.FgGreen, color.Bold)
+)
+
+// setColor checks -color and applies it to the colors of text results.
+func setColor(when string) {
+	switch when {
+	case "auto", "always", "never":
+	default:
+		die(fmt.Sprintf("invalid -color %q: want auto, always, or never", when))
+	}
+	color.NoColor = !useColor(os.Stdout)
+}
+
+// useColor reports whether output to f should be colored: always or never
+// if -color says so, and otherwise only if f is a terminal and $NO_COLOR
+// isn’t set (see https://no-color.org).
+func useColor(f *os.File) bool {
+	switch *colorMode {
+	case "always":
+		return true
+	case "never":
+		return false
+	}
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	return isatty.IsTerminal(f.Fd()) || isatty.IsCygwinTerminal(f.Fd())
+}
+
+// formatWith adapts f, a format of the ipgrep package’s, as -output chooses,
+// giving it each file’s matches and, in their notes, what is known of each.
+func formatWith(f ipgrep.Formatter) func(results []*scanResult, ann map[netip.Addr]*enrichment) {
+	return func(results []*scanResult, ann map[netip.Addr]*enrichment) {
+		out := make([]ipgrep.Result, len(results))
+		for i, r := range results {
+			out[i] = newResult(r, ann)
+		}
+		writeResults(f, out)
+	}
+}
+
+// writeResults writes results to stdout in f’s format, colored if text
+// output is.
+func writeResults(f ipgrep.Formatter, results []ipgrep.Result) {
+	w := bufio.NewWriter(stdout)
+	var cw io.Writer = w
+	if !color.NoColor {
+		cw = colorOutput{w}
+	}
+	if err := f.Format(cw, results); err != nil {
+		die(err)
+	}
+	if err := w.Flush(); err != nil {
+		die(err)
+	}
+}
+
+// printText prints results as -output text does.
+func printText(results []*scanResult, ann map[netip.Addr]*enrichment) {
+	formatWith(ipgrep.LookupFormatter("text"))(results, ann)
+}
+
+// newResult returns r as the ipgrep package’s formats take it. Each of its
+// matches has a note of the time found with it, with -with-timestamps, and
+// for -output json its class and what lookups found, or for text its
+// columns, if -classify or any lookups were requested.
+func newResult(r *scanResult, ann map[netip.Addr]*enrichment) ipgrep.Result {
+	res := ipgrep.Result{Source: r.File, Group: r.Group, Matches: r.Matches, Lines: shownLines(r)}
+	if res.Matches == nil {
+		res.Matches = make([]ipgrep.Match, len(r.IPs))
+		for i, ip := range r.IPs {
+			res.Matches[i] = ipMatch(ip)
+		}
+	}
+	res.Notes = make([]ipgrep.Note, len(r.IPs))
+	for i, ip := range r.IPs {
+		res.Notes[i] = newNote(ip, ann[ip], ann != nil)
+		if r.Times != nil {
+			res.Notes[i].Time = r.Times[i]
+		}
+	}
+	return res
+}
+
+// ipMatch returns a match of ip where nothing is known of where it was
+// found, for results that keep only their IPs.
+func ipMatch(ip netip.Addr) ipgrep.Match {
+	return ipgrep.Match{IP: ip, Artifact: ipgrep.Artifact{Kind: "ip", Text: ip.String(), Value: ip}}
+}
+
+// newNote returns the note the ipgrep package’s formats take on ip: its
+// class and e, what lookups found, for -output json, and for text their
+// columns, if -classify was given or enriched is true, as it is when any
+// lookups were requested.
+func newNote(ip netip.Addr, e *enrichment, enriched bool) ipgrep.Note {
+	n := ipgrep.Note{Fields: jsonNote{classify(ip), e}}
+	if *classifyIPs || enriched {
+		for _, c := range textColumns(ip, e)[1:] {
+			n.Columns = append(n.Columns, ipgrep.Column{Header: c.header, Value: c.value})
+		}
+	}
+	return n
+}
+
+// jsonNote holds the fields -output json gives each result besides where it
+// was found: its class and whatever lookups found.
+type jsonNote struct {
+	Class string `json:"class"`
+	*enrichment
+}
+
+// colorOutput is where the ipgrep package’s formats write when text results
+// are colored, coloring them as printHeader does.
+type colorOutput struct {
+	io.Writer
+}
+
+func (colorOutput) Color(part, s string) string {
+	switch part {
+	case "header":
+		return headerColor.Sprint(s)
+	case "ip":
+		return ipColor.Sprint(s)
+	case "source":
+		return fileColor.Sprint(s)
+	}
+	return s
+}
+
+// printHeader prints the commented header that text output gives r.
+func printHeader(r *scanResult) {
+	switch {
+	case r.Group != "":
+		fmt.Fprintln(stdout, headerColor.Sprintf("# %v:", r.Group))
+	case r.File != "":
+		fmt.Fprintln(stdout, headerColor.Sprintf("# results for %v:", r.File))
+	}
+}
+
+// textColumns returns the fields of text output for ip: the IP itself, its
+// class if -classify was given, and the fields of e if it isn’t nil.
+func textColumns(ip netip.Addr, e *enrichment) []column {
+	cols := []column{{"IP", ip.String()}}
+	if *classifyIPs {
+		cols = append(cols, column{"CLASS", classify(ip)})
+	}
+	if e != nil {
+		cols = append(cols, e.columns()...)
+	}
+	return cols
+}
+
+// timeColumn formats a time found with an IP, which is zero if there was none.
+func timeColumn(t time.Time) string {
+	if t.IsZero() {
+		return missing
+	}
+	return t.Format(time.RFC3339)
+}
+
+// textLine formats ip and what is known about it as a single tab-separated
+// line, for output that is streamed rather than tabulated.
+func textLine(ip netip.Addr, e *enrichment) string {
+	return joinColumns(textColumns(ip, e), func(c column) string { return c.value })
+}
+
+// joinColumns joins one part of each column, as chosen by part, with tabs.
+func joinColumns(cols []column, part func(column) string) string {
+	s := make([]string, len(cols))
+	for i, c := range cols {
+		s[i] = part(c)
+	}
+	return strings.Join(s, "\t")
+}
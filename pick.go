@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// candidate is one IP offered by -pick, with the text it is matched by.
+type candidate struct {
+	ip     string
+	text   string // the IP and what is known about it, as in text output.
+	order  int
+	score  int
+	marked bool
+}
+
+// picker is the state of -pick’s fuzzy selector.
+type picker struct {
+	all     []*candidate
+	matches []*candidate // those matching query, best first.
+	query   string
+	cursor  int
+	tty     *os.File
+}
+
+// pickIPs implements -pick: it offers ips in a fuzzy selector like fzf’s and
+// prints, and copies to the clipboard, those chosen. It exits with status 1
+// if none are.
+func pickIPs(ips []netip.Addr, ann map[netip.Addr]*enrichment) {
+	p := new(picker)
+	for i, ip := range ips {
+		text := strings.Replace(textLine(ip, ann[ip]), "\t", "  ", -1)
+		p.all = append(p.all, &candidate{ip: ip.String(), text: text, order: i})
+	}
+	p.match()
+	var chosen []string
+	useTerminal("-pick", func(tty *os.File) {
+		p.tty = tty
+		chosen = p.run()
+		if len(chosen) > 0 {
+			copyToClipboard(tty, strings.Join(chosen, "\n"))
+		}
+	})
+	if len(chosen) == 0 {
+		exit(exitNoMatch)
+	}
+	for _, ip := range chosen {
+		fmt.Println(ip)
+	}
+}
+
+// run reads keys until a choice is made, returning it, or the selector is
+// cancelled, returning nil.
+func (p *picker) run() []string {
+	buf := make([]byte, 16)
+	for {
+		p.draw()
+		n, err := p.tty.Read(buf)
+		if err != nil {
+			return nil
+		}
+		keys := []string{string(buf[:n])}
+		if buf[0] != '\x1b' {
+			keys = strings.Split(keys[0], "")
+		}
+		for _, k := range keys {
+			switch k {
+			case "\x1b", "\x03", "\x07": // Esc, Ctrl-C, Ctrl-G.
+				return nil
+			case "\r":
+				return p.chosen()
+			case "\x1b[A", "\x10", "\x0b": // up, Ctrl-P, Ctrl-K.
+				p.move(-1)
+			case "\x1b[B", "\x0e", "\x0a": // down, Ctrl-N, Ctrl-J.
+				p.move(1)
+			case "\t":
+				if p.cursor < len(p.matches) {
+					c := p.matches[p.cursor]
+					c.marked = !c.marked
+					p.move(1)
+				}
+			case "\x7f", "\b":
+				if p.query != "" {
+					r := []rune(p.query)
+					p.query = string(r[:len(r)-1])
+					p.match()
+				}
+			case "\x15": // Ctrl-U.
+				p.query = ""
+				p.match()
+			default:
+				if r := []rune(k); len(r) == 1 && unicode.IsPrint(r[0]) {
+					p.query += k
+					p.match()
+				}
+			}
+		}
+	}
+}
+
+// chosen returns the marked IPs, or the one under the cursor if none are.
+func (p *picker) chosen() []string {
+	var ips []string
+	for _, c := range p.all {
+		if c.marked {
+			ips = append(ips, c.ip)
+		}
+	}
+	if len(ips) == 0 && p.cursor < len(p.matches) {
+		ips = append(ips, p.matches[p.cursor].ip)
+	}
+	return ips
+}
+
+func (p *picker) move(by int) {
+	p.cursor += by
+	if p.cursor >= len(p.matches) {
+		p.cursor = len(p.matches) - 1
+	}
+	if p.cursor < 0 {
+		p.cursor = 0
+	}
+}
+
+// match finds the candidates matching the query and ranks them.
+func (p *picker) match() {
+	p.matches = p.matches[:0]
+	for _, c := range p.all {
+		if score, ok := fuzzyScore(c.text, p.query); ok {
+			c.score = score
+			p.matches = append(p.matches, c)
+		}
+	}
+	sort.SliceStable(p.matches, func(i, j int) bool {
+		a, b := p.matches[i], p.matches[j]
+		return a.score > b.score || a.score == b.score && a.order < b.order
+	})
+	p.cursor = 0
+}
+
+// fuzzyScore reports whether every character of query appears in text in
+// order, ignoring case, as fzf matches, and scores the match: higher when
+// the characters are consecutive or start the text or a word of it.
+func fuzzyScore(text, query string) (int, bool) {
+	var (
+		t     = []rune(strings.ToLower(text))
+		q     = []rune(strings.ToLower(query))
+		score int
+		last  = -2 // index of the last character matched.
+		j     int
+	)
+	for i := 0; i < len(t) && j < len(q); i++ {
+		if t[i] != q[j] {
+			continue
+		}
+		score++
+		if i == last+1 {
+			score += 2
+		}
+		if i == 0 || t[i-1] == ' ' || t[i-1] == '.' || t[i-1] == ':' {
+			score++
+		}
+		last = i
+		j++
+	}
+	return score, j == len(q)
+}
+
+// draw redraws the selector: the query, a count, and the best matches.
+func (p *picker) draw() {
+	var (
+		b    strings.Builder
+		w, h = termSize(p.tty)
+	)
+	row := func(s, attr string) {
+		if r := []rune(s); len(r) > w {
+			s = string(r[:w])
+		}
+		if attr != "" {
+			s = attr + s + "\x1b[0m"
+		}
+		b.WriteString(s + "\r\n")
+	}
+	b.WriteString("\x1b[H\x1b[2J")
+	row("> "+p.query+"▏", "")
+	marked := 0
+	for _, c := range p.all {
+		if c.marked {
+			marked++
+		}
+	}
+	status := fmt.Sprintf("  %d/%d", len(p.matches), len(p.all))
+	if marked > 0 {
+		status += fmt.Sprintf(" (%d marked)", marked)
+	}
+	row(status+"  — Tab marks, Enter chooses, Esc cancels", "\x1b[2m")
+	// Keep the cursor in view.
+	rows := h - 2
+	top := 0
+	if p.cursor >= rows {
+		top = p.cursor - rows + 1
+	}
+	for i := top; i < len(p.matches) && i < top+rows; i++ {
+		c := p.matches[i]
+		mark := "  "
+		if c.marked {
+			mark = "* "
+		}
+		attr := ""
+		if i == p.cursor {
+			attr = "\x1b[7m"
+		}
+		row(mark+c.text, attr)
+	}
+	fmt.Fprint(p.tty, strings.TrimSuffix(b.String(), "\r\n"))
+}
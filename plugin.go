@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/princebot/ipgrep/ipgrep"
+)
+
+// commandList is a flag.Value collecting every command given to an option
+// that may be repeated, like -enrich-plugin.
+type commandList []string
+
+func (c *commandList) String() string { return strings.Join(*c, "; ") }
+
+func (c *commandList) Set(command string) error {
+	*c = append(*c, command)
+	return nil
+}
+
+var (
+	enrichPlugins, sinks commandList // set by -enrich-plugin and -sink.
+
+	// plugins are the -enrich-plugin programs running.
+	plugins []*enrichPlugin
+)
+
+// enrichPlugin is an external program, started with -enrich-plugin, that
+// annotates IPs. It speaks JSON, a line at a time, over its stdin and
+// stdout. It starts by describing itself:
+//
+//	{"name": "owners", "fields": ["owner", "team"]}
+//
+// and then answers each request for an IP,
+//
+//	{"id": 1, "ip": "10.1.2.3", "class": "private"}
+//
+// with the same id and the values it has for its fields, or an error:
+//
+//	{"id": 1, "fields": {"owner": "alice", "team": "payments"}}
+//	{"id": 2, "error": "not in the inventory"}
+//
+// Requests may be sent before earlier ones are answered, and answers may
+// come in any order.
+type enrichPlugin struct {
+	Name   string   `json:"name"`
+	Fields []string `json:"fields"`
+
+	command string
+	in      io.WriteCloser
+
+	mu      sync.Mutex // guards the rest.
+	nextID  int
+	waiting map[int]chan pluginReply
+	err     error // set once the plugin has quit.
+}
+
+type pluginRequest struct {
+	ID    int    `json:"id"`
+	IP    string `json:"ip"`
+	Class string `json:"class"`
+}
+
+type pluginReply struct {
+	ID     int               `json:"id"`
+	Fields map[string]string `json:"fields"`
+	Error  string            `json:"error"`
+}
+
+// startEnrichPlugin runs command with the shell and reads its description
+// of itself, giving up after timeout.
+func startEnrichPlugin(command string, timeout time.Duration) (*enrichPlugin, error) {
+	cmd := shellCommand(command)
+	cmd.Stderr = os.Stderr
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("-enrich-plugin %q: %w", command, err)
+	}
+	p := &enrichPlugin{command: command, in: in, waiting: make(map[int]chan pluginReply)}
+	lines := bufio.NewScanner(out)
+	lines.Buffer(nil, 1<<20)
+	hello := make(chan error, 1)
+	go func() {
+		if !lines.Scan() {
+			hello <- errors.New("quit without describing itself")
+			return
+		}
+		if err := json.Unmarshal(lines.Bytes(), p); err != nil || p.Name == "" {
+			hello <- fmt.Errorf("bad description %q: want {\"name\": ..., \"fields\": [...]}", lines.Text())
+			return
+		}
+		hello <- nil
+		p.read(lines)
+	}()
+	select {
+	case err := <-hello:
+		if err != nil {
+			cmd.Process.Kill()
+			return nil, fmt.Errorf("-enrich-plugin %q: %w", command, err)
+		}
+	case <-time.After(timeout):
+		cmd.Process.Kill()
+		return nil, fmt.Errorf("-enrich-plugin %q: no description within %v", command, timeout)
+	}
+	return p, nil
+}
+
+// read hands each reply to the request waiting for it, until the plugin
+// quits, whereupon every request still waiting fails.
+func (p *enrichPlugin) read(lines *bufio.Scanner) {
+	for lines.Scan() {
+		var r pluginReply
+		if err := json.Unmarshal(lines.Bytes(), &r); err != nil {
+			logger.Debug("bad plugin reply", "plugin", p.Name, "reply", lines.Text())
+			continue
+		}
+		p.mu.Lock()
+		if c, ok := p.waiting[r.ID]; ok {
+			c <- r
+			delete(p.waiting, r.ID)
+		}
+		p.mu.Unlock()
+	}
+	p.mu.Lock()
+	p.err = fmt.Errorf("-enrich-plugin %v quit", p.Name)
+	for id, c := range p.waiting {
+		c <- pluginReply{ID: id, Error: p.err.Error()}
+		delete(p.waiting, id)
+	}
+	p.mu.Unlock()
+}
+
+// lookup asks the plugin about ip, returning its fields, or nil if it has
+// none or doesn’t answer within timeout.
+func (p *enrichPlugin) lookup(ip netip.Addr, timeout time.Duration) map[string]string {
+	p.mu.Lock()
+	if p.err != nil {
+		p.mu.Unlock()
+		return nil
+	}
+	p.nextID++
+	id, c := p.nextID, make(chan pluginReply, 1)
+	p.waiting[id] = c
+	b, _ := json.Marshal(pluginRequest{ID: id, IP: ip.String(), Class: classify(ip)})
+	_, err := p.in.Write(append(b, '\n'))
+	p.mu.Unlock()
+	if err != nil {
+		return nil
+	}
+	select {
+	case r := <-c:
+		if r.Error != "" {
+			logger.Debug("plugin lookup failed", "plugin", p.Name, "ip", ip, "error", r.Error)
+			return nil
+		}
+		return r.Fields
+	case <-time.After(timeout):
+		p.mu.Lock()
+		delete(p.waiting, id)
+		p.mu.Unlock()
+		return nil
+	}
+}
+
+// columns returns the text-mode fields for the values the plugin gave.
+func (p *enrichPlugin) columns(values map[string]string) []column {
+	cols := make([]column, len(p.Fields))
+	for i, f := range p.Fields {
+		cols[i] = column{strings.ToUpper(f), orMissing(values[f])}
+	}
+	return cols
+}
+
+// runSinks sends results to each -sink command: it runs the command with the
+// shell and writes each match to its stdin, closing it at the end, as a line
+// of JSON in the shape -output json gives it, with its file and what is known
+// about it. The command’s own output goes to ipgrep’s, and its failure is
+// reported as an error.
+func runSinks(results []*scanResult, ann map[netip.Addr]*enrichment) {
+	for _, command := range sinks {
+		cmd := shellCommand(command)
+		cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+		in, err := cmd.StdinPipe()
+		if err == nil {
+			err = cmd.Start()
+		}
+		if err != nil {
+			printError(fmt.Errorf("-sink %q: %w", command, err))
+			continue
+		}
+		w := bufio.NewWriter(in)
+		for _, r := range results {
+			res := newResult(r, ann)
+			for i, m := range res.Matches {
+				m.Source = r.File
+				b, err := ipgrep.MarshalMatch(m, res.Notes[i])
+				if err != nil {
+					die(err)
+				}
+				if _, err := w.Write(append(b, '\n')); err != nil {
+					break // the command quit early; Wait says why.
+				}
+			}
+		}
+		w.Flush()
+		in.Close()
+		if err := cmd.Wait(); err != nil {
+			printError(fmt.Errorf("-sink %q: %w", command, err))
+		}
+	}
+}
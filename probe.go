@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// parseProbe turns a -probe value into a function reporting whether an IP is
+// reachable. "icmp" sends an echo request; "tcp:PORT" attempts a connection.
+func parseProbe(spec string) (func(ip netip.Addr, timeout time.Duration) bool, error) {
+	if spec == "icmp" {
+		return probeICMP, nil
+	}
+	if port := strings.TrimPrefix(spec, "tcp:"); port != spec {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return nil, fmt.Errorf("-probe: invalid port %q", port)
+		}
+		return func(ip netip.Addr, timeout time.Duration) bool {
+			return probeTCP(ip, port, timeout)
+		}, nil
+	}
+	return nil, fmt.Errorf("-probe: want icmp or tcp:PORT, not %q", spec)
+}
+
+// probeTCP reports whether ip accepts a TCP connection on port within timeout.
+func probeTCP(ip netip.Addr, port string, timeout time.Duration) bool {
+	c, err := net.DialTimeout("tcp", net.JoinHostPort(ip.String(), port), timeout)
+	if err != nil {
+		return false
+	}
+	c.Close()
+	return true
+}
+
+// icmpSeq numbers echo requests so that replies can be matched to them when
+// using a raw socket, which sees every ICMP packet the host receives.
+var icmpSeq atomic.Uint32
+
+// probeICMP reports whether ip answers an ICMP echo request within timeout.
+// It first tries an unprivileged datagram socket, which Linux permits for
+// groups listed in net.ipv4.ping_group_range and macOS permits for everyone,
+// and falls back to a raw socket, which requires root or CAP_NET_RAW.
+func probeICMP(ip netip.Addr, timeout time.Duration) bool {
+	var (
+		udpNet, rawNet, laddr = "udp4", "ip4:icmp", "0.0.0.0"
+		proto                 = 1 // ICMP
+		echo, reply           icmp.Type
+	)
+	echo, reply = ipv4.ICMPTypeEcho, ipv4.ICMPTypeEchoReply
+	if ip.Is6() {
+		udpNet, rawNet, laddr = "udp6", "ip6:ipv6-icmp", "::"
+		proto = 58 // ICMPv6
+		echo, reply = ipv6.ICMPTypeEchoRequest, ipv6.ICMPTypeEchoReply
+	}
+	var dst net.Addr = &net.UDPAddr{IP: ip.AsSlice()}
+	c, err := icmp.ListenPacket(udpNet, laddr)
+	if err != nil {
+		if c, err = icmp.ListenPacket(rawNet, laddr); err != nil {
+			return false
+		}
+		dst = &net.IPAddr{IP: ip.AsSlice()}
+	}
+	defer c.Close()
+
+	var (
+		id  = os.Getpid() & 0xffff
+		seq = int(icmpSeq.Add(1) & 0xffff)
+	)
+	msg := icmp.Message{Type: echo, Body: &icmp.Echo{ID: id, Seq: seq, Data: []byte(prog)}}
+	b, err := msg.Marshal(nil)
+	if err != nil {
+		return false
+	}
+	c.SetDeadline(time.Now().Add(timeout))
+	if _, err := c.WriteTo(b, dst); err != nil {
+		return false
+	}
+	buf := make([]byte, 1500)
+	for {
+		n, peer, err := c.ReadFrom(buf)
+		if err != nil {
+			return false
+		}
+		m, err := icmp.ParseMessage(proto, buf[:n])
+		if err != nil || m.Type != reply {
+			continue
+		}
+		// The kernel rewrites the ID of datagram-socket echoes and only
+		// delivers their own replies, so only the sequence is checked.
+		if e, ok := m.Body.(*icmp.Echo); ok && e.Seq == seq && sameHost(peer, ip) {
+			return true
+		}
+	}
+}
+
+// sameHost reports whether addr, as returned by ReadFrom, refers to ip.
+func sameHost(addr net.Addr, ip netip.Addr) bool {
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		return sameIP(a.IP, ip)
+	case *net.IPAddr:
+		return sameIP(a.IP, ip)
+	}
+	return false
+}
+
+// sameIP reports whether a, as the net package returns addresses, is ip.
+func sameIP(a net.IP, ip netip.Addr) bool {
+	b, ok := netip.AddrFromSlice(a)
+	return ok && b.Unmap() == ip
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	_ "net/http/pprof" // serves profiles for -pprof.
+	"os"
+	"os/signal"
+	"runtime"
+	"runtime/pprof"
+	"sync"
+	"syscall"
+)
+
+// stopProfiling writes the profiles requested by -cpuprofile and
+// -memprofile, once they have been started, and does nothing after the
+// first call.
+var stopProfiling = func() {}
+
+// startProfiling starts the profiling requested by -cpuprofile, -memprofile,
+// and -pprof, so that slow or hungry runs over real inputs can be looked
+// into with “go tool pprof” without a build of their own.
+func startProfiling() {
+	if *pprofAddr != "" {
+		// Listen first, so that a bad address is reported rather than lost.
+		ln, err := net.Listen("tcp", *pprofAddr)
+		if err != nil {
+			die(err)
+		}
+		logger.Info("serving profiles", "url", "http://"+ln.Addr().String()+"/debug/pprof/")
+		go http.Serve(ln, nil)
+	}
+	var cpu *os.File
+	if *cpuProfile != "" {
+		var err error
+		if cpu, err = os.Create(*cpuProfile); err != nil {
+			die(err)
+		}
+		if err := pprof.StartCPUProfile(cpu); err != nil {
+			die(err)
+		}
+	}
+	if cpu == nil && *memProfile == "" {
+		return
+	}
+	stopProfiling = sync.OnceFunc(func() {
+		if cpu != nil {
+			pprof.StopCPUProfile()
+			if err := cpu.Close(); err != nil {
+				printError(err)
+			}
+		}
+		if *memProfile != "" {
+			writeHeapProfile(*memProfile)
+		}
+	})
+}
+
+// writeHeapProfile writes a profile of the memory in use, and of what was
+// allocated along the way, to the named file.
+func writeHeapProfile(name string) {
+	f, err := os.Create(name)
+	if err != nil {
+		printError(err)
+		return
+	}
+	runtime.GC() // bring the figures for memory in use up to date.
+	if err := pprof.WriteHeapProfile(f); err != nil {
+		printError(err)
+	}
+	if err := f.Close(); err != nil {
+		printError(err)
+	}
+}
+
+// stopProfilingOnSignal writes the profiles requested, and exits, on SIGINT
+// or SIGTERM, for modes such as -follow that run until stopped; with neither
+// -cpuprofile nor -memprofile, signals are left to kill the process.
+func stopProfilingOnSignal() {
+	if *cpuProfile == "" && *memProfile == "" {
+		return
+	}
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		exit(exitInterrupted)
+	}()
+}
+
+// exit writes any profiles requested, then exits with the given status. The
+// scan command uses it in place of os.Exit.
+func exit(code int) {
+	stopProfiling()
+	os.Exit(code)
+}
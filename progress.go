@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mattn/go-colorable"
+	"github.com/mattn/go-isatty"
+)
+
+// meter reports -progress while files are scanned. It is nil unless
+// -progress was given, in which case its methods do nothing.
+var meter *progress
+
+// progress tracks how far a scan has got: bytes scanned, files finished, and
+// matches found, out of the total given when it was created.
+type progress struct {
+	files, bytes        int64 // totals.
+	done, read, matches int64 // so far, updated atomically.
+
+	tty  bool // whether stderr is a terminal, so the status can be redrawn.
+	mu   sync.Mutex
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// startProgress begins reporting progress through the named files on stderr,
+// redrawing a status line every interval on a terminal and printing one
+// otherwise.
+func startProgress(names []string, interval time.Duration) *progress {
+	p := &progress{
+		files: int64(len(names)),
+		tty:   isatty.IsTerminal(os.Stderr.Fd()) || isatty.IsCygwinTerminal(os.Stderr.Fd()),
+		stop:  make(chan struct{}),
+	}
+	for _, name := range names {
+		if fi, err := os.Stat(name); err == nil {
+			p.bytes += fi.Size()
+		}
+	}
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				p.print("")
+			case <-p.stop:
+				return
+			}
+		}
+	}()
+	return p
+}
+
+// add records that n more bytes have been scanned.
+func (p *progress) add(n int) {
+	if p == nil {
+		return
+	}
+	atomic.AddInt64(&p.read, int64(n))
+}
+
+// finish records that r has been scanned.
+func (p *progress) finish(r *scanResult) {
+	if p == nil {
+		return
+	}
+	atomic.AddInt64(&p.done, 1)
+	atomic.AddInt64(&p.matches, int64(r.found()))
+	msg := fmt.Sprintf("%v: %d matches", r.File, r.found())
+	if r.Err != nil {
+		msg = fmt.Sprintf("%v: %v", r.File, r.Err)
+	}
+	p.print(msg)
+}
+
+// close stops reporting progress, leaving the final status on stderr.
+func (p *progress) close() {
+	if p == nil {
+		return
+	}
+	close(p.stop)
+	p.wg.Wait()
+	p.print("")
+	if p.tty {
+		fmt.Fprintln(colorable.NewColorableStderr())
+	}
+}
+
+// print prints msg, if it isn’t empty, then the status line.
+func (p *progress) print(msg string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stderr := colorable.NewColorableStderr()
+	var (
+		done  = atomic.LoadInt64(&p.done)
+		read  = atomic.LoadInt64(&p.read)
+		found = atomic.LoadInt64(&p.matches)
+		pct   = 100.0
+	)
+	if p.bytes > 0 {
+		pct = 100 * float64(read) / float64(p.bytes)
+	}
+	status := fmt.Sprintf("%v: %d of %d files (%d remaining), %v of %v (%.0f%%), %d matches",
+		prog, done, p.files, p.files-done, byteSize(read), byteSize(p.bytes), pct, found)
+	if !p.tty {
+		if msg != "" {
+			fmt.Fprintf(stderr, "%v: %v\n", prog, msg)
+			return
+		}
+		fmt.Fprintln(stderr, status)
+		return
+	}
+	// Clear the old status line before overwriting it.
+	if msg != "" {
+		fmt.Fprintf(stderr, "\r\x1b[K%v: %v\n", prog, msg)
+	}
+	fmt.Fprintf(stderr, "\r\x1b[K%v", status)
+}
+
+// byteSize formats n bytes for people, e.g. 1.5 GB.
+func byteSize(n int64) string {
+	const unit = 1000
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "kMGTPE"[exp])
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IANA publishes which RIR’s RDAP server is authoritative for each block of
+// address space. See RFC 9224.
+const (
+	rdapBootstrap4 = "https://data.iana.org/rdap/ipv4.json"
+	rdapBootstrap6 = "https://data.iana.org/rdap/ipv6.json"
+)
+
+// rdapInfo is the subset of an RDAP IP network response ipgrep reports.
+type rdapInfo struct {
+	Handle     string `json:"handle,omitempty"`
+	Name       string `json:"name,omitempty"`
+	Org        string `json:"org,omitempty"`
+	AbuseEmail string `json:"abuse_email,omitempty"`
+	Country    string `json:"country,omitempty"`
+}
+
+// rdapServices maps the CIDR blocks in a bootstrap file to the base URLs of
+// the servers responsible for them.
+type rdapServices struct {
+	nets []netip.Prefix
+	urls []string
+}
+
+var (
+	rdapOnce sync.Once
+	rdap4    rdapServices
+	rdap6    rdapServices
+)
+
+// lookupRDAP fetches registration data for ip from the RDAP server the IANA
+// bootstrap registry names as authoritative for it. A nil result means no
+// server claims the IP or the query failed.
+func lookupRDAP(ip netip.Addr, timeout time.Duration) *rdapInfo {
+	rdapOnce.Do(func() {
+		rdap4 = fetchRDAPBootstrap(rdapBootstrap4, timeout)
+		rdap6 = fetchRDAPBootstrap(rdapBootstrap6, timeout)
+	})
+	svc := rdap4
+	if ip.Is6() {
+		svc = rdap6
+	}
+	base := svc.lookup(ip)
+	if base == "" {
+		return nil
+	}
+	b, err := cached("rdap", ip.String(), func() ([]byte, error) {
+		u := strings.TrimSuffix(base, "/") + "/ip/" + ip.String()
+		return apiGet(u, http.Header{"Accept": {"application/rdap+json"}}, timeout)
+	})
+	if err != nil || len(b) == 0 {
+		return nil
+	}
+	var n rdapNetwork
+	if err := json.Unmarshal(b, &n); err != nil {
+		return nil
+	}
+	info := &rdapInfo{Handle: n.Handle, Name: n.Name, Country: n.Country}
+	for _, e := range n.Entities {
+		e.walk(func(e *rdapEntity) {
+			if e.hasRole("registrant") && info.Org == "" {
+				info.Org = e.vcard("fn")
+			}
+			if e.hasRole("abuse") && info.AbuseEmail == "" {
+				info.AbuseEmail = e.vcard("email")
+			}
+		})
+	}
+	return info
+}
+
+// fetchRDAPBootstrap downloads and parses an IANA bootstrap file. Failure
+// yields an empty set of services, which makes every lookup a miss.
+func fetchRDAPBootstrap(url string, timeout time.Duration) rdapServices {
+	var svc rdapServices
+	b, err := cached("rdap-bootstrap", url, func() ([]byte, error) {
+		return apiGet(url, nil, timeout)
+	})
+	if err != nil {
+		return svc
+	}
+	var reg struct {
+		Services [][][]string `json:"services"`
+	}
+	if err := json.Unmarshal(b, &reg); err != nil {
+		return svc
+	}
+	for _, s := range reg.Services {
+		if len(s) < 2 || len(s[1]) == 0 {
+			continue
+		}
+		// Prefer an HTTPS endpoint when a registry offers several.
+		url := s[1][0]
+		for _, u := range s[1] {
+			if strings.HasPrefix(u, "https://") {
+				url = u
+				break
+			}
+		}
+		for _, cidr := range s[0] {
+			if n, err := netip.ParsePrefix(cidr); err == nil {
+				svc.nets = append(svc.nets, n.Masked())
+				svc.urls = append(svc.urls, url)
+			}
+		}
+	}
+	return svc
+}
+
+// lookup returns the base URL of the most specific block containing ip.
+func (s rdapServices) lookup(ip netip.Addr) string {
+	var (
+		url  string
+		best = -1
+	)
+	for i, n := range s.nets {
+		if n.Contains(ip) && n.Bits() > best {
+			url, best = s.urls[i], n.Bits()
+		}
+	}
+	return url
+}
+
+// rdapNetwork and rdapEntity mirror the parts of RFC 9083’s IP network and
+// entity objects that ipgrep reads.
+type rdapNetwork struct {
+	Handle   string        `json:"handle"`
+	Name     string        `json:"name"`
+	Country  string        `json:"country"`
+	Entities []*rdapEntity `json:"entities"`
+}
+
+type rdapEntity struct {
+	Roles      []string        `json:"roles"`
+	VCardArray json.RawMessage `json:"vcardArray"`
+	Entities   []*rdapEntity   `json:"entities"`
+}
+
+// walk calls fn for e and every entity nested beneath it.
+func (e *rdapEntity) walk(fn func(*rdapEntity)) {
+	fn(e)
+	for _, c := range e.Entities {
+		c.walk(fn)
+	}
+}
+
+func (e *rdapEntity) hasRole(role string) bool {
+	for _, r := range e.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// vcard returns the first text value of the named jCard property (RFC 7095).
+// A jCard looks like ["vcard", [["fn", {}, "text", "Example Org"], ...]].
+func (e *rdapEntity) vcard(prop string) string {
+	var card []json.RawMessage
+	if json.Unmarshal(e.VCardArray, &card) != nil || len(card) < 2 {
+		return ""
+	}
+	var props [][]json.RawMessage
+	if json.Unmarshal(card[1], &props) != nil {
+		return ""
+	}
+	for _, p := range props {
+		var name, value string
+		if len(p) < 4 || json.Unmarshal(p[0], &name) != nil || name != prop {
+			continue
+		}
+		if json.Unmarshal(p[3], &value) == nil {
+			return value
+		}
+	}
+	return ""
+}
+
+// columns returns the text-mode fields for r, or placeholders if r is nil.
+func (r *rdapInfo) columns() []column {
+	if r == nil {
+		r = new(rdapInfo)
+	}
+	return []column{
+		{"HANDLE", orMissing(r.Handle)},
+		{"REGISTRANT", orMissing(r.Org)},
+		{"ABUSE CONTACT", orMissing(r.AbuseEmail)},
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+// lookupPTR returns the first hostname for ip, without the trailing dot, or ""
+// if the lookup fails.
+func lookupPTR(ip netip.Addr, timeout time.Duration) string {
+	b, _ := cached("ptr", ip.String(), func() ([]byte, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		names, err := net.DefaultResolver.LookupAddr(ctx, ip.String())
+		if err != nil {
+			return nil, dnsError(err)
+		}
+		if len(names) == 0 {
+			return nil, errNotFound
+		}
+		return []byte(strings.TrimSuffix(names[0], ".")), nil
+	})
+	return string(b)
+}
+
+// confirmPTR reports whether host resolves forward to ip, i.e. whether the
+// PTR record is forward-confirmed. A PTR record that fails this check may
+// have been set by whoever controls the reverse zone to impersonate host.
+func confirmPTR(ip netip.Addr, host string, timeout time.Duration) bool {
+	b, _ := cached("fcrdns", ip.String()+" "+host, func() ([]byte, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, dnsError(err)
+		}
+		for _, a := range addrs {
+			if sameIP(a.IP, ip) {
+				return []byte{1}, nil
+			}
+		}
+		return nil, errNotFound
+	})
+	return len(b) > 0
+}
+
+// dnsError returns errNotFound if err means the queried name has no records,
+// which is worth caching, or else err itself, which is not.
+func dnsError(err error) error {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return errNotFound
+	}
+	return err
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// redactPlaceholder replaces every IP under -redact placeholder.
+const redactPlaceholder = "[redacted]"
+
+// redactors maps each -redact mode to a function returning the replacement
+// for an IP, given the -salt for hashing.
+var redactors = map[string]func(salt []byte) func(netip.Addr) string{
+	"placeholder": func([]byte) func(netip.Addr) string {
+		return func(netip.Addr) string { return redactPlaceholder }
+	},
+	"mask": func([]byte) func(netip.Addr) string { return maskIP },
+	"hash": func(salt []byte) func(netip.Addr) string {
+		return func(ip netip.Addr) string { return hashIP(ip, salt) }
+	},
+}
+
+// newRedactor returns the replacement function for -redact mode, hashing
+// with salt if given or else with a random salt that lasts only this run.
+func newRedactor(mode, salt string) (func(netip.Addr) string, error) {
+	mk, ok := redactors[mode]
+	if !ok {
+		return nil, fmt.Errorf("unknown -redact mode %q: want placeholder, mask, or hash", mode)
+	}
+	key := []byte(salt)
+	if salt == "" {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+	}
+	return mk(key), nil
+}
+
+// maskIP keeps the network half of ip’s leading bits visible: the first two
+// octets of an IPv4 address, as in 10.0.x.x, or the first two groups of an
+// IPv6 address, as in 2001:db8:x:x:x:x:x:x.
+func maskIP(ip netip.Addr) string {
+	if ip.Is4() {
+		v4 := ip.As4()
+		return fmt.Sprintf("%d.%d.x.x", v4[0], v4[1])
+	}
+	v6 := ip.As16()
+	return fmt.Sprintf("%x:%x:", int(v6[0])<<8|int(v6[1]), int(v6[2])<<8|int(v6[3])) +
+		strings.Repeat("x:", 5) + "x"
+}
+
+// hashIP returns a pseudonym for ip derived from its salted HMAC-SHA256, the
+// same for every occurrence of ip hashed with the same salt.
+func hashIP(ip netip.Addr, salt []byte) string {
+	mac := hmac.New(sha256.New, salt)
+	v6 := ip.As16() // as net.IP’s To16, so pseudonyms don’t change.
+	mac.Write(v6[:])
+	return "ip-" + hex.EncodeToString(mac.Sum(nil)[:6])
+}
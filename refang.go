@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+)
+
+const refangUsage = `
+usage: %[1]v refang file ...
+
+Prints each file with defanged indicators restored to their real forms, so
+IPs and URLs in a shared threat report can be used (or scanned by %[1]v):
+
+	1[.]2[.]3[.]4, 1(.)2(.)3(.)4, 1[dot]2[dot]3[dot]4    become 1.2.3.4
+	2001[:]db8[:][:]1                                  becomes 2001:db8::1
+	hxxp://, hxxps://, http[:]//, http[://]            become http:// etc.
+	user[@]example[.]com, user[at]example[.]com        become user@example.com
+`
+
+// refangRules are the defanging conventions “ipgrep refang” undoes, in the
+// order they are applied.
+var refangRules = []struct {
+	re   *regexp.Regexp
+	repl string
+}{
+	{regexp.MustCompile(`(?i)\bh(?:xx|XX|\*\*)p(s?)\b`), "http$1"},
+	{regexp.MustCompile(`(?i)\bfxp\b`), "ftp"},
+	{regexp.MustCompile(`\[://\]|\[:\]//`), "://"},
+	{regexp.MustCompile(`\s?[\[({](?:\.|dot|DOT)[\])}]\s?`), "."},
+	{regexp.MustCompile(`\\\.`), "."},
+	{regexp.MustCompile(`[\[({]:[\])}]`), ":"},
+	{regexp.MustCompile(`\s?[\[({](?:@|at|AT)[\])}]\s?`), "@"},
+}
+
+// refangFlags holds the options of “ipgrep refang”, of which there are none.
+var refangFlags = flag.NewFlagSet("refang", flag.ExitOnError)
+
+func init() {
+	refangFlags.Usage = func() { fmt.Fprintf(os.Stderr, refangUsage, prog) }
+}
+
+// refangCommand implements “ipgrep refang”.
+func refangCommand(args []string) {
+	fs := refangFlags
+	parseArgs(fs, args)
+	if fs.NArg() < 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+	for _, name := range fs.Args() {
+		b, err := ioutil.ReadFile(name)
+		if err != nil {
+			die(err)
+		}
+		w.Write(refang(b))
+	}
+}
+
+// refang returns b with every refangRules pattern replaced.
+func refang(b []byte) []byte {
+	for _, r := range refangRules {
+		b = r.re.ReplaceAll(b, []byte(r.repl))
+	}
+	return b
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// reports maps each -report value to the function that prints it.
+var reports = map[string]func(results []*scanResult){
+	"matrix": printMatrix,
+	"by-ip":  printByIP,
+}
+
+// presence records how many times one IP appears in each input file.
+type presence struct {
+	IP     string         `json:"ip"`
+	Counts map[string]int `json:"files"` // occurrences by file name.
+	Total  int            `json:"total"`
+}
+
+// presenceMatrix returns, for each unique IP in results in order of first
+// appearance, how often it occurs in each file.
+func presenceMatrix(results []*scanResult) []*presence {
+	var (
+		rows []*presence
+		byIP = make(map[netip.Addr]*presence)
+	)
+	for _, r := range results {
+		for _, ip := range r.IPs {
+			p := byIP[ip]
+			if p == nil {
+				p = &presence{IP: ip.String(), Counts: make(map[string]int)}
+				byIP[ip] = p
+				rows = append(rows, p)
+			}
+			p.Counts[r.File]++
+			p.Total++
+		}
+	}
+	return rows
+}
+
+// printMatrix implements -report matrix: a table with a row per unique IP
+// and a column per input file, showing how often each IP occurs in each file.
+func printMatrix(results []*scanResult) {
+	rows := presenceMatrix(results)
+	if *output == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(rows); err != nil {
+			die(err)
+		}
+		return
+	}
+	fmt.Println("# occurrences by file:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprint(w, "IP\t")
+	for _, r := range results {
+		fmt.Fprintf(w, "%v\t", r.File)
+	}
+	fmt.Fprintln(w, "TOTAL")
+	for _, p := range rows {
+		fmt.Fprintf(w, "%v\t", p.IP)
+		for _, r := range results {
+			n := missing
+			if c := p.Counts[r.File]; c > 0 {
+				n = strconv.Itoa(c)
+			}
+			fmt.Fprintf(w, "%v\t", n)
+		}
+		fmt.Fprintf(w, "%d\n", p.Total)
+	}
+	w.Flush()
+	fmt.Println()
+}
+
+// sighting records where one IP appears in a single input file.
+type sighting struct {
+	File  string `json:"file"`
+	Lines []int  `json:"lines"` // line numbers, in order, each listed once.
+}
+
+// sightings is one entry of -report by-ip: an IP and where it appears.
+type sightings struct {
+	IP    string      `json:"ip"`
+	Files []*sighting `json:"files"`
+	ip    netip.Addr
+}
+
+// indexByIP returns, for each unique IP in results in order of first
+// appearance, the files and lines it appears on, in input order.
+func indexByIP(results []*scanResult) []*sightings {
+	var (
+		rows []*sightings
+		byIP = make(map[netip.Addr]*sightings)
+	)
+	for _, r := range results {
+		for i, ip := range r.IPs {
+			row := byIP[ip]
+			if row == nil {
+				row = &sightings{IP: ip.String(), ip: ip}
+				byIP[ip] = row
+				rows = append(rows, row)
+			}
+			var s *sighting
+			if n := len(row.Files); n > 0 && row.Files[n-1].File == r.File {
+				s = row.Files[n-1]
+			} else {
+				s = &sighting{File: r.File, Lines: []int{}}
+				row.Files = append(row.Files, s)
+			}
+			// An IP may appear more than once on a line.
+			if n := len(s.Lines); r.Matches != nil && (n == 0 || s.Lines[n-1] != r.Matches[i].Line) {
+				s.Lines = append(s.Lines, r.Matches[i].Line)
+			}
+		}
+	}
+	return rows
+}
+
+// printByIP implements -report by-ip: each unique IP followed by an indented
+// list of the files and line numbers where it occurs.
+func printByIP(results []*scanResult) {
+	rows := indexByIP(results)
+	if *output == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(rows); err != nil {
+			die(err)
+		}
+		return
+	}
+	fmt.Println("# occurrences by IP:")
+	for _, row := range rows {
+		fmt.Println(row.IP)
+		for _, s := range row.Files {
+			lines := make([]string, len(s.Lines))
+			for i, n := range s.Lines {
+				lines[i] = strconv.Itoa(n)
+			}
+			fmt.Printf("  %v: %v\n", s.File, strings.Join(lines, ", "))
+		}
+	}
+	fmt.Println()
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+
+	"github.com/princebot/ipgrep/ipgrep"
+)
+
+// rewriteIP, if set, replaces each IP when input is rewritten rather than
+// scanned, as for -redact or -replace.
+var rewriteIP func(netip.Addr) string
+
+// setRewriter sets rewriteIP according to -redact, -anonymize, -replace, or
+// -map-file, at most one of which may be given.
+func setRewriter() error {
+	var modes []string
+	for _, f := range []struct {
+		name string
+		set  bool
+	}{
+		{"-redact", *redact != ""},
+		{"-anonymize", *anonymize != ""},
+		{"-replace", *replace != ""},
+		{"-map-file", *mapFile != ""},
+	} {
+		if f.set {
+			modes = append(modes, f.name)
+		}
+	}
+	if len(modes) > 1 {
+		return fmt.Errorf("%v are mutually exclusive", strings.Join(modes, " and "))
+	}
+	if *salt != "" && *redact != "hash" {
+		return fmt.Errorf("-salt requires -redact hash")
+	}
+	if *anonKey != "" && *anonymize == "" {
+		return fmt.Errorf("-key requires -anonymize")
+	}
+	if *unmapped != "keep" && *unmapped != "error" {
+		return fmt.Errorf("-unmapped must be keep or error")
+	}
+	var err error
+	switch {
+	case *redact != "":
+		rewriteIP, err = newRedactor(*redact, *salt)
+	case *anonymize == "cryptopan":
+		var c *cryptoPAn
+		if c, err = newCryptoPAn(*anonKey); err == nil {
+			rewriteIP = func(ip netip.Addr) string { return c.anonymize(ip).String() }
+		}
+	case *anonymize != "":
+		err = fmt.Errorf("unknown -anonymize method %q", *anonymize)
+	case *replace != "":
+		rewriteIP, err = newReplacer(*replace)
+	case *mapFile != "":
+		if ipMapping, err = loadIPMap(*mapFile); err == nil {
+			rewriteIP = ipMapping.replace
+		}
+	}
+	return err
+}
+
+// replacement is what a -replace template is executed with.
+type replacement struct {
+	IP    string // the IP in its canonical form.
+	Class string // its address class, as printed by -classify.
+}
+
+// newReplacer returns a function that replaces each IP with the output of
+// the text/template tmpl.
+func newReplacer(tmpl string) (func(netip.Addr) string, error) {
+	t, err := template.New("replace").Parse(tmpl)
+	if err != nil {
+		return nil, fmt.Errorf("-replace: %v", err)
+	}
+	if err := t.Execute(ioutil.Discard, replacement{}); err != nil {
+		return nil, fmt.Errorf("-replace: %v", err)
+	}
+	return func(ip netip.Addr) string {
+		var b strings.Builder
+		t.Execute(&b, replacement{ip.String(), classify(ip)})
+		return b.String()
+	}, nil
+}
+
+// rewrite returns b with every IP that extract would find replaced by
+// replace(ip), leaving the rest of the text untouched.
+func rewrite(b []byte, replace func(netip.Addr) string) []byte {
+	var (
+		out   = make([]byte, 0, len(b))
+		start = -1 // start of the current word, if in one.
+	)
+	flush := func(end int) {
+		word := b[start:end]
+		if ip, ok := ipgrep.ParseIP(word); ok {
+			out = append(out, replace(ip)...)
+		} else {
+			out = append(out, word...)
+		}
+		start = -1
+	}
+	for i := 0; i < len(b); {
+		r, size := utf8.DecodeRune(b[i:])
+		if ipgrep.IsSeparator(r) {
+			if start >= 0 {
+				flush(i)
+			}
+			out = append(out, b[i:i+size]...)
+		} else if start < 0 {
+			start = i
+		}
+		i += size
+	}
+	if start >= 0 {
+		flush(len(b))
+	}
+	return out
+}
+
+// maxRewrittenLine is the most of a line rewriting holds at once: longer
+// lines are rewritten in pieces, each ending between words.
+const maxRewrittenLine = 64 << 10
+
+// rewriteTo copies what r reads to w with every IP replaced by replace(ip),
+// as rewrite does, a line or a piece of one at a time, so that input of any
+// size takes no more memory than maxRewrittenLine. A word a piece ends in
+// is held back to be rewritten with the rest of it, unless it is already
+// too long to be an IP, in which case it is copied as it is. rewriteTo
+// reports whether any IP was replaced.
+func rewriteTo(w io.Writer, r io.Reader, replace func(netip.Addr) string) (changed bool, err error) {
+	var (
+		br    = bufio.NewReaderSize(r, maxRewrittenLine)
+		carry []byte // the start of a word the last piece ended in.
+		skip  bool   // whether the rest of a word too long to hold is copied.
+	)
+	for {
+		b, rerr := br.ReadSlice('\n')
+		if rerr != nil && rerr != bufio.ErrBufferFull && rerr != io.EOF {
+			return changed, rerr
+		}
+		if skip {
+			i := bytes.IndexFunc(b, ipgrep.IsSeparator)
+			if i < 0 {
+				i = len(b)
+			} else {
+				skip = false
+			}
+			if _, err := w.Write(b[:i]); err != nil {
+				return changed, err
+			}
+			b = b[i:]
+		}
+		text := b
+		if len(carry) > 0 {
+			text, carry = append(carry, b...), nil
+		}
+		var tail []byte // the end of text, copied as it is.
+		if rerr == bufio.ErrBufferFull {
+			tail = text
+			if i := bytes.LastIndexFunc(text, ipgrep.IsSeparator); i >= 0 {
+				_, size := utf8.DecodeRune(text[i:])
+				tail = text[i+size:]
+			}
+			text = text[:len(text)-len(tail)]
+			if len(tail) > len("ffff:ffff:ffff:ffff:ffff:ffff:255.255.255.255") {
+				skip = true
+			} else {
+				carry, tail = append([]byte(nil), tail...), nil
+			}
+		}
+		out := rewrite(text, replace)
+		changed = changed || !bytes.Equal(out, text)
+		if _, err := w.Write(append(out, tail...)); err != nil {
+			return changed, err
+		}
+		if rerr == io.EOF {
+			return changed, nil
+		}
+	}
+}
+
+// rewriteFiles prints the content of each named file with its IPs replaced
+// by rewriteIP, dying if a file can’t be read.
+func rewriteFiles(names []string) {
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+	for _, name := range names {
+		fp, err := os.Open(name)
+		if err != nil {
+			die(err)
+		}
+		_, err = rewriteTo(w, fp, rewriteIP)
+		fp.Close()
+		if err != nil {
+			die(err)
+		}
+	}
+}
+
+// rewriteInPlace replaces the content of each named file with its content
+// rewritten by rewriteIP, leaving unchanged files alone. If suffix isn’t
+// empty, the original of each changed file is kept under its name plus
+// suffix. Files that can’t be rewritten are reported and skipped, and the
+// exit status is then as it is for files that fail to scan.
+func rewriteInPlace(names []string, suffix string) {
+	var failed []*scanResult
+	for _, name := range names {
+		if err := rewriteFile(name, suffix); err != nil {
+			// The result names the file, so its error needn’t.
+			if pe, ok := err.(*os.PathError); ok && pe.Path == name {
+				err = fmt.Errorf("%v: %w", pe.Op, pe.Err)
+			}
+			r := &scanResult{File: name, Err: err}
+			printError(r)
+			failed = append(failed, r)
+		}
+	}
+	if status := failureStatus(failed); status != 0 {
+		exit(status)
+	}
+}
+
+// rewriteFile rewrites the named file for rewriteInPlace. The new content is
+// written to a temporary file in the same directory as it is read and, if
+// any IP was replaced, renamed into place, so the file is never left
+// half-written.
+func rewriteFile(name, suffix string) error {
+	fp, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	fi, err := fp.Stat()
+	if err != nil {
+		fp.Close()
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(name), "."+filepath.Base(name)+".")
+	if err != nil {
+		fp.Close()
+		return err
+	}
+	defer os.Remove(tmp.Name()) // fails harmlessly once renamed.
+	w := bufio.NewWriter(tmp)
+	changed, err := rewriteTo(w, fp, rewriteIP)
+	fp.Close() // before it is renamed, which Windows won’t do to an open file.
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if !changed {
+		return nil
+	}
+	if err := os.Chmod(tmp.Name(), fi.Mode().Perm()); err != nil {
+		return err
+	}
+	if suffix != "" {
+		if err := os.Rename(name, name+suffix); err != nil {
+			return err
+		}
+	}
+	return os.Rename(tmp.Name(), name)
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package main
+
+// openFileLimit returns 0: there is no telling how many files may be open
+// at once.
+func openFileLimit() int {
+	return 0
+}
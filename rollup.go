@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"os"
+	"sort"
+	"text/tabwriter"
+)
+
+// hitCount tallies the occurrences of the results in one group.
+type hitCount struct {
+	Hits   int `json:"hits"`   // occurrences, counting repeats.
+	Unique int `json:"unique"` // distinct addresses.
+	seen   map[netip.Addr]bool
+}
+
+// add counts one occurrence of ip.
+func (c *hitCount) add(ip netip.Addr) {
+	if c.seen == nil {
+		c.seen = make(map[netip.Addr]bool)
+	}
+	c.Hits++
+	if !c.seen[ip] {
+		c.seen[ip] = true
+		c.Unique++
+	}
+}
+
+// busier reports whether a should be listed before b because it has more
+// unique addresses or, failing that, more hits; or, if neither is busier,
+// that they are tied.
+func busier(a, b hitCount) (before, tied bool) {
+	if a.Unique != b.Unique {
+		return a.Unique > b.Unique, false
+	}
+	if a.Hits != b.Hits {
+		return a.Hits > b.Hits, false
+	}
+	return false, true
+}
+
+// countryGroup tallies the results registered to one country.
+type countryGroup struct {
+	Country string `json:"country"` // ISO 3166 code, or "" if unknown.
+	hitCount
+}
+
+// groupByCountry buckets every IP in results by the country its ASN lookup in
+// ann reports and returns the buckets, most unique addresses first.
+func groupByCountry(results []*scanResult, ann map[netip.Addr]*enrichment) []*countryGroup {
+	groups := make(map[string]*countryGroup)
+	for _, r := range results {
+		for _, ip := range r.IPs {
+			var key string
+			switch e := ann[ip]; {
+			case e == nil:
+			case e.Country != "":
+				key = e.Country
+			case e.ASN != nil:
+				key = e.ASN.Country
+			}
+			g := groups[key]
+			if g == nil {
+				g = &countryGroup{Country: key}
+				groups[key] = g
+			}
+			g.add(ip)
+		}
+	}
+	out := make([]*countryGroup, 0, len(groups))
+	for _, g := range groups {
+		out = append(out, g)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if before, tied := busier(out[i].hitCount, out[j].hitCount); !tied {
+			return before
+		}
+		return out[i].Country < out[j].Country
+	})
+	return out
+}
+
+// printCountries implements -by-country.
+func printCountries(groups []*countryGroup) {
+	if *output == "json" {
+		printRollupJSON(groups)
+		return
+	}
+	var total int
+	for _, g := range groups {
+		total += g.Unique
+	}
+	fmt.Println("# results by country:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "COUNTRY\tUNIQUE\tSHARE\tHITS")
+	for _, g := range groups {
+		fmt.Fprintf(w, "%v\t%d\t%v\t%d\n", orMissing(g.Country), g.Unique, share(g.Unique, total), g.Hits)
+	}
+	w.Flush()
+	fmt.Println()
+}
+
+// asnGroup tallies the results originated by one autonomous system.
+type asnGroup struct {
+	ASN  string `json:"asn"` // "" if unrouted or unknown.
+	Name string `json:"name,omitempty"`
+	hitCount
+}
+
+// groupByASN buckets every IP in results by the origin AS its ASN lookup in
+// ann reports and returns the buckets, most unique addresses first.
+func groupByASN(results []*scanResult, ann map[netip.Addr]*enrichment) []*asnGroup {
+	groups := make(map[string]*asnGroup)
+	for _, r := range results {
+		for _, ip := range r.IPs {
+			g := &asnGroup{}
+			if e := ann[ip]; e != nil && e.ASN != nil {
+				g.ASN, g.Name = e.ASN.ASN, e.ASN.Name
+			}
+			if known := groups[g.ASN]; known != nil {
+				g = known
+			} else {
+				groups[g.ASN] = g
+			}
+			g.add(ip)
+		}
+	}
+	out := make([]*asnGroup, 0, len(groups))
+	for _, g := range groups {
+		out = append(out, g)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if before, tied := busier(out[i].hitCount, out[j].hitCount); !tied {
+			return before
+		}
+		return out[i].ASN < out[j].ASN
+	})
+	return out
+}
+
+// printASNs implements -by-asn.
+func printASNs(groups []*asnGroup) {
+	if *output == "json" {
+		printRollupJSON(groups)
+		return
+	}
+	var total int
+	for _, g := range groups {
+		total += g.Unique
+	}
+	fmt.Println("# results by origin AS:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "ASN\tAS ORG\tUNIQUE\tSHARE\tHITS")
+	for _, g := range groups {
+		asn := missing
+		if g.ASN != "" {
+			asn = "AS" + g.ASN
+		}
+		fmt.Fprintf(w, "%v\t%v\t%d\t%v\t%d\n", asn, orMissing(g.Name), g.Unique, share(g.Unique, total), g.Hits)
+	}
+	w.Flush()
+	fmt.Println()
+}
+
+// share formats n as a percentage of total.
+func share(n, total int) string {
+	return fmt.Sprintf("%.1f%%", float64(100*n)/float64(total))
+}
+
+// printRollupJSON prints the groups of a rollup as indented JSON.
+func printRollupJSON(groups interface{}) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(groups); err != nil {
+		die(err)
+	}
+}
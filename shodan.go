@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// shodanRate keeps ipgrep within the one-request-per-second limit Shodan
+// applies to most API plans.
+var shodanRate = &throttle{interval: time.Second}
+
+// shodanInfo is the subset of Shodan’s host information ipgrep reports.
+type shodanInfo struct {
+	Ports []int    `json:"ports,omitempty"`
+	Org   string   `json:"org,omitempty"`
+	Tags  []string `json:"tags,omitempty"`
+}
+
+// lookupShodan fetches what Shodan knows about ip, consulting the on-disk
+// cache first. A nil result means Shodan has no data or the query failed.
+func lookupShodan(ip, key string, timeout time.Duration) *shodanInfo {
+	b, err := cached("shodan", ip, func() ([]byte, error) {
+		shodanRate.wait()
+		u := "https://api.shodan.io/shodan/host/" + ip + "?minify=true&key=" + url.QueryEscape(key)
+		return apiGet(u, nil, timeout)
+	})
+	if err != nil || len(b) == 0 {
+		return nil
+	}
+	var info shodanInfo
+	if json.Unmarshal(b, &info) != nil {
+		return nil
+	}
+	return &info
+}
+
+// columns returns the text-mode fields for s, or placeholders if s is nil.
+func (s *shodanInfo) columns() []column {
+	if s == nil {
+		s = new(shodanInfo)
+	}
+	ports := make([]string, len(s.Ports))
+	for i, p := range s.Ports {
+		ports[i] = strconv.Itoa(p)
+	}
+	return []column{
+		{"PORTS", orMissing(strings.Join(ports, ","))},
+		{"SHODAN ORG", orMissing(s.Org)},
+		{"TAGS", orMissing(strings.Join(s.Tags, ","))},
+	}
+}
@@ -0,0 +1,421 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"container/heap"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"sort"
+)
+
+// maxMemory is set by -max-memory.
+var maxMemory sizeFlag
+
+// spillRecord is the size of an IP as a spillSet stores it on disk: the
+// address in 16 bytes, then the order it was first seen in, in 8.
+const spillRecord = 24
+
+// spillSet is the set of distinct IPs in a file, for -unique with
+// -max-memory: it holds them in memory until they would take more than that,
+// then writes them out sorted, as a run in a temporary file, and starts
+// again, its runs being merged with those of every other file once all are
+// scanned. It thus gives the distinct IPs of each file exactly, in order of
+// first appearance, however many there are, in the memory allowed — plus
+// the disk they take.
+type spillSet struct {
+	budget   int64
+	mem      map[netip.Addr]uint64 // the order each IP was first seen in.
+	seq      uint64                // how many IPs have been added.
+	dir      string                // holding the runs, once there are any.
+	runs     []string
+	err      error // the first one writing a run, reported by each.
+	distinct int   // with -count, how many distinct IPs it has, once counted.
+}
+
+func newSpillSet(budget int64) *spillSet {
+	return &spillSet{budget: budget, mem: make(map[netip.Addr]uint64)}
+}
+
+// add adds an occurrence of ip.
+func (s *spillSet) add(ip netip.Addr) {
+	if s.err != nil {
+		return
+	}
+	s.seq++
+	if _, ok := s.mem[ip]; !ok {
+		s.mem[ip] = s.seq
+	}
+	if int64(len(s.mem))*exactEntrySize > s.budget {
+		s.err = s.spill()
+	}
+}
+
+// added returns how many IPs were added, repeats included.
+func (s *spillSet) added() int {
+	return int(s.seq)
+}
+
+// spill writes the IPs in memory out as a run, sorted by address.
+func (s *spillSet) spill() error {
+	if s.dir == "" {
+		dir, err := os.MkdirTemp("", prog+"-spill-")
+		if err != nil {
+			return err
+		}
+		s.dir = dir
+		logger.Info("-max-memory reached; spilling IPs to disk", "dir", dir)
+	}
+	recs := make([]byte, 0, len(s.mem)*spillRecord)
+	for ip, seq := range s.mem {
+		recs = appendRecord(recs, ip, seq)
+	}
+	sortRecords(recs, byAddress)
+	name, err := writeRun(s.dir, "run-", recs)
+	if err != nil {
+		return err
+	}
+	s.runs = append(s.runs, name)
+	clear(s.mem)
+	return nil
+}
+
+// spillBits is how many of the low bits of a sequence number in a merge
+// number the occurrences in an input, the rest numbering the input, so that
+// the records of all of them sort in the order they were found in across
+// them.
+const spillBits = 40
+
+// maxMergeRuns is how many runs are merged at once, so that however many
+// there are, no more files than that are open.
+const maxMergeRuns = 64
+
+// spillRun is a run to be merged, and what to add to the sequence numbers
+// of its records: the number of the input it was made of, in spillBits.
+type spillRun struct {
+	name string
+	base uint64
+}
+
+// mergeSpilled calls fn with each distinct IP added to each of sets, those
+// of inputs in order, just once for each, with the index in sets of the one
+// it was added to, in order of those and then of first appearance if ordered
+// is set, or in no particular order otherwise.
+func mergeSpilled(sets []*spillSet, ordered bool, fn func(i int, ip netip.Addr)) error {
+	var (
+		runs []spillRun
+		dir  string
+	)
+	for i, s := range sets {
+		if s.err != nil {
+			return s.err
+		}
+		if len(s.mem) > 0 {
+			if err := s.spill(); err != nil {
+				return err
+			}
+		}
+		for _, name := range s.runs {
+			runs = append(runs, spillRun{name, uint64(i) << spillBits})
+		}
+		if dir == "" {
+			dir = s.dir
+		}
+	}
+	if len(runs) == 0 {
+		return nil
+	}
+	emit := func(rec []byte) error {
+		ip, seq := decodeRecord(rec)
+		fn(int(seq>>spillBits), ip)
+		return nil
+	}
+	if !ordered {
+		return mergeByAddress(runs, dir, emit)
+	}
+	// Sort the distinct IPs back into the order they were seen in, as
+	// before, a run at a time.
+	var (
+		byOrder []spillRun
+		recs    []byte
+		limit   = int(int64(maxMemory)/spillRecord+1) * spillRecord
+	)
+	flush := func() error {
+		sortRecords(recs, bySequence)
+		name, err := writeRun(dir, "order-", recs)
+		byOrder = append(byOrder, spillRun{name: name})
+		recs = recs[:0]
+		return err
+	}
+	err := mergeByAddress(runs, dir, func(rec []byte) error {
+		if recs = append(recs, rec...); len(recs) >= limit {
+			return flush()
+		}
+		return nil
+	})
+	if err == nil && len(recs) > 0 {
+		err = flush()
+	}
+	if err != nil {
+		return err
+	}
+	return mergeRuns(byOrder, dir, bySequence, emit)
+}
+
+// mergeByAddress calls fn with the record of each distinct IP of each input
+// in runs, in order of address. Of the records of the same IP in the same
+// input, fn gets the one first seen.
+func mergeByAddress(runs []spillRun, dir string, fn func(rec []byte) error) error {
+	var last []byte
+	err := mergeRuns(runs, dir, byAddress, func(rec []byte) error {
+		if last != nil && bytes.Equal(rec[:16], last[:16]) && sameInput(rec, last) {
+			return nil // a later sighting: an IP’s come in the order seen.
+		}
+		if last != nil {
+			if err := fn(last); err != nil {
+				return err
+			}
+		}
+		last = append(last[:0], rec...)
+		return nil
+	})
+	if err == nil && last != nil {
+		err = fn(last)
+	}
+	return err
+}
+
+// sameInput reports whether records a and b, being merged, are of the same
+// input.
+func sameInput(a, b []byte) bool {
+	return binary.BigEndian.Uint64(a[16:])>>spillBits == binary.BigEndian.Uint64(b[16:])>>spillBits
+}
+
+// writeRun writes recs to a new file in dir, its name beginning with
+// prefix, returning its name.
+func writeRun(dir, prefix string, recs []byte) (string, error) {
+	f, err := os.CreateTemp(dir, prefix)
+	if err != nil {
+		return "", err
+	}
+	_, err = f.Write(recs)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return f.Name(), err
+}
+
+// close removes the runs.
+func (s *spillSet) close() {
+	if s.dir != "" {
+		os.RemoveAll(s.dir)
+	}
+}
+
+func appendRecord(b []byte, ip netip.Addr, seq uint64) []byte {
+	a := ip.As16()
+	return binary.BigEndian.AppendUint64(append(b, a[:]...), seq)
+}
+
+func decodeRecord(rec []byte) (netip.Addr, uint64) {
+	// IPs are found unmapped, so an IPv4-mapped one can only be IPv4.
+	ip := netip.AddrFrom16([16]byte(rec[:16])).Unmap()
+	return ip, binary.BigEndian.Uint64(rec[16:])
+}
+
+// byAddress and bySequence order records by address, breaking ties by the
+// order they were seen in, and by that order alone.
+func byAddress(a, b []byte) bool {
+	if c := bytes.Compare(a[:16], b[:16]); c != 0 {
+		return c < 0
+	}
+	return bytes.Compare(a[16:], b[16:]) < 0
+}
+
+func bySequence(a, b []byte) bool {
+	return bytes.Compare(a[16:spillRecord], b[16:spillRecord]) < 0
+}
+
+// records is a buffer of spill records, for sortRecords to sort in place.
+type records struct {
+	b    []byte
+	less func(a, b []byte) bool
+	tmp  [spillRecord]byte
+}
+
+func (r *records) Len() int { return len(r.b) / spillRecord }
+func (r *records) Less(i, j int) bool {
+	return r.less(r.b[i*spillRecord:(i+1)*spillRecord], r.b[j*spillRecord:(j+1)*spillRecord])
+}
+func (r *records) Swap(i, j int) {
+	a, b := r.b[i*spillRecord:(i+1)*spillRecord], r.b[j*spillRecord:(j+1)*spillRecord]
+	copy(r.tmp[:], a)
+	copy(a, b)
+	copy(b, r.tmp[:])
+}
+
+func sortRecords(b []byte, less func(a, b []byte) bool) {
+	sort.Sort(&records{b: b, less: less})
+}
+
+// mergeRuns calls fn with each record of runs, each already sorted by less,
+// in order. Past maxMergeRuns, runs are first merged in batches of that many
+// into runs in dir, and those merged, so that no more are open at once.
+func mergeRuns(runs []spillRun, dir string, less func(a, b []byte) bool, fn func(rec []byte) error) error {
+	for len(runs) > maxMergeRuns {
+		var merged []spillRun
+		for len(runs) > 0 {
+			batch := runs[:min(maxMergeRuns, len(runs))]
+			runs = runs[len(batch):]
+			f, err := os.CreateTemp(dir, "merge-")
+			if err != nil {
+				return err
+			}
+			merged = append(merged, spillRun{name: f.Name()})
+			w := bufio.NewWriter(f)
+			err = mergeOpen(batch, less, func(rec []byte) error {
+				_, err := w.Write(rec)
+				return err
+			})
+			if err == nil {
+				err = w.Flush()
+			}
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				return err
+			}
+		}
+		runs = merged
+	}
+	return mergeOpen(runs, less, fn)
+}
+
+// mergeOpen merges runs as mergeRuns does, holding them all open at once.
+func mergeOpen(runs []spillRun, less func(a, b []byte) bool, fn func(rec []byte) error) error {
+	h := &runHeap{less: less}
+	for _, sr := range runs {
+		f, err := os.Open(sr.name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r := &run{r: bufio.NewReader(f), base: sr.base}
+		if ok, err := r.next(); err != nil {
+			return err
+		} else if ok {
+			h.runs = append(h.runs, r)
+		}
+	}
+	heap.Init(h)
+	for h.Len() > 0 {
+		r := h.runs[0]
+		if err := fn(r.rec[:]); err != nil {
+			return err
+		}
+		ok, err := r.next()
+		if err != nil {
+			return err
+		}
+		if ok {
+			heap.Fix(h, 0)
+		} else {
+			heap.Pop(h)
+		}
+	}
+	return nil
+}
+
+// run is a run being merged, at its current record.
+type run struct {
+	r    *bufio.Reader
+	rec  [spillRecord]byte
+	base uint64 // added to the sequence number of each record.
+}
+
+// next reads the run’s next record, reporting whether there was one.
+func (r *run) next() (bool, error) {
+	if _, err := io.ReadFull(r.r, r.rec[:]); err != nil {
+		if err == io.EOF {
+			return false, nil
+		}
+		return false, err
+	}
+	if r.base != 0 {
+		seq := binary.BigEndian.Uint64(r.rec[16:])
+		binary.BigEndian.PutUint64(r.rec[16:], seq+r.base)
+	}
+	return true, nil
+}
+
+// runHeap orders runs by their current records.
+type runHeap struct {
+	runs []*run
+	less func(a, b []byte) bool
+}
+
+func (h *runHeap) Len() int           { return len(h.runs) }
+func (h *runHeap) Less(i, j int) bool { return h.less(h.runs[i].rec[:], h.runs[j].rec[:]) }
+func (h *runHeap) Swap(i, j int)      { h.runs[i], h.runs[j] = h.runs[j], h.runs[i] }
+func (h *runHeap) Push(x any)         { h.runs = append(h.runs, x.(*run)) }
+func (h *runHeap) Pop() any {
+	r := h.runs[len(h.runs)-1]
+	h.runs = h.runs[:len(h.runs)-1]
+	return r
+}
+
+// spillSets returns the spillSets of results, in order.
+func spillSets(results []*scanResult) []*spillSet {
+	sets := make([]*spillSet, len(results))
+	for i, r := range results {
+		sets[i] = r.Spilled
+	}
+	return sets
+}
+
+// countSpilled counts, for -count, the distinct IPs of each of results, and
+// then removes their runs.
+func countSpilled(results []*scanResult) {
+	sets := spillSets(results)
+	defer closeSpilled(sets)
+	if err := mergeSpilled(sets, false, func(i int, _ netip.Addr) { sets[i].distinct++ }); err != nil {
+		die(fmt.Errorf("-max-memory: %w", err))
+	}
+}
+
+// printSpilled prints results as printText would, and then removes their
+// runs.
+func printSpilled(results []*scanResult) {
+	sets := spillSets(results)
+	defer closeSpilled(sets)
+	next := 0 // the result whose header comes next.
+	header := func(upTo int) {
+		for ; next <= upTo; next++ {
+			if next > 0 {
+				fmt.Println()
+			}
+			printHeader(results[next])
+		}
+	}
+	err := mergeSpilled(sets, true, func(i int, ip netip.Addr) {
+		header(i)
+		fmt.Fprintln(stdout, ipColor.Sprint(ip))
+	})
+	if err != nil {
+		die(fmt.Errorf("-max-memory: %w", err))
+	}
+	if header(len(results) - 1); len(results) > 0 {
+		fmt.Println()
+	}
+}
+
+// closeSpilled removes the runs of sets.
+func closeSpilled(sets []*spillSet) {
+	for _, s := range sets {
+		s.close()
+	}
+}
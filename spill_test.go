@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+// TestSpillParity checks that -max-memory changes nothing about -unique but
+// how much memory it takes: spilled, each file’s distinct IPs are the same,
+// in the same order, and so are their counts.
+func TestSpillParity(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	defer func(m sizeFlag) { maxMemory = m }(maxMemory)
+	rng := rand.New(rand.NewSource(1))
+	ipsOf := func(n, spread int) []netip.Addr {
+		ips := make([]netip.Addr, n)
+		for i := range ips {
+			n := rng.Intn(spread)
+			ips[i] = netip.AddrFrom4([4]byte{10, 0, byte(n >> 8), byte(n)})
+		}
+		return ips
+	}
+	tests := []struct {
+		name   string
+		files  [][]netip.Addr
+		budget sizeFlag
+	}{
+		{"empty", [][]netip.Addr{nil}, 1 << 20},
+		{"in memory", [][]netip.Addr{ipsOf(100, 50)}, 1 << 20},
+		{"one file spilled", [][]netip.Addr{ipsOf(5000, 2000)}, 10 * exactEntrySize},
+		{"files sharing IPs", [][]netip.Addr{ipsOf(3000, 500), ipsOf(3000, 500), nil, ipsOf(10, 500)}, 10 * exactEntrySize},
+		{"each IP in one run", [][]netip.Addr{ipsOf(1000, 2000), ipsOf(1000, 2000)}, exactEntrySize},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			maxMemory = tt.budget
+			var inMemory []*scanResult
+			for i, ips := range tt.files {
+				inMemory = append(inMemory, &scanResult{File: fmt.Sprintf("%d.log", i), IPs: ips})
+			}
+			want := distinct(inMemory)
+			spill := func() []*scanResult {
+				var spilled []*scanResult
+				for _, r := range inMemory {
+					s := newSpillSet(int64(tt.budget))
+					for _, ip := range r.IPs {
+						s.add(ip)
+					}
+					spilled = append(spilled, &scanResult{File: r.File, Spilled: s})
+				}
+				return spilled
+			}
+
+			spilled := spill()
+			got := make([][]netip.Addr, len(spilled))
+			sets := spillSets(spilled)
+			err := mergeSpilled(sets, true, func(i int, ip netip.Addr) { got[i] = append(got[i], ip) })
+			closeSpilled(sets)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := range want {
+				if !reflect.DeepEqual(got[i], want[i].IPs) {
+					t.Errorf("file %d: spilled gives %d IPs %v, want %d %v", i, len(got[i]), got[i], len(want[i].IPs), want[i].IPs)
+				}
+			}
+
+			// Merging removes the runs, so they are made again to count.
+			spilled = spill()
+			countSpilled(spilled)
+			for i := range want {
+				if n, m := numIPs(spilled[i]), numIPs(want[i]); n != m {
+					t.Errorf("file %d: spilled counts %d IPs, want %d", i, n, m)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+)
+
+const statsUsage = `
+usage: %[1]v stats [-output FORMAT] [-top N] file ...
+
+Summarizes the IPs in one or more files without listing them: total matches,
+unique IPs, the IPv4/IPv6 split, how many are public, private, or otherwise
+special-purpose, the busiest /24 and /64 subnets, and a breakdown by file.
+
+	-output FORMAT    print statistics as text (the default) or json
+	-top N            show the N busiest subnets (default 10)
+`
+
+// counts tallies the IPs in one file, or in all of them.
+type counts struct {
+	File    string `json:"file,omitempty"`
+	Matches int    `json:"matches"` // occurrences, counting repeats.
+	Unique  int    `json:"unique"`
+	IPv4    int    `json:"ipv4"` // unique IPv4 addresses.
+	IPv6    int    `json:"ipv6"`
+	Public  int    `json:"public"`  // unique public addresses.
+	Private int    `json:"private"` // unique RFC 1918 and RFC 4193 addresses.
+	Other   int    `json:"other"`   // unique loopback, link-local, etc.
+}
+
+// runStats is the output of “ipgrep stats”.
+type runStats struct {
+	counts
+	TopSubnets []*prefixGroup `json:"top_subnets"`
+	Files      []counts       `json:"files"`
+}
+
+// statsFlags holds the options of “ipgrep stats”.
+var (
+	statsFlags = flag.NewFlagSet("stats", flag.ExitOnError)
+	statsTop   = statsFlags.Int("top", 10, "number of subnets to show")
+)
+
+func init() {
+	statsFlags.StringVar(output, "output", "text", "output format: text or json")
+	statsFlags.Usage = func() { fmt.Fprintf(os.Stderr, statsUsage, prog) }
+}
+
+// statsCommand implements “ipgrep stats”.
+func statsCommand(args []string) {
+	fs := statsFlags
+	parseArgs(fs, args)
+	if fs.NArg() < 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if *output != "text" && *output != "json" {
+		die(fmt.Sprintf("unknown output format %q", *output))
+	}
+	scanned, failed := scanFiles(fs.Args())
+	st := runStats{counts: tally("", scanned), Files: []counts{}}
+	for _, r := range scanned {
+		st.Files = append(st.Files, tally(r.File, []*scanResult{r}))
+	}
+	st.TopSubnets = groupByPrefix(scanned, 24, 64)
+	if len(st.TopSubnets) > *statsTop {
+		st.TopSubnets = st.TopSubnets[:*statsTop]
+	}
+	printStats(st)
+	for _, r := range failed {
+		printError(r)
+	}
+	exitIfInterrupted()
+}
+
+// tally counts the IPs in results, labeling the counts with file.
+func tally(file string, results []*scanResult) counts {
+	c := counts{File: file}
+	for _, r := range results {
+		c.Matches += len(r.IPs)
+	}
+	for _, ip := range unique(results) {
+		c.Unique++
+		if ip.Is4() {
+			c.IPv4++
+		} else {
+			c.IPv6++
+		}
+		switch classify(ip) {
+		case classPublic:
+			c.Public++
+		case classPrivate, classULA:
+			c.Private++
+		default:
+			c.Other++
+		}
+	}
+	return c
+}
+
+// printStats prints st in the -output format.
+func printStats(st runStats) {
+	if *output == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(st); err != nil {
+			die(err)
+		}
+		return
+	}
+	pct := func(n int) string {
+		if st.Unique == 0 {
+			return ""
+		}
+		return fmt.Sprintf(" (%.1f%%)", 100*float64(n)/float64(st.Unique))
+	}
+	fmt.Println("# statistics:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "matches\t%d\n", st.Matches)
+	fmt.Fprintf(w, "unique IPs\t%d\n", st.Unique)
+	fmt.Fprintf(w, "IPv4\t%d%v\n", st.IPv4, pct(st.IPv4))
+	fmt.Fprintf(w, "IPv6\t%d%v\n", st.IPv6, pct(st.IPv6))
+	fmt.Fprintf(w, "public\t%d%v\n", st.Public, pct(st.Public))
+	fmt.Fprintf(w, "private\t%d%v\n", st.Private, pct(st.Private))
+	fmt.Fprintf(w, "other\t%d%v\n", st.Other, pct(st.Other))
+	w.Flush()
+	fmt.Println()
+
+	fmt.Println("# top subnets:")
+	printGroupTable(st.TopSubnets)
+	fmt.Println()
+
+	fmt.Println("# by file:")
+	w = tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "FILE\tMATCHES\tUNIQUE\tIPV4\tIPV6\tPUBLIC\tPRIVATE\tOTHER")
+	for _, c := range st.Files {
+		fmt.Fprintf(w, "%v\t%d\t%d\t%d\t%d\t%d\t%d\t%d\n",
+			c.File, c.Matches, c.Unique, c.IPv4, c.IPv6, c.Public, c.Private, c.Other)
+	}
+	w.Flush()
+	fmt.Println()
+}
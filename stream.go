@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// stream, if not nil, prints results as text while the scans go on rather
+// than once they are done. scanCommand sets it when nothing has to be done
+// across files before printing, as it must be to group or count results,
+// for instance, or to make lookups.
+var stream *resultStream
+
+// resultStream prints each file’s results once those of the files named
+// before it have been, holding them until then, so that they come out in the
+// same order as if printed at the end. If live is set, the IPs of the file
+// whose turn it is are printed as they are found, and not kept.
+type resultStream struct {
+	live bool
+	turn atomic.Int64 // index of the file being printed.
+
+	mu      sync.Mutex
+	files   []*streamedFile
+	waiting []*scanResult // by index, those finished before their turn.
+}
+
+// streamedFile is one file’s place in a resultStream.
+type streamedFile struct {
+	s       *resultStream
+	i       int
+	started bool     // whether its header has been printed.
+	done    bool     // whether its results have been handed to finish.
+	seen    *seenSet // with -unique, the IPs printed.
+}
+
+func newResultStream(files int, live bool) *resultStream {
+	s := &resultStream{live: live, files: make([]*streamedFile, files), waiting: make([]*scanResult, files)}
+	for i := range s.files {
+		s.files[i] = &streamedFile{s: s, i: i}
+	}
+	return s
+}
+
+// file returns the place in s of the file at index i, or nil if s is nil.
+func (s *resultStream) file(i int) *streamedFile {
+	if s == nil {
+		return nil
+	}
+	return s.files[i]
+}
+
+// found prints the IPs found in res so far, and drops them from it, if the
+// stream is live and it is f’s turn; otherwise they are kept for finish. It
+// is called only by the scan of f, with each match.
+func (f *streamedFile) found(res *scanResult) {
+	if f == nil || !f.s.live || f.s.turn.Load() != int64(f.i) {
+		return
+	}
+	f.s.mu.Lock()
+	defer f.s.mu.Unlock()
+	if f.done {
+		return // the scan was given up on, and its result printed.
+	}
+	f.flush(res)
+	res.Printed += len(res.IPs)
+	res.IPs = res.IPs[:0]
+}
+
+// flush prints the IPs in res, or with -unique those not already printed,
+// first printing the header for f if it hasn’t been.
+func (f *streamedFile) flush(res *scanResult) {
+	if !f.started {
+		printHeader(res)
+		f.started = true
+		if *uniqueIPs {
+			f.seen = newSeenSet(int64(uniqueMemory))
+		}
+	}
+	for _, ip := range res.IPs {
+		if f.seen == nil || f.seen.add(ip) {
+			fmt.Fprintln(stdout, ipColor.Sprint(ip))
+		}
+	}
+}
+
+// finish takes the final result of f’s scan, printing it, and any held for
+// the files after it, if it is f’s turn.
+func (f *streamedFile) finish(res *scanResult) {
+	if f == nil {
+		return
+	}
+	s := f.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f.done = true
+	s.waiting[f.i] = res
+	for i := int(s.turn.Load()); i < len(s.files) && s.waiting[i] != nil; i++ {
+		s.files[i].print(s.waiting[i])
+		s.waiting[i] = nil
+		s.turn.Add(1)
+	}
+}
+
+// print prints what is left of f’s result res, as printText would have, and
+// then drops it. Failed scans print nothing unless some of their IPs
+// already have been; the error is reported with the others at the end.
+func (f *streamedFile) print(res *scanResult) {
+	switch {
+	case f.s.live && (res.Err == nil || f.started):
+		f.flush(res)
+		fmt.Println()
+	case res.Err == nil && *uniqueIPs:
+		printText(distinct([]*scanResult{res}), nil)
+	case res.Err == nil:
+		printText([]*scanResult{res}, nil)
+	}
+	res.Printed += len(res.IPs)
+	res.IPs, res.Times, res.Matches = nil, nil, nil
+	f.seen = nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/netip"
+	"os"
+	"sort"
+)
+
+// cidr is an address block held as its first address and prefix length, in
+// a family of bits-bit addresses.
+type cidr struct {
+	start *big.Int
+	ones  int
+	bits  int // 32 for IPv4, 128 for IPv6.
+}
+
+// size returns the number of addresses in c.
+func (c cidr) size() *big.Int {
+	return new(big.Int).Lsh(big.NewInt(1), uint(c.bits-c.ones))
+}
+
+func (c cidr) String() string {
+	ip, _ := netip.AddrFromSlice(c.start.FillBytes(make([]byte, c.bits/8)))
+	return netip.PrefixFrom(ip, c.ones).String()
+}
+
+// summarize returns the smallest set of CIDR blocks covering ips, IPv4 blocks
+// first. If slack is positive, neighboring blocks are merged into their
+// common supernet whenever that adds no more than slack addresses that
+// weren’t in ips, trading precision for a shorter list.
+func summarize(ips []netip.Addr, slack int64) []cidr {
+	var v4, v6 []*big.Int
+	for _, ip := range ips {
+		v := new(big.Int).SetBytes(ip.AsSlice())
+		if ip.Is4() {
+			v4 = append(v4, v)
+		} else {
+			v6 = append(v6, v)
+		}
+	}
+	s := big.NewInt(slack)
+	return append(mergeBlocks(cover(v4, 32), s), mergeBlocks(cover(v6, 128), s)...)
+}
+
+// cover returns the minimal list of bits-bit CIDR blocks containing exactly
+// the addresses in addrs, in ascending order.
+func cover(addrs []*big.Int, bits int) []cidr {
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i].Cmp(addrs[j]) < 0 })
+	var (
+		blocks []cidr
+		one    = big.NewInt(1)
+	)
+	for i := 0; i < len(addrs); {
+		// Find the run of consecutive addresses starting at addrs[i].
+		lo, hi := addrs[i], addrs[i]
+		for i++; i < len(addrs); i++ {
+			next := new(big.Int).Add(hi, one)
+			if c := addrs[i].Cmp(next); c > 0 {
+				break
+			} else if c == 0 {
+				hi = addrs[i]
+			}
+		}
+		blocks = append(blocks, rangeBlocks(lo, hi, bits)...)
+	}
+	return blocks
+}
+
+// rangeBlocks splits the inclusive address range lo–hi into CIDR blocks,
+// each as large as its alignment and the end of the range allow.
+func rangeBlocks(lo, hi *big.Int, bits int) []cidr {
+	var (
+		blocks []cidr
+		one    = big.NewInt(1)
+		cur    = new(big.Int).Set(lo)
+	)
+	for cur.Cmp(hi) <= 0 {
+		host := 0
+		for host < bits && cur.Bit(host) == 0 {
+			last := new(big.Int).Lsh(one, uint(host+1))
+			last.Add(last, cur).Sub(last, one)
+			if last.Cmp(hi) > 0 {
+				break
+			}
+			host++
+		}
+		blocks = append(blocks, cidr{new(big.Int).Set(cur), bits - host, bits})
+		cur.Add(cur, new(big.Int).Lsh(one, uint(host)))
+	}
+	return blocks
+}
+
+// mergeBlocks repeatedly replaces runs of neighboring blocks with their
+// smallest common supernet while doing so covers at most slack addresses
+// outside the original blocks. blocks must be sorted and disjoint.
+func mergeBlocks(blocks []cidr, slack *big.Int) []cidr {
+	if slack.Sign() <= 0 {
+		return blocks
+	}
+	for merged := true; merged; {
+		merged = false
+		for i := 0; i+1 < len(blocks); i++ {
+			super := supernet(blocks[i], blocks[i+1])
+			end := new(big.Int).Add(super.start, super.size())
+			covered := new(big.Int)
+			j := i
+			for ; j < len(blocks) && blocks[j].start.Cmp(end) < 0; j++ {
+				covered.Add(covered, blocks[j].size())
+			}
+			extra := new(big.Int).Sub(super.size(), covered)
+			if extra.Cmp(slack) > 0 {
+				continue
+			}
+			blocks = append(append(blocks[:i:i], super), blocks[j:]...)
+			merged = true
+		}
+	}
+	return blocks
+}
+
+// supernet returns the smallest block containing both a and b.
+func supernet(a, b cidr) cidr {
+	ones := a.ones
+	if b.ones < ones {
+		ones = b.ones
+	}
+	for ; ones > 0; ones-- {
+		mask := new(big.Int).Lsh(big.NewInt(1), uint(a.bits-ones))
+		mask.Sub(mask, big.NewInt(1)).Not(mask)
+		sa, sb := new(big.Int).And(a.start, mask), new(big.Int).And(b.start, mask)
+		if sa.Cmp(sb) == 0 {
+			return cidr{sa, ones, a.bits}
+		}
+	}
+	return cidr{new(big.Int), 0, a.bits}
+}
+
+// printSummary prints the blocks from summarize in the -output format.
+func printSummary(blocks []cidr, n int) {
+	if *output == "json" {
+		out := make([]string, len(blocks))
+		for i, b := range blocks {
+			out[i] = b.String()
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(out); err != nil {
+			die(err)
+		}
+		return
+	}
+	fmt.Printf("# %d unique IPs summarized in %d blocks:\n", n, len(blocks))
+	for _, b := range blocks {
+		fmt.Println(b)
+	}
+	fmt.Println()
+}
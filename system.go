@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/princebot/ipgrep/ipgrep"
+)
+
+const systemUsage = `
+usage: %[1]v system [options]
+
+Scans the system’s network configuration — its hosts file and resolv.conf,
+and the settings of NetworkManager, netplan, ifupdown, systemd, and the
+like, or on Windows its own hosts file and the TCP/IP settings of its
+interfaces — for every address configured, as during an audit of a host,
+so that every option of a scan applies to them: -output json finds each
+in the field of the setting it is given by, as
+"nameserver", "address1", or "network.ethernets.eth0.addresses", in the
+context of the "section" of an INI file it is in, or, in a hosts file, in
+the field "address", in the context of the "names" given it. Netmasks
+aren’t addresses, and are left out, as are comments.
+
+	%[1]v system -output lines
+	%[1]v system -classify -output json
+
+Files that don’t exist are skipped, but those that exist and can’t be read,
+as NetworkManager’s connections without root, are errors. On Windows, the
+registry’s settings are scanned as the input "registry".
+`
+
+// systemInput is the name of the input system makes of the registry’s
+// settings, where there are any.
+const systemInput = "registry"
+
+// systemCommand implements “ipgrep system”.
+func systemCommand(args []string) {
+	tableArgs("system", systemUsage, args)
+	var names []string
+	for _, pattern := range systemPatterns {
+		files, _ := filepath.Glob(pattern)
+		for _, f := range files {
+			if fi, err := os.Stat(f); err == nil && fi.Mode().IsRegular() {
+				names = append(names, f)
+			}
+		}
+	}
+	reg, err := systemRegistry()
+	if err != nil {
+		die(fmt.Errorf("reading the registry: %w", err))
+	}
+	if reg != nil {
+		serveTable(systemInput, reg)
+		names = append(names, systemInput)
+	}
+	if len(names) == 0 {
+		die("no network configuration found")
+	}
+	parser = systemParser{}
+	scanNames(names)
+}
+
+// systemParser reads the configuration files system scans, whichever of
+// their syntaxes a line is in: a hosts file’s address and names; an INI
+// file’s “key=value”, under a “[section]”, as NetworkManager’s are and the
+// registry is made into; YAML’s “key: value”, as netplan’s are, its field
+// the keys it is under joined by dots; or “keyword value”, as resolv.conf’s
+// are. Each address in the value is a match in the field its key names, but
+// a netmask.
+type systemParser struct{}
+
+func (systemParser) Name() string { return "system" }
+
+// systemKey is a YAML key a line may be under: those indented further.
+type systemKey struct {
+	indent int
+	name   string
+}
+
+func (systemParser) Parse(r io.Reader, emit func(ipgrep.Match) error) error {
+	var (
+		br      = bufio.NewReader(r)
+		off     int64
+		section string
+		keys    []systemKey // those the line is under, outermost first.
+	)
+	for n := 1; ; n++ {
+		raw, err := br.ReadString('\n')
+		if raw == "" {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		line := strings.TrimRight(raw, "\r\n")
+		code := line
+		if i := systemComment(code); i >= 0 {
+			code = code[:i]
+		}
+		var (
+			indent = len(code) - len(strings.TrimLeft(code, " \t"))
+			rest   = strings.TrimSpace(code)
+			field  string
+			value  = -1 // where on the line its value begins, if it has one.
+			ctx    = make(map[string]string)
+			as     []ipgrep.Artifact
+		)
+		if section != "" {
+			ctx["section"] = section
+		}
+		switch {
+		case rest == "" || rest[0] == ';':
+		case rest[0] == '[' && rest[len(rest)-1] == ']':
+			section, keys = rest[1:len(rest)-1], nil
+		case hostsEntry(rest):
+			field, value = "address", indent
+			ctx["names"] = strings.Join(strings.Fields(rest)[1:], " ")
+		default:
+			item := false
+			if r, ok := strings.CutPrefix(rest, "- "); ok {
+				item, rest = true, strings.TrimLeft(r, " \t")
+			}
+			at := len(code) - len(rest)
+			key, sep := systemSetting(rest)
+			switch {
+			case sep == '=':
+				field, value = key, at+strings.IndexByte(rest, '=')+1
+			case sep == ':':
+				value = at + strings.IndexByte(rest, ':') + 1
+				for len(keys) > 0 && keys[len(keys)-1].indent >= at {
+					keys = keys[:len(keys)-1]
+				}
+				field = yamlPath(keys, key)
+				if strings.TrimSpace(code[value:]) == "" {
+					keys = append(keys, systemKey{at, key})
+				}
+			case item:
+				for len(keys) > 0 && keys[len(keys)-1].indent > indent {
+					keys = keys[:len(keys)-1]
+				}
+				field, value = yamlPath(keys, ""), at
+			default:
+				key, _, _ = strings.Cut(rest, " ")
+				key, _, _ = strings.Cut(key, "\t")
+				field, value = key, at+len(key)
+			}
+		}
+		if value >= 0 {
+			// Extract apart from the key, since “=” doesn’t end a word.
+			as = ipgrep.IPs.Extract([]byte(code[value:]))
+			for i := range as {
+				as[i].Offset += value
+			}
+			if field == "address" && len(as) > 0 {
+				as = as[:1] // a hosts file’s names aren’t addresses.
+			}
+		}
+		if field == "" {
+			field = "address"
+		}
+		text := []byte(line)
+		for _, a := range as {
+			ip, _ := a.Value.(netip.Addr)
+			if isNetmask(ip, field, code[:a.Offset]) {
+				continue
+			}
+			m := ipgrep.Match{
+				IP: ip, Artifact: a, Field: field, Line: n, Text: text, Context: ctx,
+				Column: a.Offset + 1, Offset: off + int64(a.Offset),
+			}
+			if err := emit(m); err != nil {
+				return err
+			}
+		}
+		off += int64(len(raw))
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// systemComment returns where the comment on line begins, at a “#” at its
+// start or after a space, or -1 if it has none.
+func systemComment(line string) int {
+	for i := 0; i < len(line); i++ {
+		if line[i] == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t') {
+			return i
+		}
+	}
+	return -1
+}
+
+// hostsEntry reports whether rest is a line of a hosts file: an address,
+// perhaps with a zone, and then names.
+func hostsEntry(rest string) bool {
+	f := strings.Fields(rest)
+	if len(f) < 2 {
+		return false
+	}
+	addr, _, _ := strings.Cut(f[0], "%")
+	_, ok := ipgrep.ParseIP([]byte(addr))
+	return ok
+}
+
+// systemSetting returns the key that rest, a setting, begins with and the
+// separator after it, ‘=’ or ‘:’, or 0 if it isn’t one. YAML’s ‘:’ is
+// followed by a space, if anything, so that an IPv6 address isn’t a key.
+func systemSetting(rest string) (string, byte) {
+	i := 0
+	for i < len(rest) && (isAlnum(rest[i]) || strings.IndexByte("_.-", rest[i]) >= 0) {
+		i++
+	}
+	key := rest[:i]
+	for i < len(rest) && (rest[i] == ' ' || rest[i] == '\t') {
+		i++
+	}
+	switch {
+	case key == "" || i == len(rest):
+		return "", 0
+	case rest[i] == '=':
+		return key, '='
+	case rest[i] == ':' && (i+1 == len(rest) || rest[i+1] == ' ' || rest[i+1] == '\t'):
+		return key, ':'
+	}
+	return "", 0
+}
+
+// isAlnum reports whether c is an ASCII letter or digit.
+func isAlnum(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// yamlPath returns the keys and then key, if any, joined by dots.
+func yamlPath(keys []systemKey, key string) string {
+	var path []string
+	for _, k := range keys {
+		path = append(path, k.name)
+	}
+	if key != "" {
+		path = append(path, key)
+	}
+	return strings.Join(path, ".")
+}
+
+// isNetmask reports whether ip, after before on a line setting field, is a
+// netmask, as its field or the word before it says, or as it is one
+// beginning with 255, which no host’s address does.
+func isNetmask(ip netip.Addr, field, before string) bool {
+	if ip.Is4() {
+		b := ip.As4()
+		if hosts := ^binary.BigEndian.Uint32(b[:]); b[0] == 255 && hosts&(hosts+1) == 0 {
+			return true
+		}
+	}
+	before = strings.ToLower(strings.TrimRight(before, " \t=\"'"))
+	return strings.Contains(strings.ToLower(field), "mask") || strings.HasSuffix(before, "mask")
+}
@@ -0,0 +1,106 @@
+//go:build windows
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+// systemPatterns are the files system scans, as filepath.Glob takes them:
+// Windows’ hosts, lmhosts, and networks files.
+var systemPatterns = []string{
+	filepath.Join(systemRoot(), `System32\drivers\etc\hosts`),
+	filepath.Join(systemRoot(), `System32\drivers\etc\lmhosts`),
+	filepath.Join(systemRoot(), `System32\drivers\etc\networks`),
+}
+
+// systemRoot returns the directory Windows is installed in.
+func systemRoot() string {
+	if root := os.Getenv("SystemRoot"); root != "" {
+		return root
+	}
+	return `C:\Windows`
+}
+
+// tcpipKeys are the registry’s keys of the TCP/IP settings of the system,
+// for IPv4 and IPv6, each with a subkey of Interfaces for each interface.
+var tcpipKeys = []string{
+	`SYSTEM\CurrentControlSet\Services\Tcpip\Parameters`,
+	`SYSTEM\CurrentControlSet\Services\Tcpip6\Parameters`,
+}
+
+// systemRegistry returns the string values of tcpipKeys and their
+// interfaces’ subkeys as an INI file, a section to a key, those of many
+// strings joined by commas, as in
+//
+//	[HKLM\SYSTEM\CurrentControlSet\Services\Tcpip\Parameters\Interfaces\{…}]
+//	DhcpIPAddress=10.0.0.5
+//	NameServer=10.0.0.1,10.0.0.2
+func systemRegistry() ([]byte, error) {
+	var b bytes.Buffer
+	for _, path := range tcpipKeys {
+		if err := writeRegistryKey(&b, path); err != nil {
+			return nil, err
+		}
+		k, err := registry.OpenKey(registry.LOCAL_MACHINE, path+`\Interfaces`, registry.ENUMERATE_SUB_KEYS)
+		if errors.Is(err, registry.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		ifaces, err := k.ReadSubKeyNames(-1)
+		k.Close()
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(ifaces)
+		for _, iface := range ifaces {
+			if err := writeRegistryKey(&b, path+`\Interfaces\`+iface); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return b.Bytes(), nil
+}
+
+// writeRegistryKey writes the section of systemRegistry’s INI file for the
+// key at path, unless it doesn’t exist.
+func writeRegistryKey(b *bytes.Buffer, path string) error {
+	k, err := registry.OpenKey(registry.LOCAL_MACHINE, path, registry.QUERY_VALUE)
+	if errors.Is(err, registry.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer k.Close()
+	names, err := k.ReadValueNames(-1)
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+	fmt.Fprintf(b, "[HKLM\\%v]\n", path)
+	for _, name := range names {
+		v, _, err := k.GetStringValue(name)
+		if err != nil {
+			vs, _, serr := k.GetStringsValue(name)
+			if serr != nil {
+				continue // not a string.
+			}
+			v = strings.Join(vs, ",")
+		}
+		if v = strings.TrimSpace(v); v != "" && !strings.ContainsAny(v, "\r\n") {
+			fmt.Fprintf(b, "%v=%v\n", name, v)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/princebot/ipgrep/ipgrep"
+)
+
+// tableArgs parses the options of a command, such as net, that scans a
+// table of its own making rather than files, using usage for its help.
+func tableArgs(cmd, usage string, args []string) {
+	flag.Usage = func() { fmt.Fprintf(os.Stderr, usage, prog) }
+	parseArgs(flag.CommandLine, args)
+	if flag.NArg() > 0 {
+		die(cmd + " takes no files")
+	}
+	if *inputFormat != "" {
+		die(cmd + " can’t be used with -format")
+	}
+}
+
+// scanTable scans table, made by a command such as net, as the input named
+// name, with p, as scanCommand would a file.
+func scanTable(name string, table []byte, p ipgrep.Parser) {
+	parser = p
+	serveTable(name, table)
+	scanNames([]string{name})
+}
+
+// serveTable makes table the input named name, which scanNames then reads
+// in place of a file of that name.
+func serveTable(name string, table []byte) {
+	openInput = func(n string) (*os.File, error) {
+		if n != name {
+			return os.Open(n)
+		}
+		r, w, err := os.Pipe()
+		if err != nil {
+			return nil, err
+		}
+		go func() {
+			w.Write(table)
+			w.Close()
+		}()
+		return r, nil
+	}
+}
+
+// tableParser reads a table made for scanTable: a header naming its
+// columns, then a row to a line, its columns separated by spaces, the last
+// of which may have spaces of its own, with “-” for what isn’t known. The
+// address in the column named field, with or without a port, is a match in
+// that field, in the context of the rest of its row, and its "port".
+type tableParser struct {
+	name, field string
+}
+
+func (p tableParser) Name() string { return p.name }
+
+func (p tableParser) Parse(r io.Reader, emit func(ipgrep.Match) error) error {
+	var (
+		sc     = bufio.NewScanner(r)
+		header []string
+		off    int64
+	)
+	for n := 1; sc.Scan(); n++ {
+		if header == nil {
+			header = strings.Fields(sc.Text())
+		} else if m, ok := p.row(header, sc.Text(), n, off); ok {
+			if err := emit(m); err != nil {
+				return err
+			}
+		}
+		off += int64(len(sc.Bytes())) + 1
+	}
+	return sc.Err()
+}
+
+// row returns the match on line n of the table with the columns header,
+// which begins at off, unless it has none.
+func (p tableParser) row(header []string, line string, n int, off int64) (ipgrep.Match, bool) {
+	var (
+		cols = strings.SplitN(line, " ", len(header))
+		m    = ipgrep.Match{Field: p.field, Line: n, Text: []byte(line), Context: make(map[string]string)}
+		col  int
+	)
+	for i, v := range cols {
+		switch {
+		case header[i] == p.field:
+			ip, err := netip.ParseAddr(v)
+			if ap, perr := netip.ParseAddrPort(v); perr == nil {
+				ip, err = ap.Addr(), nil
+				m.Context["port"] = strconv.Itoa(int(ap.Port()))
+			}
+			if err != nil {
+				return ipgrep.Match{}, false
+			}
+			text := ip.String()
+			c := col + strings.Index(v, text)
+			m.IP = ip
+			m.Artifact = ipgrep.Artifact{Kind: "ip", Text: text, Value: ip, Offset: c}
+			m.Column, m.Offset = c+1, off+int64(c)
+		case v != missing:
+			m.Context[header[i]] = v
+		}
+		col += len(v) + 1
+	}
+	return m, m.IP.IsValid()
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// timestampFormats are the timestamp formats -timeline recognizes, each as a
+// pattern that finds one on a line and the layout that parses it. The first
+// format found on a line wins.
+var timestampFormats = []struct {
+	re     *regexp.Regexp
+	layout string
+}{
+	// RFC 3339 and ISO 8601, e.g. 2017-03-14T15:09:26.535Z or
+	// 2017-03-14 15:09:26+01:00.
+	{
+		regexp.MustCompile(`\d{4}-\d\d-\d\d[T ]\d\d:\d\d:\d\d(?:[.,]\d+)?(?:Z|[+-]\d\d:?\d\d)?`),
+		"", // normalized by parseISOTime.
+	},
+	// Common and combined log format, e.g. 14/Mar/2017:15:09:26 -0700.
+	{
+		regexp.MustCompile(`\d\d/[A-Z][a-z]{2}/\d{4}:\d\d:\d\d:\d\d [+-]\d{4}`),
+		"02/Jan/2006:15:04:05 -0700",
+	},
+	// Syslog (RFC 3164), e.g. Mar 14 15:09:26, which has no year.
+	{
+		regexp.MustCompile(`[A-Z][a-z]{2} [ \d]\d \d\d:\d\d:\d\d`),
+		time.Stamp,
+	},
+}
+
+// timelineInterval is the -timeline bucket size.
+var timelineInterval time.Duration
+
+// parseTimeline parses the -timeline bucket size: minute, hour, or any
+// positive duration.
+func parseTimeline(s string) (time.Duration, error) {
+	switch s {
+	case "minute":
+		return time.Minute, nil
+	case "hour":
+		return time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid -timeline %q: want minute, hour, or a duration", s)
+	}
+	return d, nil
+}
+
+// findTime returns the first timestamp on line in any of timestampFormats,
+// or the zero time if there is none. A syslog timestamp, which has no year,
+// is in year 0, for datedTimes or withYear to give it one.
+func findTime(line []byte) time.Time {
+	for _, f := range timestampFormats {
+		m := f.re.Find(line)
+		if m == nil {
+			continue
+		}
+		var (
+			t   time.Time
+			err error
+		)
+		switch f.layout {
+		case "":
+			t, err = parseISOTime(string(m))
+		case time.Stamp:
+			t, err = time.Parse(time.Stamp, string(m))
+		default:
+			t, err = time.Parse(f.layout, string(m))
+		}
+		if err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// parseISOTime parses the ISO 8601 variants matched by timestampFormats,
+// treating times without a zone as UTC.
+func parseISOTime(s string) (time.Time, error) {
+	s = strings.Replace(s, " ", "T", 1)
+	s = strings.Replace(s, ",", ".", 1)
+	for _, layout := range []string{
+		"2006-01-02T15:04:05.999999999Z07:00",
+		"2006-01-02T15:04:05.999999999Z0700",
+		"2006-01-02T15:04:05.999999999",
+	} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Parse(time.RFC3339, s) // for its error.
+}
+
+// withYear gives a syslog time, which has no year, the most recent year that
+// doesn’t put it more than a day after now.
+func withYear(t, now time.Time) time.Time {
+	if t.Year() != 0 {
+		return t
+	}
+	t = t.AddDate(now.Year(), 0, 0)
+	if t.After(now.AddDate(0, 0, 1)) {
+		t = t.AddDate(-1, 0, 0)
+	}
+	return t
+}
+
+// datedTimes gives each syslog time in times, the times found in one file,
+// the year that puts it nearest the time before it, or, before any other,
+// the first time in the file that has a year, so that a year is inferred
+// from the lines around it and moves on where the times wrap from December
+// to January. A file with no timestamps but syslog’s has its first placed
+// by withYear.
+func datedTimes(times []time.Time) {
+	var prev time.Time // the time before, once one has a year.
+	for _, t := range times {
+		if !t.IsZero() && t.Year() != 0 {
+			prev = t
+			break
+		}
+	}
+	for i, t := range times {
+		switch {
+		case t.IsZero():
+			continue
+		case t.Year() != 0:
+		case prev.IsZero():
+			t = withYear(t, time.Now())
+		default:
+			t = nearYear(t, prev)
+		}
+		times[i], prev = t, t
+	}
+}
+
+// nearYear gives t, a syslog time, the year that puts it nearest to ref.
+func nearYear(t, ref time.Time) time.Time {
+	const halfYear = 183 * 24 * time.Hour
+	t = t.AddDate(ref.Year(), 0, 0)
+	switch {
+	case ref.Sub(t) > halfYear:
+		t = t.AddDate(1, 0, 0)
+	case t.Sub(ref) > halfYear:
+		t = t.AddDate(-1, 0, 0)
+	}
+	return t
+}
+
+// bucket counts the matches seen within one interval.
+type bucket struct {
+	Start time.Time `json:"start"`
+	Count int       `json:"count"`
+}
+
+// timelineResult is the output of -timeline.
+type timelineResult struct {
+	Buckets  []bucket `json:"buckets"`
+	Untimed  int      `json:"untimed"` // matches on lines without a timestamp.
+	Interval string   `json:"interval"`
+}
+
+// maxBuckets is the most intervals a timeline may span: a year of hours, and
+// some. More would be a screenful of nothing but empty intervals.
+const maxBuckets = 10000
+
+// buildTimeline counts the timestamped matches in results by interval d,
+// from the earliest to the latest, including empty intervals in between. It
+// fails if they span more than maxBuckets intervals.
+func buildTimeline(results []*scanResult, d time.Duration) (*timelineResult, error) {
+	var (
+		tl       = &timelineResult{Buckets: []bucket{}, Interval: intervalName(d)}
+		counts   = make(map[int64]int)
+		min, max time.Time
+	)
+	for _, r := range results {
+		for _, t := range r.Times {
+			if t.IsZero() {
+				tl.Untimed++
+				continue
+			}
+			t = t.Truncate(d)
+			counts[t.UnixNano()]++
+			if min.IsZero() || t.Before(min) {
+				min = t
+			}
+			if max.IsZero() || t.After(max) {
+				max = t
+			}
+		}
+	}
+	if min.IsZero() {
+		return tl, nil
+	}
+	if n := max.Sub(min)/d + 1; n > maxBuckets {
+		return nil, fmt.Errorf("-timeline %v: the times found span %d intervals, from %v to %v; the most is %d",
+			intervalName(d), n, min.Format(time.RFC3339), max.Format(time.RFC3339), maxBuckets)
+	}
+	for t := min; !t.After(max); t = t.Add(d) {
+		tl.Buckets = append(tl.Buckets, bucket{t, counts[t.UnixNano()]})
+	}
+	return tl, nil
+}
+
+// intervalName names d for display.
+func intervalName(d time.Duration) string {
+	switch d {
+	case time.Minute:
+		return "minute"
+	case time.Hour:
+		return "hour"
+	}
+	return d.String()
+}
+
+// timelineWidth is the length of the longest bar -timeline draws.
+const timelineWidth = 50
+
+// printTimeline implements -timeline: a histogram of matches over time.
+func printTimeline(tl *timelineResult) {
+	if *output == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(tl); err != nil {
+			die(err)
+		}
+		return
+	}
+	fmt.Printf("# matches per %v:\n", tl.Interval)
+	peak := 0
+	for _, b := range tl.Buckets {
+		if b.Count > peak {
+			peak = b.Count
+		}
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tMATCHES\t")
+	for _, b := range tl.Buckets {
+		bar := strings.Repeat("█", (b.Count*timelineWidth+peak-1)/peak)
+		fmt.Fprintf(w, "%v\t%d\t%v\n", b.Start.Format("2006-01-02 15:04:05 -0700"), b.Count, bar)
+	}
+	w.Flush()
+	if tl.Untimed > 0 {
+		fmt.Printf("(plus %d on lines without a timestamp)\n", tl.Untimed)
+	}
+	fmt.Println()
+}
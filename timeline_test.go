@@ -0,0 +1,152 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDatedTimes(t *testing.T) {
+	// syslog gives a day without a year, as findTime leaves it: in year 0.
+	syslog := func(month time.Month, day, hour int) time.Time {
+		return time.Date(0, month, day, hour, 0, 0, 0, time.UTC)
+	}
+	dated := func(year int, month time.Month, day, hour int) time.Time {
+		return time.Date(year, month, day, hour, 0, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		name     string
+		in, want []time.Time
+	}{
+		{
+			name: "after a dated time",
+			in:   []time.Time{dated(2021, 6, 1, 0), syslog(6, 2, 0)},
+			want: []time.Time{dated(2021, 6, 1, 0), dated(2021, 6, 2, 0)},
+		},
+		{
+			name: "before any dated time",
+			in:   []time.Time{syslog(3, 1, 0), dated(2019, 3, 2, 0)},
+			want: []time.Time{dated(2019, 3, 1, 0), dated(2019, 3, 2, 0)},
+		},
+		{
+			name: "into the new year",
+			in:   []time.Time{dated(2020, 12, 31, 23), syslog(12, 31, 23), syslog(1, 1, 0), syslog(1, 2, 0)},
+			want: []time.Time{dated(2020, 12, 31, 23), dated(2020, 12, 31, 23), dated(2021, 1, 1, 0), dated(2021, 1, 2, 0)},
+		},
+		{
+			name: "back into the old year",
+			in:   []time.Time{dated(2021, 1, 1, 0), syslog(12, 31, 23)},
+			want: []time.Time{dated(2021, 1, 1, 0), dated(2020, 12, 31, 23)},
+		},
+		{
+			name: "lines without times",
+			in:   []time.Time{{}, dated(2022, 5, 1, 0), {}, syslog(5, 1, 1)},
+			want: []time.Time{{}, dated(2022, 5, 1, 0), {}, dated(2022, 5, 1, 1)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := append([]time.Time(nil), tt.in...)
+			datedTimes(got)
+			for i := range got {
+				if !got[i].Equal(tt.want[i]) {
+					t.Errorf("time %d = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDatedTimesUndated(t *testing.T) {
+	// With no year to go by, a file’s times are taken to be of the last
+	// year before now.
+	times := []time.Time{time.Date(0, 1, 1, 0, 0, 0, 0, time.UTC)}
+	datedTimes(times)
+	if now := time.Now(); times[0].After(now.AddDate(0, 0, 1)) || times[0].Before(now.AddDate(-1, 0, 0)) {
+		t.Errorf("dated %v, more than a year before %v", times[0], now)
+	}
+}
+
+func TestBuildTimeline(t *testing.T) {
+	at := func(hour, min int) time.Time {
+		return time.Date(2024, 3, 1, hour, min, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		name    string
+		times   [][]time.Time // one slice per file.
+		d       time.Duration
+		want    []int // the count in each bucket.
+		untimed int
+		err     string
+	}{
+		{
+			name: "none",
+			d:    time.Hour,
+			want: []int{},
+		},
+		{
+			name:    "untimed only",
+			times:   [][]time.Time{{{}, {}}},
+			d:       time.Hour,
+			want:    []int{},
+			untimed: 2,
+		},
+		{
+			name:  "gaps are counted",
+			times: [][]time.Time{{at(10, 5), at(10, 55), at(13, 0)}},
+			d:     time.Hour,
+			want:  []int{2, 0, 0, 1},
+		},
+		{
+			name:    "across files",
+			times:   [][]time.Time{{at(10, 0), {}}, {at(10, 10), at(10, 20)}},
+			d:       10 * time.Minute,
+			want:    []int{1, 1, 1},
+			untimed: 1,
+		},
+		{
+			name:  "the most intervals",
+			times: [][]time.Time{{at(0, 0), at(0, 0).Add((maxBuckets - 1) * time.Minute)}},
+			d:     time.Minute,
+			want:  append(append([]int{1}, make([]int, maxBuckets-2)...), 1),
+		},
+		{
+			name:  "too many intervals",
+			times: [][]time.Time{{at(0, 0), at(0, 0).Add(maxBuckets * time.Minute)}},
+			d:     time.Minute,
+			err:   "span 10001 intervals",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var results []*scanResult
+			for _, times := range tt.times {
+				results = append(results, &scanResult{Times: times})
+			}
+			tl, err := buildTimeline(results, tt.d)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("buildTimeline: got error %v, want one saying %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tl.Untimed != tt.untimed {
+				t.Errorf("untimed = %d, want %d", tl.Untimed, tt.untimed)
+			}
+			if len(tl.Buckets) != len(tt.want) {
+				t.Fatalf("got %d buckets, want %d", len(tl.Buckets), len(tt.want))
+			}
+			for i, b := range tl.Buckets {
+				if b.Count != tt.want[i] {
+					t.Errorf("bucket %d (%v) counts %d, want %d", i, b.Start, b.Count, tt.want[i])
+				}
+				if i > 0 && b.Start.Sub(tl.Buckets[i-1].Start) != tt.d {
+					t.Errorf("bucket %d starts at %v, not %v after the one before", i, b.Start, tt.d)
+				}
+			}
+		})
+	}
+}
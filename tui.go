@@ -0,0 +1,412 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// tuiEntry is one row of the -tui browser: a unique IP and where it was
+// found.
+type tuiEntry struct {
+	ip     netip.Addr
+	key    string // ip.String().
+	order  int    // position in order of first appearance.
+	count  int    // occurrences across every file.
+	seen   *sightings
+	ann    *enrichment // set once looked up.
+	marked bool
+}
+
+// tuiSorts names the orders the browser can list entries in, cycled by “s”.
+var tuiSorts = []string{"count", "address", "first seen"}
+
+// tui is the state of the -tui browser.
+type tui struct {
+	entries []*tuiEntry // all of them, in the current order.
+	shown   []*tuiEntry // those passing the filter.
+	sources map[string]map[int][]byte
+	en      *enricher
+	tty     *os.File // the terminal, read from and drawn on.
+
+	cursor, top int    // selected row and first row shown, within shown.
+	sortBy      int    // index into tuiSorts.
+	filter      string // substring entries must contain.
+	filtering   bool   // whether keys are editing the filter.
+	message     string // shown in the status line until the next key.
+
+	lines    []string // with an entry’s source lines open, those lines.
+	linesTop int
+}
+
+// runTUI implements -tui: an interactive browser of the unique IPs in
+// results, in which they can be filtered, sorted, looked up with en, traced
+// to the lines they were found on, marked, and copied. It prints the IPs
+// marked when it exits.
+func runTUI(results []*scanResult, en *enricher) {
+	t := newTUI(results, en)
+	useTerminal("-tui", func(tty *os.File) {
+		t.tty = tty
+		t.loop()
+	})
+	for _, e := range t.entries {
+		if e.marked {
+			fmt.Println(e.key)
+		}
+	}
+}
+
+// useTerminal calls fn with the terminal in raw mode, showing its alternate
+// screen, and restores it afterward. It uses the terminal directly, as fzf
+// does, rather than stdin and stdout, which are thus left free for piping;
+// it dies, blaming option, if there is none.
+func useTerminal(option string, fn func(tty *os.File)) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil || !term.IsTerminal(int(tty.Fd())) {
+		die(option + " requires a terminal")
+	}
+	defer tty.Close()
+	state, err := term.MakeRaw(int(tty.Fd()))
+	if err != nil {
+		die(err)
+	}
+	fmt.Fprint(tty, "\x1b[?1049h\x1b[?25l") // alternate screen, hidden cursor.
+	fn(tty)
+	fmt.Fprint(tty, "\x1b[?25h\x1b[?1049l")
+	term.Restore(int(tty.Fd()), state)
+}
+
+// termSize returns the size of the terminal tty, or a guess if it can’t be
+// found.
+func termSize(tty *os.File) (width, height int) {
+	w, h, err := term.GetSize(int(tty.Fd()))
+	if err != nil {
+		return 80, 24
+	}
+	return w, h
+}
+
+// copyToClipboard puts text on the clipboard by means of the OSC 52 escape
+// sequence, which most terminal emulators support.
+func copyToClipboard(tty *os.File, text string) {
+	fmt.Fprintf(tty, "\x1b]52;c;%v\a", base64.StdEncoding.EncodeToString([]byte(text)))
+}
+
+func newTUI(results []*scanResult, en *enricher) *tui {
+	t := &tui{sources: make(map[string]map[int][]byte), en: en}
+	for _, r := range results {
+		t.sources[r.File] = r.Source
+	}
+	counts := make(map[netip.Addr]int)
+	for _, r := range results {
+		for _, ip := range r.IPs {
+			counts[ip]++
+		}
+	}
+	for i, s := range indexByIP(results) {
+		e := &tuiEntry{ip: s.ip, key: s.IP, order: i, count: counts[s.ip], seen: s}
+		t.entries = append(t.entries, e)
+	}
+	t.sort()
+	return t
+}
+
+// loop reads and handles keys until told to quit.
+func (t *tui) loop() {
+	buf := make([]byte, 16)
+	for {
+		t.draw()
+		n, err := t.tty.Read(buf)
+		if err != nil {
+			return
+		}
+		// Pasted or quickly typed text arrives in one read, but an escape
+		// sequence must be taken whole.
+		keys := []string{string(buf[:n])}
+		if buf[0] != '\x1b' {
+			keys = strings.Split(keys[0], "")
+		}
+		for _, k := range keys {
+			if !t.key(k) {
+				return
+			}
+		}
+	}
+}
+
+// key handles one keypress, or the escape sequence of one, and reports
+// whether to carry on.
+func (t *tui) key(k string) bool {
+	t.message = ""
+	if t.filtering {
+		switch k {
+		case "\r", "\x1b":
+			t.filtering = false
+		case "\x7f", "\b":
+			if t.filter != "" {
+				t.filter = t.filter[:len(t.filter)-1]
+			}
+		default:
+			if k >= " " && !strings.HasPrefix(k, "\x1b") {
+				t.filter += k
+			}
+		}
+		t.apply()
+		return true
+	}
+	if t.lines != nil {
+		switch k {
+		case "q", "\x1b", "\r":
+			t.lines = nil
+		case "j", "\x1b[B":
+			t.linesTop++
+		case "k", "\x1b[A":
+			t.linesTop--
+		case " ", "\x1b[6~":
+			t.linesTop += t.height()
+		case "\x1b[5~":
+			t.linesTop -= t.height()
+		}
+		return true
+	}
+	switch k {
+	case "q", "\x03":
+		return false
+	case "j", "\x1b[B":
+		t.move(1)
+	case "k", "\x1b[A":
+		t.move(-1)
+	case "\x1b[6~":
+		t.move(t.height())
+	case "\x1b[5~":
+		t.move(-t.height())
+	case "g":
+		t.move(-len(t.shown))
+	case "G":
+		t.move(len(t.shown))
+	case "/":
+		t.filtering = true
+	case "s":
+		t.sortBy = (t.sortBy + 1) % len(tuiSorts)
+		t.sort()
+	case " ":
+		if e := t.current(); e != nil {
+			e.marked = !e.marked
+			t.move(1)
+		}
+	case "\r":
+		t.openLines()
+	case "e":
+		t.lookUp()
+	case "y":
+		t.copy()
+	}
+	return true
+}
+
+// current returns the selected entry, or nil if none are shown.
+func (t *tui) current() *tuiEntry {
+	if t.cursor < len(t.shown) {
+		return t.shown[t.cursor]
+	}
+	return nil
+}
+
+// selected returns the marked entries, or the current one if none are.
+func (t *tui) selected() []*tuiEntry {
+	var sel []*tuiEntry
+	for _, e := range t.entries {
+		if e.marked {
+			sel = append(sel, e)
+		}
+	}
+	if len(sel) == 0 {
+		if e := t.current(); e != nil {
+			sel = append(sel, e)
+		}
+	}
+	return sel
+}
+
+func (t *tui) move(by int) {
+	t.cursor += by
+	if t.cursor >= len(t.shown) {
+		t.cursor = len(t.shown) - 1
+	}
+	if t.cursor < 0 {
+		t.cursor = 0
+	}
+}
+
+// sort puts the entries in the current order and reapplies the filter.
+func (t *tui) sort() {
+	less := map[string]func(a, b *tuiEntry) bool{
+		"count":      func(a, b *tuiEntry) bool { return a.count > b.count || a.count == b.count && a.order < b.order },
+		"address":    func(a, b *tuiEntry) bool { return a.ip.Less(b.ip) },
+		"first seen": func(a, b *tuiEntry) bool { return a.order < b.order },
+	}[tuiSorts[t.sortBy]]
+	sort.SliceStable(t.entries, func(i, j int) bool { return less(t.entries[i], t.entries[j]) })
+	t.apply()
+}
+
+// apply shows only the entries whose text contains the filter.
+func (t *tui) apply() {
+	t.shown = t.shown[:0]
+	for _, e := range t.entries {
+		if strings.Contains(textLine(e.ip, e.ann), t.filter) {
+			t.shown = append(t.shown, e)
+		}
+	}
+	t.move(0)
+}
+
+// lookUp runs the lookups requested on the command line against the
+// selected entries.
+func (t *tui) lookUp() {
+	if t.en == nil {
+		t.message = "no lookups were requested on the command line (e.g. -rdns or -asn-lookup)"
+		return
+	}
+	sel := t.selected()
+	ips := make([]netip.Addr, len(sel))
+	for i, e := range sel {
+		ips[i] = e.ip
+	}
+	t.message = fmt.Sprintf("looking up %d IPs…", len(ips))
+	t.draw()
+	ann := t.en.enrichAll(ips)
+	for _, e := range sel {
+		e.ann = ann[e.ip]
+	}
+	t.message = fmt.Sprintf("looked up %d IPs", len(ips))
+}
+
+// copy puts the selected IPs, one per line, on the clipboard.
+func (t *tui) copy() {
+	sel := t.selected()
+	ips := make([]string, len(sel))
+	for i, e := range sel {
+		ips[i] = e.key
+	}
+	copyToClipboard(t.tty, strings.Join(ips, "\n"))
+	t.message = fmt.Sprintf("copied %d IPs", len(ips))
+}
+
+// openLines shows the lines the current entry was found on.
+func (t *tui) openLines() {
+	e := t.current()
+	if e == nil {
+		return
+	}
+	t.lines = []string{fmt.Sprintf("%v: %d occurrences in %d files", e.key, e.count, len(e.seen.Files))}
+	for _, f := range e.seen.Files {
+		src := t.sources[f.File]
+		for _, n := range f.Lines {
+			text := src[n]
+			t.lines = append(t.lines, fmt.Sprintf("%v:%d:%s", f.File, n, text))
+		}
+	}
+	t.linesTop = 0
+}
+
+// height is the number of rows available for entries or lines.
+func (t *tui) height() int {
+	_, h := t.size()
+	if h -= 3; h < 1 {
+		h = 1
+	}
+	return h
+}
+
+func (t *tui) size() (width, height int) {
+	return termSize(t.tty)
+}
+
+// draw redraws the whole screen.
+func (t *tui) draw() {
+	var (
+		b    strings.Builder
+		w, _ = t.size()
+		h    = t.height()
+	)
+	b.WriteString("\x1b[H\x1b[2J")
+	row := func(s string, attr string) {
+		if r := []rune(s); len(r) > w {
+			s = string(r[:w])
+		}
+		if attr != "" {
+			s = attr + s + "\x1b[0m"
+		}
+		b.WriteString(s + "\r\n")
+	}
+	if t.lines != nil {
+		if t.linesTop > len(t.lines)-h {
+			t.linesTop = len(t.lines) - h
+		}
+		if t.linesTop < 0 {
+			t.linesTop = 0
+		}
+		row(t.lines[0], "\x1b[1m")
+		row("", "")
+		end := t.linesTop + 1 + h
+		if end > len(t.lines) {
+			end = len(t.lines)
+		}
+		for _, l := range t.lines[1+t.linesTop : end] {
+			row(strings.Replace(l, "\t", " ", -1), "")
+		}
+		t.status(&b, "↑/↓ scroll  q back")
+		fmt.Fprint(t.tty, b.String())
+		return
+	}
+
+	title := fmt.Sprintf("%v: %d unique IPs, sorted by %v", prog, len(t.entries), tuiSorts[t.sortBy])
+	if t.filter != "" || t.filtering {
+		title += fmt.Sprintf(", %d matching “%v”", len(t.shown), t.filter)
+	}
+	row(title, "\x1b[1m")
+	row(fmt.Sprintf("  %7v  %5v  %v", "COUNT", "FILES", "IP"), "\x1b[1m")
+	if t.cursor < t.top {
+		t.top = t.cursor
+	}
+	if t.cursor >= t.top+h {
+		t.top = t.cursor - h + 1
+	}
+	for i := t.top; i < len(t.shown) && i < t.top+h; i++ {
+		e := t.shown[i]
+		mark := " "
+		if e.marked {
+			mark = "*"
+		}
+		line := fmt.Sprintf("%v %7d  %5d  %v", mark, e.count, len(e.seen.Files), strings.Replace(textLine(e.ip, e.ann), "\t", "  ", -1))
+		attr := ""
+		if i == t.cursor {
+			attr = "\x1b[7m"
+		}
+		row(line, attr)
+	}
+	switch {
+	case t.filtering:
+		t.status(&b, "filter: "+t.filter+"▏")
+	default:
+		t.status(&b, "↑/↓ move  / filter  s sort  enter lines  e look up  space mark  y copy  q quit")
+	}
+	fmt.Fprint(t.tty, b.String())
+}
+
+// status writes s, or the pending message, on the bottom line.
+func (t *tui) status(b *strings.Builder, s string) {
+	w, h := t.size()
+	if t.message != "" {
+		s = t.message
+	}
+	if len([]rune(s)) > w {
+		s = string([]rune(s)[:w])
+	}
+	fmt.Fprintf(b, "\x1b[%d;1H\x1b[7m%v\x1b[0m", h, s)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"hash/maphash"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+const (
+	// exactEntrySize is roughly what each IP costs in a seenSet’s map,
+	// overhead included, for reckoning when it reaches -unique-memory.
+	exactEntrySize = 40
+
+	// bloomHashes is how many bits a bloomFilter sets for each IP: the most
+	// efficient number for a filter with 1% false positives, which is what
+	// one holding an IP for every 10 bits has.
+	bloomHashes = 7
+)
+
+// uniqueMemory is set by -unique-memory.
+var uniqueMemory sizeFlag
+
+// seenSet records which IPs have been seen, as -unique needs to print each
+// only once when results aren’t held: exactly, at first, but once that would
+// take more than -unique-memory, in a Bloom filter of that size, which never
+// grows but takes a few IPs it hasn’t seen for ones it has.
+type seenSet struct {
+	budget int64
+	exact  map[netip.Addr]bool
+	bloom  *bloomFilter
+}
+
+func newSeenSet(budget int64) *seenSet {
+	return &seenSet{budget: budget, exact: make(map[netip.Addr]bool)}
+}
+
+// add records ip, reporting whether it hadn’t been seen before.
+func (s *seenSet) add(ip netip.Addr) bool {
+	if s.bloom != nil {
+		return s.bloom.add(ip)
+	}
+	if s.exact[ip] {
+		return false
+	}
+	s.exact[ip] = true
+	if s.budget > 0 && int64(len(s.exact))*exactEntrySize > s.budget {
+		logger.Info("-unique-memory reached; remembering IPs approximately", "ips", len(s.exact))
+		s.bloom = newBloomFilter(s.budget)
+		for ip := range s.exact {
+			s.bloom.add(ip)
+		}
+		s.exact = nil
+	}
+	return true
+}
+
+// bloomFilter is a Bloom filter of IPs: a set of fixed size, however many
+// are added to it, that may report as present one that isn’t, the more
+// likely the fuller it is, but never the reverse.
+type bloomFilter struct {
+	bits  []uint64
+	seeds [2]maphash.Seed
+	n     int // IPs added.
+}
+
+// newBloomFilter returns an empty filter of about size bytes.
+func newBloomFilter(size int64) *bloomFilter {
+	words := size / 8
+	if words < 1 {
+		words = 1
+	}
+	return &bloomFilter{
+		bits:  make([]uint64, words),
+		seeds: [2]maphash.Seed{maphash.MakeSeed(), maphash.MakeSeed()},
+	}
+}
+
+// add adds ip, reporting whether it wasn’t already present — as far as the
+// filter can tell.
+func (b *bloomFilter) add(ip netip.Addr) bool {
+	a := ip.As16()
+	var (
+		m     = uint64(len(b.bits)) * 64
+		h1    = maphash.Bytes(b.seeds[0], a[:])
+		h2    = maphash.Bytes(b.seeds[1], a[:]) | 1
+		added bool
+	)
+	// Derive each hash from two, as Kirsch and Mitzenmacher showed loses
+	// nothing.
+	for i := uint64(0); i < bloomHashes; i++ {
+		bit := (h1 + i*h2) % m
+		if w, mask := bit/64, uint64(1)<<(bit%64); b.bits[w]&mask == 0 {
+			b.bits[w] |= mask
+			added = true
+		}
+	}
+	if added {
+		b.n++
+		if uint64(b.n) == m/10 {
+			logger.Info("-unique-memory filter is full; more than 1% of new IPs may now be taken for repeats", "ips", b.n)
+		}
+	}
+	return added
+}
+
+// sizeFlag is a flag giving an amount of memory, in bytes or with a suffix
+// of K, M, G, or T (and an optional B) for binary multiples of them.
+type sizeFlag int64
+
+func (b *sizeFlag) String() string { return strconv.FormatInt(int64(*b), 10) }
+
+func (b *sizeFlag) Set(s string) error {
+	var (
+		num  = strings.TrimSuffix(strings.ToUpper(s), "B")
+		mult = int64(1)
+	)
+	if i := strings.IndexAny(num, "KMGT"); i >= 0 && i == len(num)-1 {
+		mult = 1 << (10 * (strings.IndexByte("KMGT", num[i]) + 1))
+		num = num[:i]
+	}
+	n, err := strconv.ParseInt(num, 10, 64)
+	if err != nil || n < 0 || n > (1<<62)/mult {
+		return errors.New("want a number of bytes, optionally with K, M, G, or T")
+	}
+	*b = sizeFlag(n * mult)
+	return nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// Build information, which releases set with the linker, e.g.:
+//
+//	go build -ldflags "-X main.version=1.4.0 -X main.commit=$(git rev-parse HEAD) -X main.date=$(date -u +%FT%TZ)"
+//
+// Anything left unset is filled in from the build info Go embeds, if any.
+var (
+	version = ""
+	commit  = ""
+	date    = ""
+)
+
+// printVersion implements -version.
+func printVersion() {
+	v, c, d := version, commit, date
+	if info, ok := debug.ReadBuildInfo(); ok {
+		if v == "" && info.Main.Version != "(devel)" {
+			v = info.Main.Version
+		}
+		for _, s := range info.Settings {
+			switch {
+			case s.Key == "vcs.revision" && c == "":
+				c = s.Value
+			case s.Key == "vcs.time" && d == "":
+				d = s.Value
+			case s.Key == "vcs.modified" && s.Value == "true" && c != "" && commit == "":
+				c += "-dirty"
+			}
+		}
+	}
+	if v == "" {
+		v = "(devel)"
+	}
+	fmt.Printf("%v %v\n", prog, v)
+	fmt.Printf("commit: %v\n", orMissing(c))
+	fmt.Printf("built:  %v\n", orMissing(d))
+	fmt.Printf("go:     %v %v/%v\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
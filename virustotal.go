@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// vtMaxDomains caps how many associated domains are fetched per IP.
+const vtMaxDomains = 10
+
+// vtInfo is the subset of a VirusTotal IP address report ipgrep reports.
+type vtInfo struct {
+	Malicious  int      `json:"malicious"`
+	Suspicious int      `json:"suspicious"`
+	Harmless   int      `json:"harmless"`
+	Undetected int      `json:"undetected"`
+	Domains    []string `json:"domains,omitempty"` // hostnames that resolved to the IP.
+}
+
+var (
+	// vtRate spaces out requests to fit -vt-rate; it is set up by enrich.
+	vtRate *throttle
+
+	// vtExhausted is set once VirusTotal reports the API quota used up. From
+	// then on, only cached reports are returned.
+	vtExhausted atomic.Bool
+)
+
+// lookupVirusTotal fetches VirusTotal’s report on ip and the domains seen
+// resolving to it, consulting the cache first. A nil result means
+// the query failed or the quota has run out.
+func lookupVirusTotal(ip, key string, timeout time.Duration) *vtInfo {
+	b, err := cached("virustotal", ip, func() ([]byte, error) {
+		info, err := fetchVirusTotal(ip, key, timeout)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(info)
+	})
+	if err != nil || len(b) == 0 {
+		return nil
+	}
+	var info vtInfo
+	if json.Unmarshal(b, &info) != nil {
+		return nil
+	}
+	return &info
+}
+
+func fetchVirusTotal(ip, key string, timeout time.Duration) (*vtInfo, error) {
+	base := "https://www.virustotal.com/api/v3/ip_addresses/" + ip
+	var report struct {
+		Data struct {
+			Attributes struct {
+				Stats vtInfo `json:"last_analysis_stats"`
+			} `json:"attributes"`
+		} `json:"data"`
+	}
+	if err := vtGet(base, key, timeout, &report); err != nil {
+		return nil, err
+	}
+	info := report.Data.Attributes.Stats
+	var resolutions struct {
+		Data []struct {
+			Attributes struct {
+				HostName string `json:"host_name"`
+			} `json:"attributes"`
+		} `json:"data"`
+	}
+	err := vtGet(fmt.Sprintf("%v/resolutions?limit=%d", base, vtMaxDomains), key, timeout, &resolutions)
+	if err != nil && err != errNotFound {
+		return nil, err
+	}
+	for _, r := range resolutions.Data {
+		info.Domains = append(info.Domains, r.Attributes.HostName)
+	}
+	return &info, nil
+}
+
+// vtGet waits its turn under vtRate, then fetches url and decodes the
+// response into v.
+func vtGet(url, key string, timeout time.Duration, v interface{}) error {
+	if vtExhausted.Load() {
+		return errRateLimited
+	}
+	vtRate.wait()
+	b, err := apiGet(url, http.Header{"X-Apikey": {key}}, timeout)
+	if err == errRateLimited {
+		vtExhausted.Store(true)
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// columns returns the text-mode fields for v, or placeholders if v is nil.
+func (v *vtInfo) columns() []column {
+	if v == nil {
+		return []column{{"VT", missing}, {"DOMAINS", missing}}
+	}
+	total := v.Malicious + v.Suspicious + v.Harmless + v.Undetected
+	return []column{
+		{"VT", fmt.Sprintf("%d/%d", v.Malicious, total)},
+		{"DOMAINS", orMissing(strings.Join(v.Domains, ","))},
+	}
+}
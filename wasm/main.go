@@ -0,0 +1,59 @@
+//go:build js && wasm
+
+// Command wasm is ipgrep’s extraction for the browser. Built with
+//
+//	GOOS=js GOARCH=wasm go build -o ipgrep.wasm ./wasm
+//
+// and loaded with the wasm_exec.js shipped with Go, it defines a global
+// object, ipgrep, whose extract(text) returns an array of the IPs in text,
+// as the ipgrep command would print them, in order. Its matches(text)
+// returns objects instead, giving each IP’s token, line, column, and
+// offset as well.
+package main
+
+import (
+	"strings"
+	"syscall/js"
+
+	"github.com/princebot/ipgrep/ipgrep"
+)
+
+func main() {
+	js.Global().Set("ipgrep", map[string]any{
+		"extract": js.FuncOf(extract),
+		"matches": js.FuncOf(matches),
+	})
+	select {} // keep the functions callable.
+}
+
+// extract implements ipgrep.extract.
+func extract(this js.Value, args []js.Value) any {
+	ips := []any{}
+	for m := range ipgrep.All(strings.NewReader(text(args))) {
+		ips = append(ips, m.IP.String())
+	}
+	return ips
+}
+
+// matches implements ipgrep.matches.
+func matches(this js.Value, args []js.Value) any {
+	found := []any{}
+	for m := range ipgrep.All(strings.NewReader(text(args))) {
+		found = append(found, map[string]any{
+			"ip":     m.IP.String(),
+			"token":  m.Artifact.Text,
+			"line":   m.Line,
+			"column": m.Column,
+			"offset": m.Offset, // a byte offset in the text’s UTF-8 form.
+		})
+	}
+	return found
+}
+
+// text returns the argument to a function, or "" if there is none.
+func text(args []js.Value) string {
+	if len(args) == 0 || args[0].Type() != js.TypeString {
+		return ""
+	}
+	return args[0].String()
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"os"
+)
+
+// watched holds the entries of the -watchlist file, or nil if none was given.
+var watched *ipSet
+
+// loadWatchlist reads an analyst-maintained file of IPs and CIDR blocks, one
+// per line, in the same format as a plain feed.
+func loadWatchlist(path string) (*ipSet, error) {
+	fp, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+	s, err := parseIPList(fp)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+	return s, nil
+}
+
+// watchlistHits counts the IPs in ann that matched the watchlist.
+func watchlistHits(ann map[netip.Addr]*enrichment) int {
+	var n int
+	for _, e := range ann {
+		if e.Watchlist {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/princebot/ipgrep/ipgrep"
+)
+
+// windowReport is how often -follow -window prints the top talkers.
+const windowReport = 10 * time.Second
+
+// talkers keeps rolling counts of the IPs seen within a sliding window.
+type talkers struct {
+	window time.Duration
+	seen   map[netip.Addr][]time.Time // when each IP was seen, oldest first.
+	ann    map[netip.Addr]*enrichment // latest enrichment for each IP.
+}
+
+func newTalkers(window time.Duration) *talkers {
+	return &talkers{
+		window: window,
+		seen:   make(map[netip.Addr][]time.Time),
+		ann:    make(map[netip.Addr]*enrichment),
+	}
+}
+
+// add records that ip, annotated with e, was seen at t.
+func (t *talkers) add(ip netip.Addr, e *enrichment, at time.Time) {
+	t.seen[ip] = append(t.seen[ip], at)
+	t.ann[ip] = e
+}
+
+// count forgets sightings of ip older than the window ending at now and
+// returns how many remain.
+func (t *talkers) count(ip netip.Addr, now time.Time) int {
+	return t.expire(ip, now.Add(-t.window))
+}
+
+// expire forgets sightings of ip made at or before cutoff, forgetting ip
+// entirely if none are left, and returns how many remain.
+func (t *talkers) expire(ip netip.Addr, cutoff time.Time) int {
+	times := t.seen[ip]
+	i := sort.Search(len(times), func(i int) bool { return times[i].After(cutoff) })
+	if i == len(times) {
+		delete(t.seen, ip)
+		delete(t.ann, ip)
+		return 0
+	}
+	t.seen[ip] = times[i:]
+	return len(times) - i
+}
+
+// sweep forgets every sighting older than the window ending at now.
+func (t *talkers) sweep(now time.Time) {
+	cutoff := now.Add(-t.window)
+	for ip := range t.seen {
+		t.expire(ip, cutoff)
+	}
+}
+
+// talker is an IP and how often it was seen within the window.
+type talker struct {
+	IP    netip.Addr
+	Count int
+}
+
+// top forgets sightings older than the window ending at now and returns the
+// n IPs seen most often within it, busiest first.
+func (t *talkers) top(now time.Time, n int) []talker {
+	var (
+		cutoff = now.Add(-t.window)
+		out    []talker
+	)
+	for ip := range t.seen {
+		if n := t.expire(ip, cutoff); n > 0 {
+			out = append(out, talker{ip, n})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].IP.String() < out[j].IP.String()
+	})
+	if len(out) > n {
+		out = out[:n]
+	}
+	return out
+}
+
+// print prints the top n talkers as of now.
+func (t *talkers) print(now time.Time, n int) {
+	top := t.top(now, n)
+	if *output == "json" {
+		type jsonTalker struct {
+			jsonNote
+			Count int `json:"count"`
+		}
+		v := struct {
+			Time    time.Time         `json:"time"`
+			Window  string            `json:"window"`
+			Talkers []json.RawMessage `json:"talkers"`
+		}{now, t.window.String(), []json.RawMessage{}}
+		for _, tk := range top {
+			n := ipgrep.Note{Fields: jsonTalker{jsonNote{classify(tk.IP), t.ann[tk.IP]}, tk.Count}}
+			b, err := ipgrep.MarshalMatch(ipMatch(tk.IP), n)
+			if err != nil {
+				die(err)
+			}
+			v.Talkers = append(v.Talkers, b)
+		}
+		json.NewEncoder(os.Stdout).Encode(v)
+		return
+	}
+	fmt.Printf("# top talkers over the last %v, as of %v:\n", t.window, now.Format("15:04:05"))
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	for i, tk := range top {
+		cols := append([]column{{"COUNT", fmt.Sprint(tk.Count)}}, textColumns(tk.IP, t.ann[tk.IP])...)
+		if i == 0 {
+			fmt.Fprintln(w, joinColumns(cols, func(c column) string { return c.header }))
+		}
+		fmt.Fprintln(w, joinColumns(cols, func(c column) string { return c.value }))
+	}
+	w.Flush()
+	fmt.Println()
+}